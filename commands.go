@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"app/config"
+	"app/internal/infrastructure/persistence/postgres"
+)
+
+const usage = `Usage:
+  app                       start the HTTP server
+  app backup [-o file]      write a backup archive (default: stdout)
+  app restore [-i file]     load a backup archive (default: stdin)
+`
+
+// runCommand handles the non-server modes of the binary and returns the
+// process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "backup":
+		return backupCommand(args[1:])
+	case "restore":
+		return restoreCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func backupCommand(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "-", "archive file to write, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Printf("error: %v", err)
+			return 1
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Printf("error: failed to close %s: %v", *output, err)
+			}
+		}()
+		w = file
+	}
+
+	return withDB(func(ctx context.Context, db *sql.DB) error {
+		stats, err := postgres.Backup(ctx, db, w)
+		if err != nil {
+			return err
+		}
+		logStats("backed up", stats.Rows)
+		return nil
+	})
+}
+
+func restoreCommand(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("i", "-", "archive file to read, - for stdin")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			log.Printf("error: %v", err)
+			return 1
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		r = file
+	}
+
+	return withDB(func(ctx context.Context, db *sql.DB) error {
+		stats, err := postgres.Restore(ctx, db, r)
+		if err != nil {
+			return err
+		}
+		logStats("restored", stats.Rows)
+		logStats("skipped existing", stats.Skipped)
+		return nil
+	})
+}
+
+func withDB(fn func(ctx context.Context, db *sql.DB) error) int {
+	cfg := config.Load()
+
+	db, err := connectDB(cfg.DatabaseURL)
+	if err != nil {
+		log.Printf("error: failed to connect to database: %v", err)
+		return 1
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if err := fn(context.Background(), db); err != nil {
+		log.Printf("error: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func logStats(action string, rows map[string]int) {
+	tables := make([]string, 0, len(rows))
+	for table := range rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		log.Printf("%s %d rows from %s", action, rows[table], table)
+	}
+}
@@ -3,21 +3,120 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 const (
-	defaultPort  = "8080"
-	defaultUIURL = "http://localhost:5173"
+	defaultPort                  = "8080"
+	defaultUIURL                 = "http://localhost:5173"
+	defaultDeletedLinksRetention = 30 * 24 * time.Hour
+	defaultMetadataFetchTimeout  = 5 * time.Second
+	defaultMetadataMaxBytes      = 512 * 1024
+	defaultHealthCheckInterval   = 24 * time.Hour
+	defaultHealthCheckTimeout    = 10 * time.Second
+	defaultHealthCheckRetention  = 30 * 24 * time.Hour
+	defaultBlocklistRefresh      = time.Hour
+	defaultAbuseReportThreshold  = 5
+	defaultCreateRateLimit       = "20/1m"
+	defaultRedirectRateLimit     = "300/1m"
+	defaultReportRateLimit       = "10/1h"
+	defaultBulkRateLimit         = "10/1h"
 )
 
+// defaultTrustedProxies trusts a reverse proxy on the same host, such as the
+// Caddy in front of the app.
+var defaultTrustedProxies = []string{"127.0.0.1", "::1"}
+
 type Config struct {
 	DatabaseURL  string
 	Port         string
 	BaseURL      string
 	UIURL        string
 	RollbarToken string
+
+	// TrustedProxies are the addresses or CIDR ranges allowed to tell the
+	// client address in ClientIPHeaders, localhost unless TRUSTED_PROXIES
+	// is set. Requests from anywhere else are attributed to their peer
+	// address. TrustedPlatform "cloudflare" believes CF-Connecting-IP from
+	// any peer, which is only safe when the origin refuses traffic that
+	// bypasses Cloudflare.
+	TrustedProxies  []string
+	ClientIPHeaders []string
+	TrustedPlatform string
+
+	// DeletedLinksRetention is how long soft-deleted links stay in the trash
+	// before the background purge removes them for good.
+	DeletedLinksRetention time.Duration
+
+	// DisabledLinkStatus and BannedLinkStatus are the HTTP statuses served by
+	// /r/:code for links taken out of service. Zero means the handler default.
+	DisabledLinkStatus int
+	BannedLinkStatus   int
+
+	// BatchMaxOperations caps the size of a single batch request.
+	BatchMaxOperations int
+
+	// IPPrivacyMode is none, truncate or hash and decides how visitor IPs
+	// are stored. IPHashSalt keys the hash mode.
+	IPPrivacyMode string
+	IPHashSalt    string
+
+	// VisitRetention is how long raw visits are kept before they are rolled
+	// up into daily stats. Zero keeps them forever.
+	VisitRetention time.Duration
+
+	// MetadataFetchTimeout and MetadataMaxBytes bound the background fetch
+	// of a destination page's title, description and favicon.
+	MetadataFetchTimeout time.Duration
+	MetadataMaxBytes     int
+
+	// HealthCheckInterval is how often each link's destination is checked.
+	// Zero disables health checks. A link is marked broken after
+	// HealthCheckFailures failed checks in a row.
+	HealthCheckInterval  time.Duration
+	HealthCheckFailures  int
+	HealthCheckTimeout   time.Duration
+	HealthCheckRetention time.Duration
+
+	// DestinationSchemes, DestinationAllowedDomains and
+	// DestinationDeniedDomains restrict where links may point. OwnDomains
+	// are hosts the shortener answers on besides the one in BaseURL.
+	// BlockPrivateDestinations refuses hosts on private networks and hosts
+	// that do not resolve.
+	DestinationSchemes        []string
+	DestinationAllowedDomains []string
+	DestinationDeniedDomains  []string
+	OwnDomains                []string
+	BlockPrivateDestinations  bool
+
+	// BlocklistFiles are local phishing and malware lists written as
+	// format:path. With BlocklistMirrorURL set they are downloaded from the
+	// mirror again every BlocklistRefreshInterval.
+	BlocklistFiles           []string
+	BlocklistMirrorURL       string
+	BlocklistRefreshInterval time.Duration
+
+	// AbuseReportThreshold is how many people must report a link before it
+	// is disabled pending moderation. Zero turns automatic disabling off, and
+	// so does IPPrivacyMode truncate without IPHashSalt, since reporters
+	// cannot then be told apart.
+	AbuseReportThreshold int
+
+	// CreateRateLimit, BulkRateLimit, RedirectRateLimit and ReportRateLimit
+	// are token buckets per caller, written as requests/period ("20/1m"); 0
+	// turns a limit off. BulkRateLimit covers batches and imports, and
+	// ReportRateLimit both ways of reporting abuse.
+	// RateLimitStore is "memory" (the default) for a limiter per instance or
+	// "postgres" for buckets shared through the database.
+	CreateRateLimit   string
+	BulkRateLimit     string
+	RedirectRateLimit string
+	ReportRateLimit   string
+	RateLimitStore    string
 }
 
 func Load() *Config {
@@ -31,6 +130,42 @@ func Load() *Config {
 		BaseURL:      os.Getenv("BASE_URL"),
 		UIURL:        os.Getenv("UI_URL"),
 		RollbarToken: os.Getenv("ROLLBAR_TOKEN"),
+
+		TrustedProxies:  listEnv("TRUSTED_PROXIES"),
+		ClientIPHeaders: listEnv("CLIENT_IP_HEADERS"),
+		TrustedPlatform: os.Getenv("TRUSTED_PLATFORM"),
+
+		DeletedLinksRetention: durationEnv("DELETED_LINKS_RETENTION", defaultDeletedLinksRetention),
+		DisabledLinkStatus:    errorStatusEnv("DISABLED_LINK_STATUS"),
+		BannedLinkStatus:      errorStatusEnv("BANNED_LINK_STATUS"),
+		BatchMaxOperations:    intEnv("BATCH_MAX_OPERATIONS", 0),
+		IPPrivacyMode:         os.Getenv("IP_PRIVACY_MODE"),
+		IPHashSalt:            os.Getenv("IP_HASH_SALT"),
+		VisitRetention:        durationEnv("VISIT_RETENTION", 0),
+		MetadataFetchTimeout:  durationEnv("METADATA_FETCH_TIMEOUT", defaultMetadataFetchTimeout),
+		MetadataMaxBytes:      intEnv("METADATA_MAX_BYTES", defaultMetadataMaxBytes),
+		HealthCheckInterval:   durationEnv("HEALTH_CHECK_INTERVAL", defaultHealthCheckInterval),
+		HealthCheckFailures:   intEnv("HEALTH_CHECK_FAILURES", 0),
+		HealthCheckTimeout:    durationEnv("HEALTH_CHECK_TIMEOUT", defaultHealthCheckTimeout),
+		HealthCheckRetention:  durationEnv("HEALTH_CHECK_RETENTION", defaultHealthCheckRetention),
+
+		DestinationSchemes:        listEnv("DESTINATION_SCHEMES"),
+		DestinationAllowedDomains: listEnv("DESTINATION_ALLOWED_DOMAINS"),
+		DestinationDeniedDomains:  listEnv("DESTINATION_DENIED_DOMAINS"),
+		OwnDomains:                listEnv("OWN_DOMAINS"),
+		BlockPrivateDestinations:  boolEnv("BLOCK_PRIVATE_DESTINATIONS", true),
+
+		BlocklistFiles:           listEnv("BLOCKLIST_FILES"),
+		BlocklistMirrorURL:       os.Getenv("BLOCKLIST_MIRROR_URL"),
+		BlocklistRefreshInterval: durationEnv("BLOCKLIST_REFRESH_INTERVAL", defaultBlocklistRefresh),
+
+		AbuseReportThreshold: intEnv("ABUSE_REPORT_THRESHOLD", defaultAbuseReportThreshold),
+
+		CreateRateLimit:   os.Getenv("RATE_LIMIT_CREATE"),
+		BulkRateLimit:     os.Getenv("RATE_LIMIT_BULK"),
+		RedirectRateLimit: os.Getenv("RATE_LIMIT_REDIRECT"),
+		ReportRateLimit:   os.Getenv("RATE_LIMIT_REPORT"),
+		RateLimitStore:    os.Getenv("RATE_LIMIT_STORE"),
 	}
 
 	if config.Port == "" {
@@ -45,5 +180,91 @@ func Load() *Config {
 		config.UIURL = defaultUIURL
 	}
 
+	if _, ok := os.LookupEnv("TRUSTED_PROXIES"); !ok {
+		config.TrustedProxies = defaultTrustedProxies
+	}
+
+	if config.CreateRateLimit == "" {
+		config.CreateRateLimit = defaultCreateRateLimit
+	}
+
+	if config.BulkRateLimit == "" {
+		config.BulkRateLimit = defaultBulkRateLimit
+	}
+
+	if config.RedirectRateLimit == "" {
+		config.RedirectRateLimit = defaultRedirectRateLimit
+	}
+
+	if config.ReportRateLimit == "" {
+		config.ReportRateLimit = defaultReportRateLimit
+	}
+
 	return config
 }
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %s: %v", key, value, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func intEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %d: %v", key, value, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+// errorStatusEnv reads an HTTP error status. Anything outside 400-599
+// falls back to zero, the handler default: other statuses would serve a
+// notice page as a success or redirect, and invalid ones panic when
+// written.
+func errorStatusEnv(key string) int {
+	status := intEnv(key, 0)
+	if status != 0 && (status < 400 || status > 599) {
+		log.Printf("Warning: invalid %s %d, using the default: want a 4xx or 5xx status", key, status)
+		return 0
+	}
+	return status
+}
+
+func boolEnv(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %t: %v", key, value, fallback, err)
+		return fallback
+	}
+	return b
+}
+
+// listEnv reads a comma-separated list, skipping empty entries.
+func listEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
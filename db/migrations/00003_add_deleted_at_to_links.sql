@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_links_deleted_at ON links(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_links_deleted_at;
+ALTER TABLE links DROP COLUMN deleted_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE links
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'disabled', 'banned')),
+    ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE links
+    DROP COLUMN status_reason,
+    DROP COLUMN status;
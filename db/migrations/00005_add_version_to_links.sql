@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN version;
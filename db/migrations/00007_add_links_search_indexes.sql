@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_links_original_url_trgm ON links USING GIN (original_url gin_trgm_ops);
+CREATE INDEX idx_links_short_name_trgm ON links USING GIN (short_name gin_trgm_ops);
+CREATE INDEX idx_links_tags ON links USING GIN (tags);
+CREATE INDEX idx_links_created_at ON links(created_at);
+
+-- +goose Down
+DROP INDEX idx_links_created_at;
+DROP INDEX idx_links_tags;
+DROP INDEX idx_links_short_name_trgm;
+DROP INDEX idx_links_original_url_trgm;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE INDEX idx_links_created_at_id ON links(created_at, id);
+DROP INDEX idx_links_created_at;
+
+CREATE INDEX idx_link_visits_created_at_id ON link_visits(created_at, id);
+DROP INDEX idx_link_visits_created_at;
+
+-- +goose Down
+CREATE INDEX idx_link_visits_created_at ON link_visits(created_at);
+DROP INDEX idx_link_visits_created_at_id;
+
+CREATE INDEX idx_links_created_at ON links(created_at);
+DROP INDEX idx_links_created_at_id;
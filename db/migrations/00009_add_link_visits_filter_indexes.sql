@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE INDEX idx_link_visits_link_id_created_at ON link_visits(link_id, created_at, id);
+DROP INDEX idx_link_visits_link_id;
+
+CREATE INDEX idx_link_visits_ip ON link_visits(ip);
+
+-- +goose Down
+DROP INDEX idx_link_visits_ip;
+
+CREATE INDEX idx_link_visits_link_id ON link_visits(link_id);
+DROP INDEX idx_link_visits_link_id_created_at;
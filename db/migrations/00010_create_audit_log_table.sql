@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    criteria JSONB NOT NULL DEFAULT '{}',
+    affected BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+-- +goose Down
+DROP TABLE audit_log;
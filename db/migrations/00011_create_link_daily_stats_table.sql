@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE link_daily_stats (
+    link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    uniques BIGINT NOT NULL DEFAULT 0,
+    referrers JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (link_id, day)
+);
+
+CREATE INDEX idx_link_daily_stats_day ON link_daily_stats(day);
+
+-- +goose Down
+DROP TABLE link_daily_stats;
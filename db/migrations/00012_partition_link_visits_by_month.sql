@@ -0,0 +1,73 @@
+-- +goose Up
+ALTER TABLE link_visits RENAME TO link_visits_unpartitioned;
+ALTER TABLE link_visits_unpartitioned RENAME CONSTRAINT link_visits_pkey TO link_visits_unpartitioned_pkey;
+-- Keep the id sequence alive when the old table is dropped.
+ALTER SEQUENCE link_visits_id_seq OWNED BY NONE;
+
+CREATE TABLE link_visits (
+    id INTEGER NOT NULL DEFAULT nextval('link_visits_id_seq'),
+    link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    user_agent TEXT,
+    referer TEXT,
+    status INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+-- One partition per month from the oldest visit up to three months ahead.
+-- The app creates later ones; anything outside lands in the default.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    month DATE;
+    last_month DATE := (date_trunc('month', NOW()) + INTERVAL '3 months')::date;
+BEGIN
+    SELECT date_trunc('month', COALESCE(MIN(created_at), NOW()))::date INTO month
+    FROM link_visits_unpartitioned;
+
+    WHILE month <= last_month LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF link_visits FOR VALUES FROM (%L) TO (%L)',
+            'link_visits_' || to_char(month, 'YYYY_MM'), month, (month + INTERVAL '1 month')::date);
+        month := (month + INTERVAL '1 month')::date;
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+CREATE TABLE link_visits_default PARTITION OF link_visits DEFAULT;
+
+INSERT INTO link_visits (id, link_id, ip, user_agent, referer, status, created_at)
+SELECT id, link_id, ip, user_agent, referer, status, created_at FROM link_visits_unpartitioned;
+
+DROP TABLE link_visits_unpartitioned;
+ALTER SEQUENCE link_visits_id_seq OWNED BY link_visits.id;
+
+CREATE INDEX idx_link_visits_created_at_id ON link_visits(created_at, id);
+CREATE INDEX idx_link_visits_link_id_created_at ON link_visits(link_id, created_at, id);
+CREATE INDEX idx_link_visits_ip ON link_visits(ip);
+
+-- +goose Down
+ALTER TABLE link_visits RENAME TO link_visits_partitioned;
+ALTER TABLE link_visits_partitioned RENAME CONSTRAINT link_visits_pkey TO link_visits_partitioned_pkey;
+ALTER SEQUENCE link_visits_id_seq OWNED BY NONE;
+
+CREATE TABLE link_visits (
+    id INTEGER PRIMARY KEY DEFAULT nextval('link_visits_id_seq'),
+    link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    user_agent TEXT,
+    referer TEXT,
+    status INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO link_visits (id, link_id, ip, user_agent, referer, status, created_at)
+SELECT id, link_id, ip, user_agent, referer, status, created_at FROM link_visits_partitioned;
+
+DROP TABLE link_visits_partitioned;
+ALTER SEQUENCE link_visits_id_seq OWNED BY link_visits.id;
+
+CREATE INDEX idx_link_visits_created_at_id ON link_visits(created_at, id);
+CREATE INDEX idx_link_visits_link_id_created_at ON link_visits(link_id, created_at, id);
+CREATE INDEX idx_link_visits_ip ON link_visits(ip);
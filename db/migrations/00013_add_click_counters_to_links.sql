@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN click_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE links ADD COLUMN last_visited_at TIMESTAMP;
+
+UPDATE links
+SET click_count = counts.clicks, last_visited_at = counts.last_visited_at
+FROM (
+    SELECT l.id, COALESCE(v.clicks, 0) + COALESCE(s.clicks, 0) AS clicks,
+        GREATEST(v.last_visited_at, s.last_day::timestamp) AS last_visited_at
+    FROM links l
+    LEFT JOIN (
+        SELECT link_id, COUNT(*) AS clicks, MAX(created_at) AS last_visited_at FROM link_visits GROUP BY link_id
+    ) v ON v.link_id = l.id
+    LEFT JOIN (
+        SELECT link_id, SUM(clicks) AS clicks, MAX(day) AS last_day FROM link_daily_stats GROUP BY link_id
+    ) s ON s.link_id = l.id
+) counts
+WHERE links.id = counts.id;
+
+CREATE INDEX idx_links_click_count ON links(click_count, id);
+CREATE INDEX idx_links_last_visited_at ON links(last_visited_at, id);
+
+-- +goose Down
+DROP INDEX idx_links_last_visited_at;
+DROP INDEX idx_links_click_count;
+ALTER TABLE links DROP COLUMN last_visited_at;
+ALTER TABLE links DROP COLUMN click_count;
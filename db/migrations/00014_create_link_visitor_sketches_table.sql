@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE link_visitor_sketches (
+    link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (link_id, day)
+);
+
+-- +goose Down
+DROP TABLE link_visitor_sketches;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Visits recorded before classification existed cannot be told apart and
+-- count as human.
+ALTER TABLE link_visits ADD COLUMN class TEXT NOT NULL DEFAULT 'human';
+CREATE INDEX idx_link_visits_link_id_class_created_at ON link_visits(link_id, class, created_at);
+
+ALTER TABLE link_daily_stats ADD COLUMN class TEXT NOT NULL DEFAULT 'human';
+ALTER TABLE link_daily_stats DROP CONSTRAINT link_daily_stats_pkey;
+ALTER TABLE link_daily_stats ADD PRIMARY KEY (link_id, day, class);
+
+-- +goose Down
+DELETE FROM link_daily_stats WHERE class <> 'human';
+ALTER TABLE link_daily_stats DROP CONSTRAINT link_daily_stats_pkey;
+ALTER TABLE link_daily_stats ADD PRIMARY KEY (link_id, day);
+ALTER TABLE link_daily_stats DROP COLUMN class;
+
+DROP INDEX idx_link_visits_link_id_class_created_at;
+ALTER TABLE link_visits DROP COLUMN class;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN og_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN og_description TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN og_image TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN og_image;
+ALTER TABLE links DROP COLUMN og_description;
+ALTER TABLE links DROP COLUMN og_title;
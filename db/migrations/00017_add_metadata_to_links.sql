@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN favicon_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN metadata_fetched_at TIMESTAMP;
+
+CREATE INDEX idx_links_metadata_pending ON links(id) WHERE metadata_fetched_at IS NULL AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_links_metadata_pending;
+ALTER TABLE links DROP COLUMN metadata_fetched_at;
+ALTER TABLE links DROP COLUMN favicon_url;
+ALTER TABLE links DROP COLUMN description;
+ALTER TABLE links DROP COLUMN title;
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE link_health (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    checked_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    status_code INT NOT NULL DEFAULT 0,
+    latency_ms INT NOT NULL DEFAULT 0,
+    redirect_chain TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_link_health_link_id_checked_at ON link_health(link_id, checked_at DESC);
+CREATE INDEX idx_link_health_checked_at ON link_health(checked_at);
+
+ALTER TABLE links ADD COLUMN broken BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE links ADD COLUMN health_failures INT NOT NULL DEFAULT 0;
+ALTER TABLE links ADD COLUMN health_checked_at TIMESTAMP;
+
+CREATE INDEX idx_links_health_checked_at ON links(health_checked_at NULLS FIRST, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_links_broken ON links(id) WHERE broken AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_links_broken;
+DROP INDEX idx_links_health_checked_at;
+ALTER TABLE links DROP COLUMN health_checked_at;
+ALTER TABLE links DROP COLUMN health_failures;
+ALTER TABLE links DROP COLUMN broken;
+DROP TABLE link_health;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE abuse_reports (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    reporter_email TEXT NOT NULL DEFAULT '',
+    reporter_ip TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX idx_abuse_reports_status_created_at ON abuse_reports(status, created_at);
+CREATE INDEX idx_abuse_reports_link_id_status ON abuse_reports(link_id, status);
+
+ALTER TABLE links ADD COLUMN abuse_threshold INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN abuse_threshold;
+DROP TABLE abuse_reports;
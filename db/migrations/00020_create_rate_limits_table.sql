@@ -0,0 +1,13 @@
+-- +goose Up
+-- Token buckets shared between instances. They refill on their own, so
+-- losing them in a crash only forgives recent requests.
+CREATE UNLOGGED TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_rate_limits_updated_at ON rate_limits(updated_at);
+
+-- +goose Down
+DROP TABLE rate_limits;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Only redirected human visits count as clicks on a link. Rolled up days
+-- cannot be split after the fact, so their clicks all count as redirects.
+ALTER TABLE link_daily_stats ADD COLUMN redirects BIGINT NOT NULL DEFAULT 0;
+UPDATE link_daily_stats SET redirects = clicks;
+
+-- +goose Down
+ALTER TABLE link_daily_stats DROP COLUMN redirects;
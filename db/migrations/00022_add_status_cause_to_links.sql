@@ -0,0 +1,9 @@
+-- +goose Up
+-- Links the service disabled on its own could only be told apart by their
+-- reason text until now.
+ALTER TABLE links ADD COLUMN status_cause TEXT NOT NULL DEFAULT '';
+UPDATE links SET status_cause = 'blocklist' WHERE status = 'disabled' AND status_reason LIKE 'blocklist%';
+UPDATE links SET status_cause = 'abuse' WHERE status = 'disabled' AND status_reason LIKE 'abuse:%';
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN status_cause;
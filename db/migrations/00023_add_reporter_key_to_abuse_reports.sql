@@ -0,0 +1,8 @@
+-- +goose Up
+-- Reporter IPs are stored like visitor IPs, which may rotate daily or be
+-- shared by a whole network, so reporters are counted by a key of their
+-- own. Earlier reports have none and no longer count towards thresholds.
+ALTER TABLE abuse_reports ADD COLUMN reporter_key TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE abuse_reports DROP COLUMN reporter_key;
@@ -0,0 +1,25 @@
+-- name: CreateAbuseReport :one
+INSERT INTO abuse_reports (link_id, reason, details, reporter_email, reporter_ip, reporter_key, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, link_id, reason, details, reporter_email, reporter_ip, reporter_key, status, created_at, resolved_at;
+
+-- name: GetAbuseReport :one
+SELECT id, link_id, reason, details, reporter_email, reporter_ip, reporter_key, status, created_at, resolved_at
+FROM abuse_reports
+WHERE id = $1;
+
+-- name: CountAbuseReporters :one
+SELECT COUNT(DISTINCT reporter_key)
+FROM abuse_reports
+WHERE link_id = $1 AND status = 'open' AND reporter_key <> '';
+
+-- name: ResolveAbuseReport :one
+UPDATE abuse_reports
+SET status = $2, resolved_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING id, link_id, reason, details, reporter_email, reporter_ip, reporter_key, status, created_at, resolved_at;
+
+-- name: ResolveLinkAbuseReports :execrows
+UPDATE abuse_reports
+SET status = $2, resolved_at = NOW()
+WHERE link_id = $1 AND status = 'open';
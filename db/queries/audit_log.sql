@@ -0,0 +1,4 @@
+-- name: CreateAuditEntry :one
+INSERT INTO audit_log (action, actor, criteria, affected)
+VALUES ($1, $2, $3, $4)
+RETURNING id, action, actor, criteria, affected, created_at;
@@ -0,0 +1,31 @@
+-- name: RecordLinkHealthCheck :one
+WITH check_row AS (
+    INSERT INTO link_health (link_id, checked_at, status_code, latency_ms, redirect_chain, error)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING link_id, checked_at
+)
+UPDATE links
+SET health_failures = CASE WHEN $7 THEN 0 ELSE links.health_failures + 1 END,
+    broken = CASE WHEN $7 THEN false ELSE links.health_failures + 1 >= $8 END,
+    health_checked_at = check_row.checked_at
+FROM check_row
+WHERE links.id = check_row.link_id
+RETURNING links.broken, links.health_failures, links.health_checked_at;
+
+-- name: GetLinkHealthChecks :many
+SELECT id, link_id, checked_at, status_code, latency_ms, redirect_chain, error
+FROM link_health
+WHERE link_id = $1
+ORDER BY checked_at DESC, id DESC
+LIMIT $2;
+
+-- name: PruneLinkHealthChecks :execrows
+DELETE FROM link_health
+WHERE checked_at < $1;
+
+-- name: GetLinksDueForHealthCheck :many
+SELECT id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold
+FROM links
+WHERE deleted_at IS NULL AND status = 'active' AND (health_checked_at IS NULL OR health_checked_at < $1)
+ORDER BY health_checked_at NULLS FIRST, id
+LIMIT $2;
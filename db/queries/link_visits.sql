@@ -1,22 +1,41 @@
 -- name: CreateLinkVisit :one
-INSERT INTO link_visits (link_id, ip, user_agent, referer, status)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, link_id, ip, user_agent, referer, status, created_at;
+WITH visit AS (
+    INSERT INTO link_visits (link_id, ip, user_agent, referer, status, class)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING id, link_id, ip, user_agent, referer, status, class, created_at
+), counted AS (
+    UPDATE links
+    SET click_count = click_count + 1, last_visited_at = GREATEST(last_visited_at, visit.created_at)
+    FROM visit
+    WHERE links.id = visit.link_id AND visit.class = 'human' AND visit.status BETWEEN 300 AND 399
+), sketched AS (
+    INSERT INTO link_visitor_sketches (link_id, day, sketch)
+    SELECT link_id, created_at::date, set_byte(decode(repeat('00', 4096), 'hex'), $7, $8)
+    FROM visit
+    WHERE class = 'human' AND status BETWEEN 300 AND 399
+    ON CONFLICT (link_id, day) DO UPDATE
+    SET sketch = set_byte(link_visitor_sketches.sketch, $7, GREATEST(get_byte(link_visitor_sketches.sketch, $7), $8))
+)
+SELECT id, link_id, ip, user_agent, referer, status, class, created_at FROM visit;
 
--- name: GetLinkVisits :many
-SELECT id, link_id, ip, user_agent, referer, status, created_at
-FROM link_visits
-ORDER BY created_at DESC
-LIMIT $1 OFFSET $2;
+-- name: GetSketchedVisitorIPs :many
+SELECT ip FROM link_visits
+WHERE link_id = $1 AND created_at >= $2::date AND created_at < $2::date + 1
+    AND class = 'human' AND status BETWEEN 300 AND 399;
+
+-- name: SetVisitorSketch :exec
+INSERT INTO link_visitor_sketches (link_id, day, sketch)
+VALUES ($1, $2::date, $3)
+ON CONFLICT (link_id, day) DO UPDATE SET sketch = EXCLUDED.sketch;
 
--- name: CountLinkVisits :one
-SELECT COUNT(*) FROM link_visits;
+-- name: DeleteVisitorSketch :exec
+DELETE FROM link_visitor_sketches WHERE link_id = $1 AND day = $2::date;
 
 -- name: DeleteLinkVisit :exec
 DELETE FROM link_visits WHERE id = $1;
 
 -- name: GetLinkVisitsByLinkID :many
-SELECT id, link_id, ip, user_agent, referer, status, created_at
+SELECT id, link_id, ip, user_agent, referer, status, class, created_at
 FROM link_visits
 WHERE link_id = $1
 ORDER BY created_at DESC
@@ -1,34 +1,88 @@
 -- name: GetLinkByShortName :one
-SELECT id, original_url, short_name, created_at
+SELECT id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold
 FROM links
-WHERE short_name = $1;
+WHERE short_name = $1 AND deleted_at IS NULL;
 
 -- name: CreateLink :one
-INSERT INTO links (original_url, short_name)
-VALUES ($1, $2)
-RETURNING id, original_url, short_name, created_at;
+INSERT INTO links (original_url, short_name, tags, og_title, og_description, og_image)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold;
 
 -- name: GetLinkByID :one
-SELECT id, original_url, short_name, created_at
+SELECT id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold
 FROM links
-WHERE id = $1;
-
--- name: GetAllLinks :many
-SELECT id, original_url, short_name, created_at
-FROM links
-ORDER BY id;
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: UpdateLink :one
 UPDATE links
-SET original_url = $1, short_name = $2
-WHERE id = $3
-RETURNING id, original_url, short_name, created_at;
+SET original_url = $1, short_name = $2, tags = $5, og_title = $6, og_description = $7, og_image = $8, abuse_threshold = $9,
+    title = CASE WHEN original_url = $1 THEN title ELSE '' END,
+    description = CASE WHEN original_url = $1 THEN description ELSE '' END,
+    favicon_url = CASE WHEN original_url = $1 THEN favicon_url ELSE '' END,
+    metadata_fetched_at = CASE WHEN original_url = $1 THEN metadata_fetched_at END,
+    broken = CASE WHEN original_url = $1 THEN broken ELSE false END,
+    health_failures = CASE WHEN original_url = $1 THEN health_failures ELSE 0 END,
+    health_checked_at = CASE WHEN original_url = $1 THEN health_checked_at END,
+    version = version + 1
+WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+RETURNING id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold;
+
+-- name: SetLinkStatus :one
+UPDATE links
+SET status = $2, status_cause = $3, status_reason = $4, version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold;
+
+-- name: SoftDeleteLink :exec
+UPDATE links
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreLink :one
+UPDATE links
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold;
 
--- name: DeleteLink :exec
+-- name: PurgeDeletedLinks :execrows
 DELETE FROM links
-WHERE id = $1;
+WHERE deleted_at IS NOT NULL AND deleted_at < $1;
 
 -- name: ExistsByShortName :one
 SELECT EXISTS (
     SELECT 1 FROM links WHERE short_name = $1
 );
+
+-- name: SetLinkMetadata :exec
+UPDATE links
+SET title = $3, description = $4, favicon_url = $5, metadata_fetched_at = $6
+WHERE id = $1 AND original_url = $2;
+
+-- name: GetLinksWithoutMetadata :many
+SELECT id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold
+FROM links
+WHERE metadata_fetched_at IS NULL AND deleted_at IS NULL
+ORDER BY id
+LIMIT $1;
+
+-- name: ReconcileClickCounts :execrows
+UPDATE links
+SET click_count = counts.clicks, last_visited_at = counts.last_visited_at
+FROM (
+    SELECT l.id, COALESCE(v.clicks, 0) + COALESCE(s.clicks, 0) AS clicks,
+        GREATEST(v.last_visited_at, s.last_day::timestamp) AS last_visited_at
+    FROM links l
+    LEFT JOIN (
+        SELECT link_id, COUNT(*) AS clicks, MAX(created_at) AS last_visited_at FROM link_visits
+        WHERE class = 'human' AND status BETWEEN 300 AND 399 AND ($1::bigint[] IS NULL OR link_id = ANY($1))
+        GROUP BY link_id
+    ) v ON v.link_id = l.id
+    LEFT JOIN (
+        SELECT link_id, SUM(redirects) AS clicks, MAX(day) FILTER (WHERE redirects > 0) AS last_day FROM link_daily_stats
+        WHERE class = 'human' AND ($1::bigint[] IS NULL OR link_id = ANY($1))
+        GROUP BY link_id
+    ) s ON s.link_id = l.id
+    WHERE $1::bigint[] IS NULL OR l.id = ANY($1)
+) counts
+WHERE links.id = counts.id
+    AND (links.click_count IS DISTINCT FROM counts.clicks OR links.last_visited_at IS DISTINCT FROM counts.last_visited_at);
@@ -0,0 +1,17 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limits AS b (key, tokens, updated_at)
+VALUES ($1, $2::double precision - 1, clock_timestamp())
+ON CONFLICT (key) DO UPDATE
+SET tokens = LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at)::double precision * $3::double precision) - 1,
+    updated_at = clock_timestamp()
+WHERE LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at)::double precision * $3::double precision) >= 1
+RETURNING tokens;
+
+-- name: GetRateLimitTokens :one
+SELECT LEAST($2::double precision, tokens + EXTRACT(EPOCH FROM clock_timestamp() - updated_at)::double precision * $3::double precision)
+FROM rate_limits
+WHERE key = $1;
+
+-- name: PruneRateLimits :execrows
+DELETE FROM rate_limits
+WHERE updated_at < clock_timestamp() - make_interval(secs => $1);
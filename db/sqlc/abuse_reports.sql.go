@@ -0,0 +1,66 @@
+package sqlc
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type AbuseReport struct {
+	ID            int64
+	LinkID        int64
+	Reason        string
+	Details       string
+	ReporterEmail string
+	ReporterIP    string
+	ReporterKey   string
+	Status        string
+	CreatedAt     time.Time
+	ResolvedAt    sql.NullTime
+}
+
+const AbuseReportColumns = "id, link_id, reason, details, reporter_email, reporter_ip, reporter_key, status, created_at, resolved_at"
+
+func ScanAbuseReport(row RowScanner) (AbuseReport, error) {
+	var report AbuseReport
+	err := row.Scan(&report.ID, &report.LinkID, &report.Reason, &report.Details, &report.ReporterEmail, &report.ReporterIP, &report.ReporterKey,
+		&report.Status, &report.CreatedAt, &report.ResolvedAt)
+	return report, err
+}
+
+func (q *Queries) CreateAbuseReport(ctx context.Context, linkID int64, reason, details, reporterEmail, reporterIP, reporterKey string, createdAt time.Time) (AbuseReport, error) {
+	return ScanAbuseReport(q.db.QueryRowContext(ctx,
+		"INSERT INTO abuse_reports (link_id, reason, details, reporter_email, reporter_ip, reporter_key, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING "+AbuseReportColumns,
+		linkID, reason, details, reporterEmail, reporterIP, reporterKey, createdAt))
+}
+
+func (q *Queries) GetAbuseReport(ctx context.Context, id int64) (AbuseReport, error) {
+	return ScanAbuseReport(q.db.QueryRowContext(ctx,
+		"SELECT "+AbuseReportColumns+" FROM abuse_reports WHERE id = $1",
+		id))
+}
+
+func (q *Queries) CountAbuseReporters(ctx context.Context, linkID int64) (int, error) {
+	var reporters int
+	err := q.db.QueryRowContext(ctx,
+		"SELECT COUNT(DISTINCT reporter_key) FROM abuse_reports WHERE link_id = $1 AND status = 'open' AND reporter_key <> ''",
+		linkID).Scan(&reporters)
+	return reporters, err
+}
+
+// ResolveAbuseReport closes a report that is still open.
+func (q *Queries) ResolveAbuseReport(ctx context.Context, id int64, status string) (AbuseReport, error) {
+	return ScanAbuseReport(q.db.QueryRowContext(ctx,
+		"UPDATE abuse_reports SET status = $2, resolved_at = NOW() WHERE id = $1 AND status = 'open' RETURNING "+AbuseReportColumns,
+		id, status))
+}
+
+func (q *Queries) ResolveLinkAbuseReports(ctx context.Context, linkID int64, status string) (int64, error) {
+	result, err := q.db.ExecContext(ctx,
+		"UPDATE abuse_reports SET status = $2, resolved_at = NOW() WHERE link_id = $1 AND status = 'open'",
+		linkID, status)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
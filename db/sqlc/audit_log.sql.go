@@ -0,0 +1,29 @@
+package sqlc
+
+import (
+	"context"
+	"time"
+)
+
+type AuditEntry struct {
+	ID        int64
+	Action    string
+	Actor     string
+	Criteria  []byte
+	Affected  int64
+	CreatedAt time.Time
+}
+
+const AuditEntryColumns = "id, action, actor, criteria, affected, created_at"
+
+func ScanAuditEntry(row RowScanner) (AuditEntry, error) {
+	var entry AuditEntry
+	err := row.Scan(&entry.ID, &entry.Action, &entry.Actor, &entry.Criteria, &entry.Affected, &entry.CreatedAt)
+	return entry, err
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, action, actor string, criteria []byte, affected int64) (AuditEntry, error) {
+	return ScanAuditEntry(q.db.QueryRowContext(ctx,
+		"INSERT INTO audit_log (action, actor, criteria, affected) VALUES ($1, $2, $3, $4) RETURNING "+AuditEntryColumns,
+		action, actor, string(criteria), affected))
+}
@@ -4,55 +4,117 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Link struct {
-	ID          int64
-	OriginalURL string
-	ShortName   string
-	CreatedAt   time.Time
+	ID                int64
+	OriginalURL       string
+	ShortName         string
+	CreatedAt         time.Time
+	DeletedAt         sql.NullTime
+	Status            string
+	StatusReason      string
+	StatusCause       string
+	Version           int
+	Tags              []string
+	ClickCount        int64
+	LastVisitedAt     sql.NullTime
+	OGTitle           string
+	OGDescription     string
+	OGImage           string
+	Title             string
+	Description       string
+	FaviconURL        string
+	MetadataFetchedAt sql.NullTime
+	Broken            bool
+	HealthFailures    int
+	HealthCheckedAt   sql.NullTime
+	AbuseThreshold    int
+}
+
+const LinkColumns = "id, original_url, short_name, created_at, deleted_at, status, status_reason, status_cause, version, tags, click_count, last_visited_at, og_title, og_description, og_image, title, description, favicon_url, metadata_fetched_at, broken, health_failures, health_checked_at, abuse_threshold"
+
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+func ScanLink(row RowScanner) (Link, error) {
+	var link Link
+	err := row.Scan(&link.ID, &link.OriginalURL, &link.ShortName, &link.CreatedAt, &link.DeletedAt, &link.Status, &link.StatusReason, &link.StatusCause, &link.Version, pq.Array(&link.Tags), &link.ClickCount, &link.LastVisitedAt, &link.OGTitle, &link.OGDescription, &link.OGImage,
+		&link.Title, &link.Description, &link.FaviconURL, &link.MetadataFetchedAt, &link.Broken, &link.HealthFailures, &link.HealthCheckedAt, &link.AbuseThreshold)
+	return link, err
+}
+
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 type Queries struct {
-	db *sql.DB
+	db DBTX
 }
 
-func New(db *sql.DB) *Queries {
+func New(db DBTX) *Queries {
 	return &Queries{db: db}
 }
 
-func (q *Queries) DB() *sql.DB {
+func (q *Queries) WithTx(tx *sql.Tx) *Queries {
+	return &Queries{db: tx}
+}
+
+func (q *Queries) DB() DBTX {
 	return q.db
 }
 
 func (q *Queries) GetLinkByShortName(ctx context.Context, shortName string) (Link, error) {
-	var link Link
-	err := q.db.QueryRowContext(ctx,
-		"SELECT id, original_url, short_name, created_at FROM links WHERE short_name = $1",
-		shortName).Scan(&link.ID, &link.OriginalURL, &link.ShortName, &link.CreatedAt)
-	return link, err
+	return ScanLink(q.db.QueryRowContext(ctx,
+		"SELECT "+LinkColumns+" FROM links WHERE short_name = $1 AND deleted_at IS NULL",
+		shortName))
 }
 
-func (q *Queries) CreateLink(ctx context.Context, originalURL, shortName string) (Link, error) {
-	var link Link
-	err := q.db.QueryRowContext(ctx,
-		"INSERT INTO links (original_url, short_name) VALUES ($1, $2) RETURNING id, original_url, short_name, created_at",
-		originalURL, shortName).Scan(&link.ID, &link.OriginalURL, &link.ShortName, &link.CreatedAt)
-	return link, err
+func (q *Queries) CreateLink(ctx context.Context, originalURL, shortName string, tags []string, ogTitle, ogDescription, ogImage string) (Link, error) {
+	return ScanLink(q.db.QueryRowContext(ctx,
+		"INSERT INTO links (original_url, short_name, tags, og_title, og_description, og_image) VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+LinkColumns,
+		originalURL, shortName, pq.Array(tags), ogTitle, ogDescription, ogImage))
 }
 
 func (q *Queries) GetLinkByID(ctx context.Context, id int64) (Link, error) {
-	var link Link
-	err := q.db.QueryRowContext(ctx,
-		"SELECT id, original_url, short_name, created_at FROM links WHERE id = $1",
-		id).Scan(&link.ID, &link.OriginalURL, &link.ShortName, &link.CreatedAt)
-	return link, err
+	return ScanLink(q.db.QueryRowContext(ctx,
+		"SELECT "+LinkColumns+" FROM links WHERE id = $1 AND deleted_at IS NULL",
+		id))
 }
 
-func (q *Queries) GetAllLinks(ctx context.Context, offset, limit int) ([]Link, error) {
+func (q *Queries) UpdateLink(ctx context.Context, originalURL, shortName string, id int64, version int, tags []string, ogTitle, ogDescription, ogImage string, abuseThreshold int) (Link, error) {
+	return ScanLink(q.db.QueryRowContext(ctx,
+		`UPDATE links SET original_url = $1, short_name = $2, tags = $5, og_title = $6, og_description = $7, og_image = $8, abuse_threshold = $9,
+			title = CASE WHEN original_url = $1 THEN title ELSE '' END,
+			description = CASE WHEN original_url = $1 THEN description ELSE '' END,
+			favicon_url = CASE WHEN original_url = $1 THEN favicon_url ELSE '' END,
+			metadata_fetched_at = CASE WHEN original_url = $1 THEN metadata_fetched_at END,
+			broken = CASE WHEN original_url = $1 THEN broken ELSE false END,
+			health_failures = CASE WHEN original_url = $1 THEN health_failures ELSE 0 END,
+			health_checked_at = CASE WHEN original_url = $1 THEN health_checked_at END,
+			version = version + 1
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL RETURNING `+LinkColumns,
+		originalURL, shortName, id, version, pq.Array(tags), ogTitle, ogDescription, ogImage, abuseThreshold))
+}
+
+// SetLinkMetadata stores fetched metadata unless the link has been pointed
+// at another URL in the meantime.
+func (q *Queries) SetLinkMetadata(ctx context.Context, id int64, originalURL, title, description, faviconURL string, fetchedAt time.Time) error {
+	_, err := q.db.ExecContext(ctx,
+		"UPDATE links SET title = $3, description = $4, favicon_url = $5, metadata_fetched_at = $6 WHERE id = $1 AND original_url = $2",
+		id, originalURL, title, description, faviconURL, fetchedAt)
+	return err
+}
+
+func (q *Queries) GetLinksWithoutMetadata(ctx context.Context, limit int) ([]Link, error) {
 	rows, err := q.db.QueryContext(ctx,
-		"SELECT id, original_url, short_name, created_at FROM links ORDER BY id LIMIT $1 OFFSET $2",
-		limit, offset)
+		"SELECT "+LinkColumns+" FROM links WHERE metadata_fetched_at IS NULL AND deleted_at IS NULL ORDER BY id LIMIT $1",
+		limit)
 	if err != nil {
 		return nil, err
 	}
@@ -62,8 +124,8 @@ func (q *Queries) GetAllLinks(ctx context.Context, offset, limit int) ([]Link, e
 
 	var links []Link
 	for rows.Next() {
-		var link Link
-		if err := rows.Scan(&link.ID, &link.OriginalURL, &link.ShortName, &link.CreatedAt); err != nil {
+		link, err := ScanLink(rows)
+		if err != nil {
 			return nil, err
 		}
 		links = append(links, link)
@@ -71,19 +133,31 @@ func (q *Queries) GetAllLinks(ctx context.Context, offset, limit int) ([]Link, e
 	return links, rows.Err()
 }
 
-func (q *Queries) UpdateLink(ctx context.Context, originalURL, shortName string, id int64) (Link, error) {
-	var link Link
-	err := q.db.QueryRowContext(ctx,
-		"UPDATE links SET original_url = $1, short_name = $2 WHERE id = $3 RETURNING id, original_url, short_name, created_at",
-		originalURL, shortName, id).Scan(&link.ID, &link.OriginalURL, &link.ShortName, &link.CreatedAt)
-	return link, err
+func (q *Queries) SetLinkStatus(ctx context.Context, id int64, status, cause, reason string) (Link, error) {
+	return ScanLink(q.db.QueryRowContext(ctx,
+		"UPDATE links SET status = $2, status_cause = $3, status_reason = $4, version = version + 1 WHERE id = $1 AND deleted_at IS NULL RETURNING "+LinkColumns,
+		id, status, cause, reason))
 }
 
-func (q *Queries) DeleteLink(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, "DELETE FROM links WHERE id = $1", id)
+func (q *Queries) SoftDeleteLink(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, "UPDATE links SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", id)
 	return err
 }
 
+func (q *Queries) RestoreLink(ctx context.Context, id int64) (Link, error) {
+	return ScanLink(q.db.QueryRowContext(ctx,
+		"UPDATE links SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING "+LinkColumns,
+		id))
+}
+
+func (q *Queries) PurgeDeletedLinks(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, "DELETE FROM links WHERE deleted_at IS NOT NULL AND deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func (q *Queries) ExistsByShortName(ctx context.Context, shortName string) (bool, error) {
 	var exists bool
 	err := q.db.QueryRowContext(ctx,
@@ -99,21 +173,82 @@ type LinkVisit struct {
 	UserAgent string
 	Referer   string
 	Status    int
+	Class     string
 	CreatedAt time.Time
 }
 
-func (q *Queries) CreateLinkVisit(ctx context.Context, linkID int64, ip, userAgent, referer string, status int) (LinkVisit, error) {
+const LinkVisitColumns = "id, link_id, ip, user_agent, referer, status, class, created_at"
+
+func ScanLinkVisit(row RowScanner) (LinkVisit, error) {
 	var visit LinkVisit
-	err := q.db.QueryRowContext(ctx,
-		"INSERT INTO link_visits (link_id, ip, user_agent, referer, status) VALUES ($1, $2, $3, $4, $5) RETURNING id, link_id, ip, user_agent, referer, status, created_at",
-		linkID, ip, userAgent, referer, status).Scan(&visit.ID, &visit.LinkID, &visit.IP, &visit.UserAgent, &visit.Referer, &visit.Status, &visit.CreatedAt)
+	err := row.Scan(&visit.ID, &visit.LinkID, &visit.IP, &visit.UserAgent, &visit.Referer, &visit.Status, &visit.Class, &visit.CreatedAt)
 	return visit, err
 }
 
-func (q *Queries) GetLinkVisits(ctx context.Context, limit, offset int) ([]LinkVisit, error) {
+// CreateLinkVisit records a visit and, for human visits that were
+// redirected, bumps the link's click counter and raises one register of the
+// day's visitor sketch in the same statement. New sketches start as 4096
+// zero bytes.
+func (q *Queries) CreateLinkVisit(ctx context.Context, linkID int64, ip, userAgent, referer string, status int, class string, sketchIndex int, sketchRank uint8) (LinkVisit, error) {
+	return ScanLinkVisit(q.db.QueryRowContext(ctx,
+		`WITH visit AS (
+			INSERT INTO link_visits (link_id, ip, user_agent, referer, status, class) VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING `+LinkVisitColumns+`
+		), counted AS (
+			UPDATE links SET click_count = click_count + 1,
+				last_visited_at = GREATEST(last_visited_at, visit.created_at)
+			FROM visit WHERE links.id = visit.link_id AND visit.class = 'human' AND visit.status BETWEEN 300 AND 399
+		), sketched AS (
+			INSERT INTO link_visitor_sketches (link_id, day, sketch)
+			SELECT link_id, created_at::date, set_byte(decode(repeat('00', 4096), 'hex'), $7, $8)
+			FROM visit WHERE class = 'human' AND status BETWEEN 300 AND 399
+			ON CONFLICT (link_id, day) DO UPDATE
+			SET sketch = set_byte(link_visitor_sketches.sketch, $7,
+				GREATEST(get_byte(link_visitor_sketches.sketch, $7), $8))
+		)
+		SELECT `+LinkVisitColumns+` FROM visit`,
+		linkID, ip, userAgent, referer, status, class, sketchIndex, int(sketchRank)))
+}
+
+// ReconcileClickCounts recomputes the click counters of the given links, or
+// of every link when linkIDs is nil, from their raw redirected human visits
+// and daily stats, returning how many links were corrected.
+func (q *Queries) ReconcileClickCounts(ctx context.Context, linkIDs []int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, `UPDATE links SET click_count = counts.clicks, last_visited_at = counts.last_visited_at
+		FROM (
+			SELECT l.id, COALESCE(v.clicks, 0) + COALESCE(s.clicks, 0) AS clicks,
+				GREATEST(v.last_visited_at, s.last_day::timestamp) AS last_visited_at
+			FROM links l
+			LEFT JOIN (
+				SELECT link_id, COUNT(*) AS clicks, MAX(created_at) AS last_visited_at FROM link_visits
+				WHERE class = 'human' AND status BETWEEN 300 AND 399 AND ($1::bigint[] IS NULL OR link_id = ANY($1))
+				GROUP BY link_id
+			) v ON v.link_id = l.id
+			LEFT JOIN (
+				SELECT link_id, SUM(redirects) AS clicks, MAX(day) FILTER (WHERE redirects > 0) AS last_day FROM link_daily_stats
+				WHERE class = 'human' AND ($1::bigint[] IS NULL OR link_id = ANY($1))
+				GROUP BY link_id
+			) s ON s.link_id = l.id
+			WHERE $1::bigint[] IS NULL OR l.id = ANY($1)
+		) counts
+		WHERE links.id = counts.id
+			AND (links.click_count IS DISTINCT FROM counts.clicks OR links.last_visited_at IS DISTINCT FROM counts.last_visited_at)`,
+		pq.Array(linkIDs))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetSketchedVisitorIPs returns the stored IP values of a link's redirected
+// human visits on one day, the visits its visitor sketch for that day
+// counts.
+func (q *Queries) GetSketchedVisitorIPs(ctx context.Context, linkID int64, day time.Time) ([]string, error) {
 	rows, err := q.db.QueryContext(ctx,
-		"SELECT id, link_id, ip, user_agent, referer, status, created_at FROM link_visits ORDER BY created_at DESC LIMIT $1 OFFSET $2",
-		limit, offset)
+		`SELECT ip FROM link_visits
+		WHERE link_id = $1 AND created_at >= $2::date AND created_at < $2::date + 1
+			AND class = 'human' AND status BETWEEN 300 AND 399`,
+		linkID, day)
 	if err != nil {
 		return nil, err
 	}
@@ -121,21 +256,28 @@ func (q *Queries) GetLinkVisits(ctx context.Context, limit, offset int) ([]LinkV
 		_ = rows.Close()
 	}()
 
-	var visits []LinkVisit
+	var ips []string
 	for rows.Next() {
-		var visit LinkVisit
-		if err := rows.Scan(&visit.ID, &visit.LinkID, &visit.IP, &visit.UserAgent, &visit.Referer, &visit.Status, &visit.CreatedAt); err != nil {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
 			return nil, err
 		}
-		visits = append(visits, visit)
+		ips = append(ips, ip)
 	}
-	return visits, rows.Err()
+	return ips, rows.Err()
 }
 
-func (q *Queries) CountLinkVisits(ctx context.Context) (int, error) {
-	var total int
-	err := q.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM link_visits").Scan(&total)
-	return total, err
+func (q *Queries) SetVisitorSketch(ctx context.Context, linkID int64, day time.Time, sketch []byte) error {
+	_, err := q.db.ExecContext(ctx,
+		`INSERT INTO link_visitor_sketches (link_id, day, sketch) VALUES ($1, $2::date, $3)
+		ON CONFLICT (link_id, day) DO UPDATE SET sketch = EXCLUDED.sketch`,
+		linkID, day, sketch)
+	return err
+}
+
+func (q *Queries) DeleteVisitorSketch(ctx context.Context, linkID int64, day time.Time) error {
+	_, err := q.db.ExecContext(ctx, "DELETE FROM link_visitor_sketches WHERE link_id = $1 AND day = $2::date", linkID, day)
+	return err
 }
 
 func (q *Queries) DeleteLinkVisit(ctx context.Context, id int64) error {
@@ -0,0 +1,111 @@
+package sqlc
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type LinkHealthCheck struct {
+	ID            int64
+	LinkID        int64
+	CheckedAt     time.Time
+	StatusCode    int
+	LatencyMs     int
+	RedirectChain []string
+	Error         string
+}
+
+const LinkHealthCheckColumns = "id, link_id, checked_at, status_code, latency_ms, redirect_chain, error"
+
+func ScanLinkHealthCheck(row RowScanner) (LinkHealthCheck, error) {
+	var check LinkHealthCheck
+	err := row.Scan(&check.ID, &check.LinkID, &check.CheckedAt, &check.StatusCode, &check.LatencyMs, pq.Array(&check.RedirectChain), &check.Error)
+	return check, err
+}
+
+type LinkHealthStatus struct {
+	Broken          bool
+	HealthFailures  int
+	HealthCheckedAt sql.NullTime
+}
+
+// RecordLinkHealthCheck stores a check and updates the link's failure
+// streak in the same statement. A healthy check resets the streak; the link
+// is broken while the streak is at least brokenAfter.
+func (q *Queries) RecordLinkHealthCheck(ctx context.Context, linkID int64, checkedAt time.Time, statusCode, latencyMs int, redirectChain []string, checkError string, healthy bool, brokenAfter int) (LinkHealthStatus, error) {
+	var status LinkHealthStatus
+	err := q.db.QueryRowContext(ctx,
+		`WITH check_row AS (
+			INSERT INTO link_health (link_id, checked_at, status_code, latency_ms, redirect_chain, error)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING link_id, checked_at
+		)
+		UPDATE links SET
+			health_failures = CASE WHEN $7 THEN 0 ELSE links.health_failures + 1 END,
+			broken = CASE WHEN $7 THEN false ELSE links.health_failures + 1 >= $8 END,
+			health_checked_at = check_row.checked_at
+		FROM check_row WHERE links.id = check_row.link_id
+		RETURNING links.broken, links.health_failures, links.health_checked_at`,
+		linkID, checkedAt, statusCode, latencyMs, pq.Array(redirectChain), checkError, healthy, brokenAfter).
+		Scan(&status.Broken, &status.HealthFailures, &status.HealthCheckedAt)
+	return status, err
+}
+
+func (q *Queries) GetLinkHealthChecks(ctx context.Context, linkID int64, limit int) ([]LinkHealthCheck, error) {
+	rows, err := q.db.QueryContext(ctx,
+		"SELECT "+LinkHealthCheckColumns+" FROM link_health WHERE link_id = $1 ORDER BY checked_at DESC, id DESC LIMIT $2",
+		linkID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var checks []LinkHealthCheck
+	for rows.Next() {
+		check, err := ScanLinkHealthCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
+
+func (q *Queries) PruneLinkHealthChecks(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, "DELETE FROM link_health WHERE checked_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetLinksDueForHealthCheck returns active links never checked or last
+// checked before checkedBefore, least recently checked first.
+func (q *Queries) GetLinksDueForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]Link, error) {
+	rows, err := q.db.QueryContext(ctx,
+		`SELECT `+LinkColumns+` FROM links
+		WHERE deleted_at IS NULL AND status = 'active' AND (health_checked_at IS NULL OR health_checked_at < $1)
+		ORDER BY health_checked_at NULLS FIRST, id LIMIT $2`,
+		checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var links []Link
+	for rows.Next() {
+		link, err := ScanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,45 @@
+package sqlc
+
+import (
+	"context"
+)
+
+// TakeRateLimitToken spends a token from the bucket at key, creating it full
+// when missing. The bucket refills at rate tokens per second up to
+// capacity. It returns sql.ErrNoRows when there is no token to spend, and
+// leaves the bucket untouched then.
+func (q *Queries) TakeRateLimitToken(ctx context.Context, key string, capacity, rate float64) (float64, error) {
+	var tokens float64
+	err := q.db.QueryRowContext(ctx,
+		`INSERT INTO rate_limits AS b (key, tokens, updated_at)
+		VALUES ($1, $2::double precision - 1, clock_timestamp())
+		ON CONFLICT (key) DO UPDATE
+		SET tokens = LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at)::double precision * $3::double precision) - 1,
+			updated_at = clock_timestamp()
+		WHERE LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at)::double precision * $3::double precision) >= 1
+		RETURNING tokens`,
+		key, capacity, rate).Scan(&tokens)
+	return tokens, err
+}
+
+// GetRateLimitTokens returns how many tokens the bucket at key holds now.
+func (q *Queries) GetRateLimitTokens(ctx context.Context, key string, capacity, rate float64) (float64, error) {
+	var tokens float64
+	err := q.db.QueryRowContext(ctx,
+		`SELECT LEAST($2::double precision, tokens + EXTRACT(EPOCH FROM clock_timestamp() - updated_at)::double precision * $3::double precision)
+		FROM rate_limits
+		WHERE key = $1`,
+		key, capacity, rate).Scan(&tokens)
+	return tokens, err
+}
+
+// PruneRateLimits deletes buckets untouched for longer than idleSeconds.
+func (q *Queries) PruneRateLimits(ctx context.Context, idleSeconds float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx,
+		"DELETE FROM rate_limits WHERE updated_at < clock_timestamp() - make_interval(secs => $1)",
+		idleSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,148 @@
+package link
+
+import (
+	"context"
+	"fmt"
+
+	"app/internal/domain/link"
+)
+
+// WithAbuseThreshold disables a link once n different people have reported
+// it, unless the link sets its own threshold. Zero leaves every report to
+// the moderators.
+func WithAbuseThreshold(n int) Option {
+	return func(s *Service) {
+		s.abuseThreshold = n
+	}
+}
+
+// ReportLink files an abuse report against the link behind shortName. When
+// the report brings the link to its threshold the link is disabled in the
+// same transaction; the returned link shows its resulting state. Reporters
+// are told apart by their address, so the threshold only counts when the
+// anonymizer can key them.
+func (s *Service) ReportLink(ctx context.Context, shortName string, reason link.AbuseReason, details, email, ip string) (*link.AbuseReport, *link.Link, error) {
+	key := ip
+	if s.anonymizer != nil {
+		key = s.anonymizer.ReporterKey(ip)
+		ip = s.anonymizer.Anonymize(ip)
+	}
+
+	var (
+		report     *link.AbuseReport
+		linkEntity *link.Link
+	)
+	err := s.repo.InTx(ctx, func(repo link.Repository) error {
+		l, err := repo.GetByShortName(ctx, shortName)
+		if err != nil {
+			return err
+		}
+		report, err = link.NewAbuseReport(l.ID, reason, details, email, ip)
+		if err != nil {
+			return err
+		}
+		report.ReporterKey = key
+		if err := repo.CreateAbuseReport(ctx, report); err != nil {
+			return err
+		}
+
+		linkEntity = l
+		threshold := s.abuseThresholdFor(l)
+		if threshold == 0 || key == "" || !l.IsActive() {
+			return nil
+		}
+		reporters, err := repo.CountAbuseReporters(ctx, l.ID)
+		if err != nil {
+			return err
+		}
+		if reporters < threshold {
+			return nil
+		}
+		linkEntity, err = repo.SetStatus(ctx, l.ID, link.StatusDisabled, link.CauseAbuse,
+			fmt.Sprintf("abuse: reported by %d people", reporters))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return report, linkEntity, nil
+}
+
+func (s *Service) abuseThresholdFor(l *link.Link) int {
+	if l.AbuseThreshold > 0 {
+		return l.AbuseThreshold
+	}
+	return s.abuseThreshold
+}
+
+func (s *Service) GetAbuseReport(ctx context.Context, id int64) (*link.AbuseReport, error) {
+	return s.repo.GetAbuseReport(ctx, id)
+}
+
+// GetAbuseReports returns one page of the moderation queue and the number
+// of matching reports.
+func (s *Service) GetAbuseReports(ctx context.Context, filter link.AbuseReportFilter, offset, limit int) ([]*link.AbuseReport, int, error) {
+	reports, err := s.repo.GetAbuseReports(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.CountAbuseReports(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reports, total, nil
+}
+
+// DismissAbuseReport closes a report without touching the link.
+func (s *Service) DismissAbuseReport(ctx context.Context, id int64, actor string) (*link.AbuseReport, error) {
+	var report *link.AbuseReport
+	err := s.repo.InTx(ctx, func(repo link.Repository) error {
+		var err error
+		report, err = repo.ResolveAbuseReport(ctx, id, link.AbuseReportDismissed)
+		if err != nil {
+			return err
+		}
+		return repo.RecordAudit(ctx, link.NewAuditEntry(link.AuditAbuseDismissed, actor, report, 1))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// DisableReportedLink acts on a report by disabling its link. Every open
+// report against the link is closed with it.
+func (s *Service) DisableReportedLink(ctx context.Context, id int64, actor string) (*link.AbuseReport, *link.Link, error) {
+	var (
+		report     *link.AbuseReport
+		linkEntity *link.Link
+	)
+	err := s.repo.InTx(ctx, func(repo link.Repository) error {
+		var err error
+		report, err = repo.GetAbuseReport(ctx, id)
+		if err != nil {
+			return err
+		}
+		if report.Status != link.AbuseReportOpen {
+			return link.ErrAbuseReportResolved
+		}
+		linkEntity, err = repo.SetStatus(ctx, report.LinkID, link.StatusDisabled, link.CauseAbuse,
+			fmt.Sprintf("abuse: %s", report.Reason))
+		if err != nil {
+			return err
+		}
+		resolved, err := repo.ResolveLinkAbuseReports(ctx, report.LinkID, link.AbuseReportActioned)
+		if err != nil {
+			return err
+		}
+		report, err = repo.GetAbuseReport(ctx, id)
+		if err != nil {
+			return err
+		}
+		return repo.RecordAudit(ctx, link.NewAuditEntry(link.AuditAbuseDisabled, actor, report, resolved))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return report, linkEntity, nil
+}
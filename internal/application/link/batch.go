@@ -0,0 +1,99 @@
+package link
+
+import (
+	"context"
+	"errors"
+
+	"app/internal/domain/link"
+)
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+)
+
+var (
+	ErrUnknownBatchOp = errors.New("unknown batch operation")
+	ErrBatchAborted   = errors.New("not applied because another operation in the batch failed")
+)
+
+// BatchOperation is a single create, update or delete inside a batch.
+// Update follows UpdateLink semantics: empty fields keep their value and a
+// zero Version skips the concurrency check.
+type BatchOperation struct {
+	Op          BatchOp
+	ID          int64
+	Version     int
+	OriginalURL string
+	ShortName   string
+	Tags        []string
+	Preview     link.Preview
+}
+
+// BatchResult holds the outcome of the operation at the same index. Link is
+// nil for deletes and failed operations.
+type BatchResult struct {
+	Link *link.Link
+	Err  error
+}
+
+// ApplyBatch runs every operation and reports each outcome. In atomic mode
+// the operations share one transaction: the first failure rolls everything
+// back and the remaining results carry ErrBatchAborted.
+func (s *Service) ApplyBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+
+	if !atomic {
+		for i, op := range ops {
+			results[i] = s.applyBatchOperation(ctx, op)
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := s.inTx(ctx, func(tx *Service) error {
+		for i, op := range ops {
+			results[i] = tx.applyBatchOperation(ctx, op)
+			if results[i].Err != nil {
+				failed = i
+				return ErrBatchAborted
+			}
+		}
+		return nil
+	})
+	if err != nil && failed < 0 {
+		return nil, err
+	}
+
+	if failed >= 0 {
+		for i := range results {
+			if i != failed {
+				results[i] = BatchResult{Err: ErrBatchAborted}
+			}
+		}
+	}
+	return results, nil
+}
+
+func (s *Service) applyBatchOperation(ctx context.Context, op BatchOperation) BatchResult {
+	var (
+		linkEntity *link.Link
+		err        error
+	)
+
+	switch op.Op {
+	case BatchCreate:
+		linkEntity, err = s.CreateLink(ctx, op.OriginalURL, op.ShortName, op.Tags, op.Preview)
+	case BatchUpdate:
+		linkEntity, err = s.UpdateLink(ctx, op.ID, op.Version, op.OriginalURL, op.ShortName, op.Tags, op.Preview)
+	case BatchDelete:
+		err = s.DeleteLink(ctx, op.ID)
+	default:
+		err = ErrUnknownBatchOp
+	}
+
+	return BatchResult{Link: linkEntity, Err: err}
+}
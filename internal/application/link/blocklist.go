@@ -0,0 +1,46 @@
+package link
+
+import (
+	"context"
+	"fmt"
+
+	"app/internal/domain/link"
+)
+
+// Blocklist tells whether a URL is a known phishing or malware
+// destination, and which list says so.
+type Blocklist interface {
+	Match(rawURL string) (source string, ok bool)
+}
+
+// WithBlocklist refuses new destinations found on blocklist and disables
+// existing links whose destination turns up on it later.
+func WithBlocklist(blocklist Blocklist) Option {
+	return func(s *Service) {
+		s.blocklist = blocklist
+	}
+}
+
+func (s *Service) checkBlocklist(rawURL string) error {
+	if s.blocklist == nil {
+		return nil
+	}
+	if source, ok := s.blocklist.Match(rawURL); ok {
+		return fmt.Errorf("%w (%s)", link.ErrBlockedDestination, source)
+	}
+	return nil
+}
+
+// EnforceBlocklist disables l when its destination is on the blocklist and
+// returns the link as it now stands. It is meant for the redirect path,
+// where lists may have learned about a destination since it was created.
+func (s *Service) EnforceBlocklist(ctx context.Context, l *link.Link) (*link.Link, error) {
+	if s.blocklist == nil || !l.IsActive() {
+		return l, nil
+	}
+	source, ok := s.blocklist.Match(l.OriginalURL)
+	if !ok {
+		return l, nil
+	}
+	return s.repo.SetStatus(ctx, l.ID, link.StatusDisabled, link.CauseBlocklist, "blocklist: "+source)
+}
@@ -0,0 +1,108 @@
+package link
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"app/internal/domain/link"
+)
+
+// healthCheckConcurrency caps how many destinations are requested at once.
+const healthCheckConcurrency = 8
+
+// HealthChecksShown is how many recent checks GetLinkHealth returns.
+const HealthChecksShown = 20
+
+// HealthChecker requests a destination and reports how it answered.
+type HealthChecker interface {
+	Check(ctx context.Context, rawURL string) *link.HealthCheck
+}
+
+// WithHealthChecker enables destination health checks. A link is marked
+// broken after brokenAfter failed checks in a row.
+func WithHealthChecker(checker HealthChecker, brokenAfter int) Option {
+	return func(s *Service) {
+		if brokenAfter <= 0 {
+			brokenAfter = link.DefaultBrokenAfter
+		}
+		s.healthChecker = checker
+		s.brokenAfter = brokenAfter
+	}
+}
+
+// HealthReport lists what a round of health checks found. Broken and
+// Recovered only hold links whose standing changed in this round.
+type HealthReport struct {
+	Checked   int
+	Broken    []*link.Link
+	Recovered []*link.Link
+}
+
+// CheckLinksHealth checks up to limit active links that have not been
+// checked for interval. Destinations are requested concurrently; results
+// are stored one at a time.
+func (s *Service) CheckLinksHealth(ctx context.Context, interval time.Duration, limit int) (HealthReport, error) {
+	var report HealthReport
+	if s.healthChecker == nil {
+		return report, nil
+	}
+
+	links, err := s.repo.GetLinksDueForHealthCheck(ctx, time.Now().Add(-interval), limit)
+	if err != nil {
+		return report, err
+	}
+
+	checks := make([]*link.HealthCheck, len(links))
+	sem := make(chan struct{}, healthCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, l := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			checks[i] = s.healthChecker.Check(ctx, l.OriginalURL)
+		}()
+	}
+	wg.Wait()
+
+	for i, l := range links {
+		check := checks[i]
+		check.LinkID = l.ID
+		wasBroken := l.Health.Broken
+		status, err := s.repo.RecordHealthCheck(ctx, check, s.brokenAfter)
+		if err != nil {
+			return report, err
+		}
+		report.Checked++
+		l.Health = status
+
+		switch {
+		case status.Broken && !wasBroken:
+			report.Broken = append(report.Broken, l)
+		case !status.Broken && wasBroken:
+			report.Recovered = append(report.Recovered, l)
+		}
+	}
+	return report, nil
+}
+
+// GetLinkHealth returns a link's health status and its latest checks.
+func (s *Service) GetLinkHealth(ctx context.Context, id int64) (*link.Health, error) {
+	l, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := s.repo.GetHealthChecks(ctx, id, HealthChecksShown)
+	if err != nil {
+		return nil, err
+	}
+	return &link.Health{LinkID: id, HealthStatus: l.Health, Checks: checks}, nil
+}
+
+// PruneHealthChecks deletes checks older than retention. Link health
+// statuses are kept.
+func (s *Service) PruneHealthChecks(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PruneHealthChecks(ctx, time.Now().Add(-retention))
+}
@@ -0,0 +1,176 @@
+package link
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"app/internal/domain/link"
+)
+
+// importJobTTL is how long finished import jobs stay queryable.
+const importJobTTL = 24 * time.Hour
+
+type ImportStatus string
+
+const (
+	ImportPending   ImportStatus = "pending"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+)
+
+type ImportRowError struct {
+	Line   int
+	Errors map[string]string
+}
+
+// ImportJob tracks a background import. In dry-run mode rows are validated
+// but nothing is stored.
+type ImportJob struct {
+	ID         string
+	Status     ImportStatus
+	DryRun     bool
+	Total      int
+	Processed  int
+	Imported   int
+	Failed     int
+	Errors     []ImportRowError
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// importStore keeps import jobs in memory only. Jobs are lost when the
+// process restarts, including the remaining rows of running jobs, and each
+// instance only knows the jobs it started.
+type importStore struct {
+	mu   sync.Mutex
+	jobs map[string]*ImportJob
+}
+
+func newImportStore() *importStore {
+	return &importStore{jobs: make(map[string]*ImportJob)}
+}
+
+// StartImport queues rows for import and returns immediately. The job keeps
+// running after ctx is cancelled; poll GetImport for its progress.
+func (s *Service) StartImport(ctx context.Context, rows []link.ImportRow, dryRun bool) (*ImportJob, error) {
+	id, err := newImportID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &ImportJob{
+		ID:        id,
+		Status:    ImportPending,
+		DryRun:    dryRun,
+		Total:     len(rows),
+		CreatedAt: time.Now(),
+	}
+
+	s.imports.mu.Lock()
+	s.imports.pruneLocked(job.CreatedAt)
+	s.imports.jobs[id] = job
+	snapshot := job.snapshot()
+	s.imports.mu.Unlock()
+
+	go s.runImport(context.WithoutCancel(ctx), job, rows)
+
+	return snapshot, nil
+}
+
+func (s *Service) GetImport(id string) (*ImportJob, bool) {
+	s.imports.mu.Lock()
+	defer s.imports.mu.Unlock()
+
+	job, ok := s.imports.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return job.snapshot(), true
+}
+
+func (s *Service) runImport(ctx context.Context, job *ImportJob, rows []link.ImportRow) {
+	s.updateImport(job, func(j *ImportJob) { j.Status = ImportRunning })
+
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		err := s.importRow(ctx, row, job.DryRun, seen)
+		s.updateImport(job, func(j *ImportJob) {
+			j.Processed++
+			if err != nil {
+				j.Failed++
+				j.Errors = append(j.Errors, ImportRowError{Line: row.Line, Errors: importErrorFields(err)})
+				return
+			}
+			j.Imported++
+		})
+	}
+
+	s.updateImport(job, func(j *ImportJob) {
+		now := time.Now()
+		j.Status = ImportCompleted
+		j.FinishedAt = &now
+	})
+}
+
+func (s *Service) importRow(ctx context.Context, row link.ImportRow, dryRun bool, seen map[string]bool) error {
+	if row.Err != nil {
+		return row.Err
+	}
+	if row.ShortName != "" && seen[row.ShortName] {
+		return link.ErrShortNameExists
+	}
+
+	var (
+		linkEntity *link.Link
+		err        error
+	)
+	if dryRun {
+		linkEntity, err = s.prepareLink(ctx, row.OriginalURL, row.ShortName, row.Tags, link.Preview{})
+	} else {
+		linkEntity, err = s.CreateLink(ctx, row.OriginalURL, row.ShortName, row.Tags, link.Preview{})
+	}
+	if err != nil {
+		return err
+	}
+
+	seen[linkEntity.ShortName] = true
+	return nil
+}
+
+func (s *Service) updateImport(job *ImportJob, update func(j *ImportJob)) {
+	s.imports.mu.Lock()
+	defer s.imports.mu.Unlock()
+	update(job)
+}
+
+func (st *importStore) pruneLocked(now time.Time) {
+	for id, job := range st.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > importJobTTL {
+			delete(st.jobs, id)
+		}
+	}
+}
+
+func (j *ImportJob) snapshot() *ImportJob {
+	c := *j
+	c.Errors = append([]ImportRowError(nil), j.Errors...)
+	return &c
+}
+
+func importErrorFields(err error) map[string]string {
+	if field := link.ErrorField(err); field != "" {
+		return map[string]string{field: err.Error()}
+	}
+	return map[string]string{"row": err.Error()}
+}
+
+func newImportID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
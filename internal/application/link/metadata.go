@@ -0,0 +1,106 @@
+package link
+
+import (
+	"context"
+	"fmt"
+
+	"app/internal/domain/link"
+)
+
+// MetadataFetcher reads the title, description and favicon of a page.
+type MetadataFetcher interface {
+	Fetch(ctx context.Context, rawURL string) (link.Metadata, error)
+}
+
+type metadataJob struct {
+	id  int64
+	url string
+}
+
+// WithMetadataFetcher makes the service fetch destination metadata in the
+// background whenever a link is created or pointed elsewhere. Up to
+// queueSize links wait for RunMetadataFetcher; links beyond that are picked
+// up later by QueueMissingMetadata.
+func WithMetadataFetcher(fetcher MetadataFetcher, queueSize int) Option {
+	return func(s *Service) {
+		s.fetcher = fetcher
+		s.metadataJobs = make(chan metadataJob, queueSize)
+	}
+}
+
+// queueMetadata schedules a metadata fetch for l without ever blocking the
+// caller.
+func (s *Service) queueMetadata(l *link.Link) bool {
+	if s.metadataJobs == nil {
+		return false
+	}
+	if s.pendingMetadata != nil {
+		*s.pendingMetadata = append(*s.pendingMetadata, l)
+		return true
+	}
+	select {
+	case s.metadataJobs <- metadataJob{id: l.ID, url: l.OriginalURL}:
+		return true
+	default:
+		return false
+	}
+}
+
+// QueueMissingMetadata queues links whose metadata was never fetched, such
+// as links created before fetching was enabled or while the queue was full,
+// and returns how many were queued.
+func (s *Service) QueueMissingMetadata(ctx context.Context) (int, error) {
+	if s.metadataJobs == nil {
+		return 0, nil
+	}
+	free := cap(s.metadataJobs) - len(s.metadataJobs)
+	if free <= 0 {
+		return 0, nil
+	}
+
+	links, err := s.repo.GetLinksWithoutMetadata(ctx, free)
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	for _, l := range links {
+		if !s.queueMetadata(l) {
+			break
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// RunMetadataFetcher fetches queued links one at a time until ctx is
+// cancelled, passing failures to onError. A failed fetch is stored as empty
+// metadata so that it is not retried.
+func (s *Service) RunMetadataFetcher(ctx context.Context, onError func(error)) {
+	if s.metadataJobs == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.metadataJobs:
+			if err := s.fetchMetadata(ctx, job); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (s *Service) fetchMetadata(ctx context.Context, job metadataJob) error {
+	metadata, fetchErr := s.fetcher.Fetch(ctx, job.url)
+	if fetchErr != nil {
+		metadata = link.NewMetadata("", "", "")
+	}
+	if err := s.repo.SetMetadata(ctx, job.id, job.url, metadata); err != nil {
+		return fmt.Errorf("link %d: store metadata: %w", job.id, err)
+	}
+	if fetchErr != nil {
+		return fmt.Errorf("link %d: fetch metadata from %s: %w", job.id, job.url, fetchErr)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package link
+
+import (
+	"context"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"app/internal/domain/link"
+	"app/internal/shared/netguard"
+)
+
+// Resolver looks up the addresses of a host name. *net.Resolver satisfies
+// it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// WithDestinationPolicy restricts where links may point. When resolver is
+// set, destinations whose host is or resolves to a non-public address, or
+// does not resolve at all, are refused as well. The host of the base URL always counts as one of the
+// policy's own domains.
+func WithDestinationPolicy(policy link.DestinationPolicy, resolver Resolver) Option {
+	return func(s *Service) {
+		s.policy = policy
+		s.resolver = resolver
+	}
+}
+
+// ownDomains adds the host of baseURL to the policy's own domains.
+func ownDomains(policy link.DestinationPolicy, baseURL string) []string {
+	domains := append([]string(nil), policy.OwnDomains...)
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		domains = append(domains, u.Hostname())
+	}
+	return domains
+}
+
+// checkDestination applies the destination policy and the blocklist to
+// rawURL. With a resolver, hosts that do not resolve are refused too: an
+// address checked only when the link is followed could by then point
+// anywhere.
+func (s *Service) checkDestination(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return link.ErrInvalidURL
+	}
+	if err := s.policy.Check(u); err != nil {
+		return err
+	}
+	if err := s.checkBlocklist(rawURL); err != nil {
+		return err
+	}
+	if s.resolver == nil || u.Hostname() == "" {
+		return nil
+	}
+
+	host := u.Hostname()
+	addr, ok, err := netguard.HostAddr(host)
+	if err != nil {
+		return link.ErrInvalidURL
+	}
+	if ok {
+		if !netguard.IsPublic(addr) {
+			return link.ErrPrivateDestination
+		}
+		return nil
+	}
+	if strings.EqualFold(strings.TrimSuffix(host, "."), "localhost") {
+		return link.ErrPrivateDestination
+	}
+
+	addrs, err := s.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return link.ErrUnresolvableDestination
+	}
+	for _, addr := range addrs {
+		if !netguard.IsPublic(addr) {
+			return link.ErrPrivateDestination
+		}
+	}
+	return nil
+}
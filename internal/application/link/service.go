@@ -2,29 +2,119 @@ package link
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"net/netip"
+	"time"
 
 	"app/internal/domain/link"
+	"app/internal/shared/ipprivacy"
 )
 
 type Service struct {
-	repo    link.Repository
-	baseURL string
+	repo       link.Repository
+	baseURL    string
+	imports    *importStore
+	anonymizer *ipprivacy.Anonymizer
+
+	fetcher      MetadataFetcher
+	metadataJobs chan metadataJob
+	// pendingMetadata collects the links to fetch metadata for until the
+	// transaction the service is bound to commits.
+	pendingMetadata *[]*link.Link
+
+	healthChecker HealthChecker
+	brokenAfter   int
+
+	policy    link.DestinationPolicy
+	resolver  Resolver
+	blocklist Blocklist
+
+	abuseThreshold int
 }
 
-func NewService(repo link.Repository, baseURL string) *Service {
-	return &Service{
+type Option func(*Service)
+
+// WithIPAnonymizer makes the service store visitor IPs the way a says
+// instead of verbatim.
+func WithIPAnonymizer(a *ipprivacy.Anonymizer) Option {
+	return func(s *Service) {
+		s.anonymizer = a
+	}
+}
+
+func NewService(repo link.Repository, baseURL string, opts ...Option) *Service {
+	s := &Service{
 		repo:    repo,
 		baseURL: baseURL,
+		imports: newImportStore(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.policy.OwnDomains = ownDomains(s.policy, baseURL)
+	return s
+}
+
+// withRepository returns a copy of the service backed by repo, typically a
+// transaction-bound repository handed out by Repository.InTx.
+func (s *Service) withRepository(repo link.Repository) *Service {
+	clone := *s
+	clone.repo = repo
+	return &clone
+}
+
+// inTx runs fn with a service bound to a transaction. Metadata fetches that
+// fn asks for are queued once the transaction commits, so links that were
+// rolled back are never fetched.
+func (s *Service) inTx(ctx context.Context, fn func(tx *Service) error) error {
+	var pending []*link.Link
+	err := s.repo.InTx(ctx, func(repo link.Repository) error {
+		tx := s.withRepository(repo)
+		tx.pendingMetadata = &pending
+		return fn(tx)
+	})
+	if err != nil {
+		return err
+	}
+	for _, l := range pending {
+		s.queueMetadata(l)
+	}
+	return nil
+}
+
+func (s *Service) CreateLink(ctx context.Context, originalURL, shortName string, tags []string, preview link.Preview) (*link.Link, error) {
+	linkEntity, err := s.prepareLink(ctx, originalURL, shortName, tags, preview)
+	if err != nil {
+		return nil, err
 	}
+
+	if err := s.repo.Create(ctx, linkEntity); err != nil {
+		return nil, err
+	}
+	s.queueMetadata(linkEntity)
+
+	return linkEntity, nil
 }
 
-func (s *Service) CreateLink(ctx context.Context, originalURL, shortName string) (*link.Link, error) {
+// prepareLink builds and validates a new link without storing it.
+func (s *Service) prepareLink(ctx context.Context, originalURL, shortName string, tags []string, preview link.Preview) (*link.Link, error) {
 	linkEntity, err := link.NewLink(originalURL, shortName)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkDestination(ctx, linkEntity.OriginalURL); err != nil {
+		return nil, err
+	}
+
+	if err := preview.Validate(); err != nil {
+		return nil, err
+	}
+	linkEntity.Preview = preview
+
+	linkEntity.Tags, err = link.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
 
 	exists, err := s.repo.ExistsByShortName(ctx, linkEntity.ShortName)
 	if err != nil {
@@ -34,10 +124,6 @@ func (s *Service) CreateLink(ctx context.Context, originalURL, shortName string)
 		return nil, link.ErrShortNameExists
 	}
 
-	if err := s.repo.Create(ctx, linkEntity); err != nil {
-		return nil, err
-	}
-
 	return linkEntity, nil
 }
 
@@ -49,66 +135,302 @@ func (s *Service) GetLinkByShortName(ctx context.Context, shortName string) (*li
 	return s.repo.GetByShortName(ctx, shortName)
 }
 
-func (s *Service) GetAllLinks(ctx context.Context, offset, limit int) ([]*link.Link, int, error) {
-	return s.repo.GetAll(ctx, offset, limit)
+// GetAllLinks returns one offset page of links. The total is -1 when count
+// is link.CountNone.
+func (s *Service) GetAllLinks(ctx context.Context, filter link.LinkFilter, sort link.Sort, offset, limit int, count link.CountMode) ([]*link.Link, int, error) {
+	links, err := s.repo.GetAll(ctx, filter, sort, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.CountLinks(ctx, filter, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	return links, total, nil
 }
 
-func (s *Service) UpdateLink(ctx context.Context, id int64, originalURL, shortName string) (*link.Link, error) {
-	_, err := s.repo.GetByID(ctx, id)
+// GetLinksPage returns one keyset page of links, newest first, along with
+// the cursors of the neighbouring pages (nil at either end).
+func (s *Service) GetLinksPage(ctx context.Context, filter link.LinkFilter, page link.KeysetPage) ([]*link.Link, *link.Cursor, *link.Cursor, error) {
+	rows, err := s.repo.GetLinksPage(ctx, filter, page)
 	if err != nil {
-		return nil, errors.New("link not found")
+		return nil, nil, nil, err
 	}
+	links, next, prev := link.KeysetWindow(rows, page, func(l *link.Link) link.Cursor {
+		return link.Cursor{CreatedAt: l.CreatedAt, ID: l.ID}
+	})
+	return links, next, prev, nil
+}
 
-	if originalURL == "" {
-		existing, err := s.repo.GetByID(ctx, id)
-		if err != nil {
-			return nil, errors.New("link not found")
-		}
-		originalURL = existing.OriginalURL
+func (s *Service) CountLinks(ctx context.Context, filter link.LinkFilter, count link.CountMode) (int, error) {
+	return s.repo.CountLinks(ctx, filter, count)
+}
+
+// UpdateLink replaces the link's fields provided it is still at
+// expectedVersion. Empty strings, including empty preview fields, and nil
+// tags keep the current value and an expectedVersion of 0 skips the check.
+func (s *Service) UpdateLink(ctx context.Context, id int64, expectedVersion int, originalURL, shortName string, tags []string, preview link.Preview) (*link.Link, error) {
+	var patch link.Patch
+	if originalURL != "" {
+		patch.OriginalURL = &originalURL
+	}
+	if shortName != "" {
+		patch.ShortName = &shortName
 	}
+	if tags != nil {
+		patch.Tags = &tags
+	}
+	if preview.Title != "" {
+		patch.PreviewTitle = &preview.Title
+	}
+	if preview.Description != "" {
+		patch.PreviewDescription = &preview.Description
+	}
+	if preview.Image != "" {
+		patch.PreviewImage = &preview.Image
+	}
+	return s.PatchLink(ctx, id, expectedVersion, patch)
+}
 
-	if shortName == "" {
-		existing, err := s.repo.GetByID(ctx, id)
-		if err != nil {
-			return nil, errors.New("link not found")
-		}
-		shortName = existing.ShortName
+// PatchLink applies a partial update to the link under the same version
+// rules as UpdateLink.
+func (s *Service) PatchLink(ctx context.Context, id int64, expectedVersion int, patch link.Patch) (*link.Link, error) {
+	current, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && expectedVersion != current.Version {
+		return nil, link.ErrVersionConflict
 	}
 
-	linkEntity, err := link.NewLink(originalURL, shortName)
+	updated := *current
+	patch.Apply(&updated)
+	if err := updated.Validate(); err != nil {
+		return nil, err
+	}
+	// Links created before the policy tightened keep working until their
+	// URL is changed.
+	if updated.OriginalURL != current.OriginalURL {
+		if err := s.checkDestination(ctx, updated.OriginalURL); err != nil {
+			return nil, err
+		}
+	}
+	updated.Tags, err = link.NormalizeTags(updated.Tags)
 	if err != nil {
 		return nil, err
 	}
-	linkEntity.ID = id
 
-	if err := s.repo.Update(ctx, linkEntity); err != nil {
+	if err := s.repo.Update(ctx, &updated); err != nil {
 		return nil, err
 	}
+	if updated.OriginalURL != current.OriginalURL {
+		s.queueMetadata(&updated)
+	}
 
-	return linkEntity, nil
+	return &updated, nil
 }
 
 func (s *Service) DeleteLink(ctx context.Context, id int64) error {
 	_, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return errors.New("link not found")
+		return link.ErrLinkNotFound
 	}
 	return s.repo.Delete(ctx, id)
 }
 
+// SetLinkStatus takes a link in or out of service without deleting it. A
+// status set by hand replaces whatever cause the previous one had.
+func (s *Service) SetLinkStatus(ctx context.Context, id int64, status link.Status, reason string) (*link.Link, error) {
+	if status == link.StatusActive {
+		reason = ""
+	}
+	return s.repo.SetStatus(ctx, id, status, link.CauseManual, reason)
+}
+
+func (s *Service) RestoreLink(ctx context.Context, id int64) (*link.Link, error) {
+	return s.repo.Restore(ctx, id)
+}
+
+// PurgeDeletedLinks permanently removes links that have been in the trash
+// for longer than retention, together with their visits.
+func (s *Service) PurgeDeletedLinks(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PurgeDeleted(ctx, time.Now().Add(-retention))
+}
+
 func (s *Service) GetShortURL(linkEntity *link.Link) string {
 	return fmt.Sprintf("%s/r/%s", s.baseURL, linkEntity.ShortName)
 }
 
-func (s *Service) RecordVisit(ctx context.Context, linkID int64, ip, userAgent, referer string, status int) error {
-	visit := link.NewLinkVisit(linkID, ip, userAgent, referer, status)
+func (s *Service) RecordVisit(ctx context.Context, linkID int64, ip, userAgent, referer string, status int, class link.VisitClass) error {
+	if s.anonymizer != nil {
+		ip = s.anonymizer.Anonymize(ip)
+	}
+	visit := link.NewLinkVisit(linkID, ip, userAgent, referer, status, class)
 	return s.repo.CreateVisit(ctx, visit)
 }
 
-func (s *Service) GetVisits(ctx context.Context, offset, limit int) ([]*link.LinkVisit, int, error) {
-	return s.repo.GetVisits(ctx, offset, limit)
+func (s *Service) GetVisits(ctx context.Context, filter link.VisitFilter, offset, limit int, count link.CountMode) ([]*link.LinkVisit, int, error) {
+	filter = s.ResolveVisitFilter(filter)
+	visits, err := s.repo.GetVisits(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.CountVisits(ctx, filter, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	return visits, total, nil
+}
+
+func (s *Service) GetVisitsPage(ctx context.Context, filter link.VisitFilter, page link.KeysetPage) ([]*link.LinkVisit, *link.Cursor, *link.Cursor, error) {
+	filter = s.ResolveVisitFilter(filter)
+	rows, err := s.repo.GetVisitsPage(ctx, filter, page)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	visits, next, prev := link.KeysetWindow(rows, page, func(v *link.LinkVisit) link.Cursor {
+		return link.Cursor{CreatedAt: v.CreatedAt, ID: v.ID}
+	})
+	return visits, next, prev, nil
+}
+
+func (s *Service) CountVisits(ctx context.Context, filter link.VisitFilter, count link.CountMode) (int, error) {
+	filter = s.ResolveVisitFilter(filter)
+	return s.repo.CountVisits(ctx, filter, count)
+}
+
+func (s *Service) ExportLinks(ctx context.Context, filter link.LinkFilter, fn func(*link.Link) error) error {
+	return s.repo.ExportLinks(ctx, filter, fn)
+}
+
+func (s *Service) ExportVisits(ctx context.Context, filter link.VisitFilter, fn func(*link.LinkVisit) error) error {
+	filter = s.ResolveVisitFilter(filter)
+	return s.repo.ExportVisits(ctx, filter, fn)
+}
+
+// ReconcileClickCounts repairs click counters that drifted from the visits,
+// for example after visits were erased.
+func (s *Service) ReconcileClickCounts(ctx context.Context) (int64, error) {
+	return s.repo.ReconcileClickCounts(ctx)
+}
+
+// GetLinkStats summarises a link's visits matching filter, merging raw
+// visits with days that have already been rolled up. Only human visits count
+// unless filter asks for another class. Unique visitors come from the visitor
+// sketches unless filter narrows by more than the period.
+func (s *Service) GetLinkStats(ctx context.Context, id int64, filter link.VisitFilter) (*link.LinkStats, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	filter.LinkID = id
+	if filter.Class == "" {
+		filter.Class = link.VisitHuman
+	}
+	days, err := s.repo.GetDailyStats(ctx, s.ResolveVisitFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	var sketches []*link.VisitorSketch
+	if filter.SketchesApply() {
+		sketches, err = s.repo.GetVisitorSketches(ctx, id, filter.From, filter.To)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return link.SummarizeStats(id, days, sketches), nil
+}
+
+// RollupVisits folds visits older than retention into daily aggregates.
+func (s *Service) RollupVisits(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.RollupVisits(ctx, time.Now().Add(-retention))
+}
+
+// ResolveVisitFilter rewrites a raw IP address in filter into the values it
+// was stored as under the privacy mode, so lookups by address keep working.
+// Stored values, such as hashes, are matched verbatim.
+func (s *Service) ResolveVisitFilter(filter link.VisitFilter) link.VisitFilter {
+	if s.anonymizer == nil || filter.IP == "" {
+		return filter
+	}
+	if _, err := netip.ParseAddr(filter.IP); err != nil {
+		return filter
+	}
+
+	candidates := s.anonymizer.Candidates(filter.IP, filter.From, filter.To)
+	if len(candidates) == 0 {
+		return filter
+	}
+	filter.IPs = append(filter.IPs, candidates...)
+	filter.IP = ""
+	return filter
 }
 
 func (s *Service) DeleteVisit(ctx context.Context, id int64) error {
 	return s.repo.DeleteVisit(ctx, id)
 }
+
+// DeleteVisits erases every visit matching filter, along with what they
+// added to click counters and visitor sketches, and records the erasure in
+// the audit log in the same transaction. An empty filter is refused.
+func (s *Service) DeleteVisits(ctx context.Context, filter link.VisitFilter, actor string) (int64, error) {
+	if filter.IsEmpty() {
+		return 0, link.ErrEmptyVisitFilter
+	}
+	filter = s.ResolveVisitFilter(filter)
+
+	var deleted int64
+	err := s.repo.InTx(ctx, func(repo link.Repository) error {
+		n, err := repo.DeleteVisits(ctx, filter)
+		if err != nil {
+			return err
+		}
+		deleted = n
+		return repo.RecordAudit(ctx, link.NewAuditEntry(link.AuditVisitsDeleted, actor, s.auditCriteria(filter), n))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// ExportSubjectVisits streams every visit recorded for ip, for answering a
+// data subject access request, and audits how many were handed out.
+func (s *Service) ExportSubjectVisits(ctx context.Context, ip, actor string, fn func(*link.LinkVisit) error) (int64, error) {
+	if ip == "" {
+		return 0, link.ErrEmptyVisitFilter
+	}
+
+	filter := s.ResolveVisitFilter(link.VisitFilter{IP: ip})
+	var exported int64
+	err := s.repo.ExportVisits(ctx, filter, func(v *link.LinkVisit) error {
+		exported++
+		return fn(v)
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, s.repo.RecordAudit(ctx, link.NewAuditEntry(link.AuditVisitsSubjectExport, actor, s.auditCriteria(filter), exported))
+}
+
+// auditCriteria replaces the addresses filter looked visits up by with
+// values that are safe to keep in the audit log.
+func (s *Service) auditCriteria(filter link.VisitFilter) link.VisitFilter {
+	anonymizer := s.anonymizer
+	if anonymizer == nil {
+		anonymizer, _ = ipprivacy.New(string(ipprivacy.ModeNone), "")
+	}
+
+	if filter.IP != "" {
+		filter.IP = anonymizer.AuditSubject(filter.IP)
+	}
+	if len(filter.IPs) > 0 {
+		ips := make([]string, len(filter.IPs))
+		for i, ip := range filter.IPs {
+			ips[i] = anonymizer.AuditSubject(ip)
+		}
+		filter.IPs = ips
+	}
+	return filter
+}
@@ -0,0 +1,124 @@
+package link
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// AbuseReason is what a reporter says is wrong with a link.
+type AbuseReason string
+
+const (
+	AbusePhishing AbuseReason = "phishing"
+	AbuseMalware  AbuseReason = "malware"
+	AbuseSpam     AbuseReason = "spam"
+	AbuseIllegal  AbuseReason = "illegal"
+	AbuseOther    AbuseReason = "other"
+)
+
+// AbuseReasons lists the reasons in the order the report form offers them.
+var AbuseReasons = []AbuseReason{AbusePhishing, AbuseMalware, AbuseSpam, AbuseIllegal, AbuseOther}
+
+// AbuseReportStatus tracks a report through moderation. Open reports wait
+// for a moderator; dismissed ones were found groundless and actioned ones
+// led to the link being disabled.
+type AbuseReportStatus string
+
+const (
+	AbuseReportOpen      AbuseReportStatus = "open"
+	AbuseReportDismissed AbuseReportStatus = "dismissed"
+	AbuseReportActioned  AbuseReportStatus = "actioned"
+)
+
+const (
+	MaxAbuseDetailsLength = 2000
+	MaxReporterEmail      = 254
+)
+
+// Audited moderation actions.
+const (
+	AuditAbuseDismissed = "abuse.dismissed"
+	AuditAbuseDisabled  = "abuse.disabled"
+)
+
+var (
+	ErrInvalidAbuseReason       = errors.New("reason must be one of phishing, malware, spam, illegal or other")
+	ErrInvalidAbuseDetails      = errors.New("details must be at most 2000 characters")
+	ErrInvalidReporterEmail     = errors.New("invalid email address")
+	ErrInvalidAbuseReportStatus = errors.New("status must be open, dismissed or actioned")
+	ErrInvalidAbuseThreshold    = errors.New("abuse threshold cannot be negative")
+	ErrAbuseReportNotFound      = errors.New("abuse report not found")
+	ErrAbuseReportResolved      = errors.New("abuse report was already resolved")
+)
+
+// AbuseReport is a complaint about a link. ReporterIP is stored the way
+// visitor IPs are. ReporterKey identifies the reporter the same way every
+// day, so that one person counts once towards a link's threshold; reports
+// without a key do not count.
+type AbuseReport struct {
+	ID            int64
+	LinkID        int64
+	Reason        AbuseReason
+	Details       string
+	ReporterEmail string
+	ReporterIP    string
+	ReporterKey   string
+	Status        AbuseReportStatus
+	CreatedAt     time.Time
+	ResolvedAt    *time.Time
+}
+
+func NewAbuseReport(linkID int64, reason AbuseReason, details, email, ip string) (*AbuseReport, error) {
+	if _, err := ParseAbuseReason(string(reason)); err != nil {
+		return nil, err
+	}
+	details = strings.TrimSpace(details)
+	if utf8.RuneCountInString(details) > MaxAbuseDetailsLength {
+		return nil, ErrInvalidAbuseDetails
+	}
+	email = strings.TrimSpace(email)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email || len(email) > MaxReporterEmail {
+			return nil, ErrInvalidReporterEmail
+		}
+	}
+
+	return &AbuseReport{
+		LinkID:        linkID,
+		Reason:        reason,
+		Details:       details,
+		ReporterEmail: email,
+		ReporterIP:    ip,
+		Status:        AbuseReportOpen,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+func ParseAbuseReason(s string) (AbuseReason, error) {
+	for _, reason := range AbuseReasons {
+		if s == string(reason) {
+			return reason, nil
+		}
+	}
+	return "", ErrInvalidAbuseReason
+}
+
+func ParseAbuseReportStatus(s string) (AbuseReportStatus, error) {
+	switch status := AbuseReportStatus(s); status {
+	case AbuseReportOpen, AbuseReportDismissed, AbuseReportActioned:
+		return status, nil
+	default:
+		return "", ErrInvalidAbuseReportStatus
+	}
+}
+
+// AbuseReportFilter narrows down the moderation queue. Zero values match
+// everything.
+type AbuseReportFilter struct {
+	LinkID int64
+	Status AbuseReportStatus
+}
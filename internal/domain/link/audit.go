@@ -0,0 +1,36 @@
+package link
+
+import (
+	"errors"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditVisitsDeleted       = "visits.deleted"
+	AuditVisitsSubjectExport = "visits.subject_export"
+)
+
+// ErrEmptyVisitFilter guards bulk visit operations from matching every row.
+var ErrEmptyVisitFilter = errors.New("at least one visit criterion is required")
+
+// AuditEntry records a privacy-relevant operation: who ran it, with which
+// criteria, and how many rows it touched.
+type AuditEntry struct {
+	ID        int64
+	Action    string
+	Actor     string
+	Criteria  any
+	Affected  int64
+	CreatedAt time.Time
+}
+
+func NewAuditEntry(action, actor string, criteria any, affected int64) *AuditEntry {
+	return &AuditEntry{
+		Action:    action,
+		Actor:     actor,
+		Criteria:  criteria,
+		Affected:  affected,
+		CreatedAt: time.Now(),
+	}
+}
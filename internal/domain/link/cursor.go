@@ -0,0 +1,124 @@
+package link
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrInvalidCountMode = errors.New("invalid count mode")
+)
+
+// Cursor marks a position in a listing ordered newest first by
+// (created_at, id). Backward cursors page towards newer rows.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+	Backward  bool
+}
+
+type cursorPayload struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"i"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+// Encode renders the cursor as an opaque URL-safe token.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(cursorPayload{CreatedAt: c.CreatedAt, ID: c.ID, Backward: c.Backward})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: payload.CreatedAt, ID: payload.ID, Backward: payload.Backward}, nil
+}
+
+// KeysetPage requests Limit rows after Cursor, or the first page when Cursor
+// is nil.
+type KeysetPage struct {
+	Cursor *Cursor
+	Limit  int
+}
+
+func NewKeysetPage(token string, limit int) (KeysetPage, error) {
+	page := KeysetPage{Limit: NewPagination(0, limit).Limit}
+	if token == "" {
+		return page, nil
+	}
+
+	cursor, err := DecodeCursor(token)
+	if err != nil {
+		return page, err
+	}
+	page.Cursor = cursor
+	return page, nil
+}
+
+// KeysetWindow trims rows fetched with Limit+1 (in newest-first order) down
+// to the page and works out the cursors of the neighbouring pages.
+func KeysetWindow[T any](rows []T, page KeysetPage, key func(T) Cursor) (items []T, next, prev *Cursor) {
+	hasMore := len(rows) > page.Limit
+	backward := page.Cursor != nil && page.Cursor.Backward
+
+	if hasMore {
+		if backward {
+			rows = rows[len(rows)-page.Limit:]
+		} else {
+			rows = rows[:page.Limit]
+		}
+	}
+	if len(rows) == 0 {
+		return rows, nil, nil
+	}
+
+	first, last := key(rows[0]), key(rows[len(rows)-1])
+	first.Backward = true
+
+	if backward {
+		next = &last
+		if hasMore {
+			prev = &first
+		}
+	} else {
+		if hasMore {
+			next = &last
+		}
+		if page.Cursor != nil {
+			prev = &first
+		}
+	}
+	return rows, next, prev
+}
+
+// CountMode controls how list endpoints compute their total.
+type CountMode string
+
+const (
+	CountExact     CountMode = "exact"
+	CountEstimated CountMode = "estimated"
+	CountNone      CountMode = "none"
+)
+
+func ParseCountMode(s string, fallback CountMode) (CountMode, error) {
+	switch mode := CountMode(s); mode {
+	case "":
+		return fallback, nil
+	case CountExact, CountEstimated, CountNone:
+		return mode, nil
+	default:
+		return "", ErrInvalidCountMode
+	}
+}
@@ -8,16 +8,44 @@ import (
 )
 
 var (
-	ErrInvalidURL      = errors.New("invalid URL")
-	ErrEmptyURL        = errors.New("URL cannot be empty")
-	ErrShortNameExists = errors.New("short name already exists")
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrEmptyURL         = errors.New("URL cannot be empty")
+	ErrShortNameExists  = errors.New("short name already exists")
+	ErrLinkNotFound     = errors.New("link not found")
+	ErrVersionConflict  = errors.New("link was modified concurrently")
+	ErrInvalidShortName = errors.New("short name must be between 3 and 32 characters")
+)
+
+const (
+	MinShortNameLength = 3
+	MaxShortNameLength = 32
 )
 
 type Link struct {
-	ID          int64
-	OriginalURL string
-	ShortName   string
-	CreatedAt   time.Time
+	ID           int64
+	OriginalURL  string
+	ShortName    string
+	CreatedAt    time.Time
+	DeletedAt    *time.Time
+	Status       Status
+	StatusReason string
+	// StatusCause tells what put the link in its status; the reason is
+	// free text for people.
+	StatusCause StatusCause
+	// Version is bumped on every modification and guards updates against
+	// lost writes.
+	Version int
+	Tags    []string
+	// ClickCount and LastVisitedAt are kept up to date as visits are
+	// recorded, and reconciled from the visits periodically.
+	ClickCount    int64
+	LastVisitedAt *time.Time
+	Preview       Preview
+	Metadata      Metadata
+	Health        HealthStatus
+	// AbuseThreshold is how many people must report the link before it is
+	// disabled automatically. Zero means the service-wide default.
+	AbuseThreshold int
 }
 
 func NewLink(originalURL string, shortName string) (*Link, error) {
@@ -33,10 +61,17 @@ func NewLink(originalURL string, shortName string) (*Link, error) {
 		shortName = GenerateShortName()
 	}
 
+	if !validShortNameLength(shortName) {
+		return nil, ErrInvalidShortName
+	}
+
 	return &Link{
 		OriginalURL: originalURL,
 		ShortName:   shortName,
 		CreatedAt:   time.Now(),
+		Status:      StatusActive,
+		Version:     1,
+		Tags:        []string{},
 	}, nil
 }
 
@@ -53,7 +88,23 @@ func (l *Link) Validate() error {
 		return errors.New("short name cannot be empty")
 	}
 
-	return nil
+	if !validShortNameLength(l.ShortName) {
+		return ErrInvalidShortName
+	}
+
+	if l.AbuseThreshold < 0 {
+		return ErrInvalidAbuseThreshold
+	}
+
+	return l.Preview.Validate()
+}
+
+func validShortNameLength(shortName string) bool {
+	return len(shortName) >= MinShortNameLength && len(shortName) <= MaxShortNameLength
+}
+
+func (l *Link) IsDeleted() bool {
+	return l.DeletedAt != nil
 }
 
 func GenerateShortName() string {
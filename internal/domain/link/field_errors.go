@@ -0,0 +1,34 @@
+package link
+
+import "errors"
+
+// ErrorField names the link field a validation error refers to, or returns
+// an empty string when err is not a field validation error.
+func ErrorField(err error) string {
+	switch {
+	case errors.Is(err, ErrEmptyURL), errors.Is(err, ErrInvalidURL),
+		errors.Is(err, ErrSchemeNotAllowed), errors.Is(err, ErrDomainNotAllowed), errors.Is(err, ErrDomainDenied),
+		errors.Is(err, ErrPrivateDestination), errors.Is(err, ErrUnresolvableDestination), errors.Is(err, ErrRedirectLoop), errors.Is(err, ErrBlockedDestination):
+		return "original_url"
+	case errors.Is(err, ErrInvalidShortName), errors.Is(err, ErrShortNameExists), errors.Is(err, ErrNoShortName):
+		return "short_name"
+	case errors.Is(err, ErrTooManyTags), errors.Is(err, ErrInvalidTag):
+		return "tags"
+	case errors.Is(err, ErrInvalidPreviewTitle):
+		return "og_title"
+	case errors.Is(err, ErrInvalidPreviewDescription):
+		return "og_description"
+	case errors.Is(err, ErrInvalidPreviewImage):
+		return "og_image"
+	case errors.Is(err, ErrInvalidAbuseThreshold):
+		return "abuse_threshold"
+	case errors.Is(err, ErrInvalidAbuseReason):
+		return "reason"
+	case errors.Is(err, ErrInvalidAbuseDetails):
+		return "details"
+	case errors.Is(err, ErrInvalidReporterEmail):
+		return "email"
+	default:
+		return ""
+	}
+}
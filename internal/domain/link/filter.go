@@ -0,0 +1,287 @@
+package link
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter format")
+	ErrInvalidSort   = errors.New("invalid sort format")
+)
+
+// LinkFilter narrows down which links a query returns. Zero values match
+// everything; both time bounds are inclusive.
+type LinkFilter struct {
+	IDs []int64
+	// Query matches a substring of either the original URL or the short name.
+	Query       string
+	OriginalURL string
+	ShortName   string
+	// Tags matches links carrying all of the given tags.
+	Tags        []string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Deleted     bool
+	// Broken matches links whose destination is, or is not, failing its
+	// health checks.
+	Broken *bool
+}
+
+// VisitFilter narrows down which visits a query returns. Zero values match
+// everything; both time bounds are inclusive.
+type VisitFilter struct {
+	LinkID int64      `json:"link_id,omitempty"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty"`
+	// Status matches the HTTP status the redirect answered with.
+	Status int    `json:"status,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	// IPs matches any of the given stored IP values.
+	IPs []string `json:"ips,omitempty"`
+	// Referer matches a substring of the referer.
+	Referer string `json:"referer,omitempty"`
+	// Class matches visits of one class. VisitAnyClass matches every class
+	// and keeps stats from defaulting to human visits.
+	Class VisitClass `json:"class,omitempty"`
+}
+
+// IsEmpty reports whether the filter matches every visit.
+func (f VisitFilter) IsEmpty() bool {
+	return f.LinkID == 0 && f.From == nil && f.To == nil && f.Status == 0 &&
+		f.IP == "" && len(f.IPs) == 0 && f.Referer == "" && !f.HasClass()
+}
+
+// HasClass reports whether the filter narrows visits to a single class.
+func (f VisitFilter) HasClass() bool {
+	return f.Class != "" && f.Class != VisitAnyClass
+}
+
+// SketchesApply reports whether the filter narrows visits to human visits by
+// nothing but link and time, which is all per-day visitor sketches can answer.
+func (f VisitFilter) SketchesApply() bool {
+	return f.Status == 0 && f.IP == "" && len(f.IPs) == 0 && f.Referer == "" && f.Class == VisitHuman
+}
+
+type SortField string
+
+const (
+	SortByID          SortField = "id"
+	SortByOriginalURL SortField = "original_url"
+	SortByShortName   SortField = "short_name"
+	SortByCreatedAt   SortField = "created_at"
+	SortByDeletedAt   SortField = "deleted_at"
+	SortByClickCount  SortField = "click_count"
+	SortByLastVisited SortField = "last_visited_at"
+)
+
+// Sort orders a link listing. The zero value keeps the default order.
+type Sort struct {
+	Field SortField
+	Desc  bool
+}
+
+var sortFields = map[SortField]bool{
+	SortByID:          true,
+	SortByOriginalURL: true,
+	SortByShortName:   true,
+	SortByCreatedAt:   true,
+	SortByDeletedAt:   true,
+	SortByClickCount:  true,
+	SortByLastVisited: true,
+}
+
+// linkFilterParams is the react-admin filter object accepted by ParseFilter.
+type linkFilterParams struct {
+	ID           json.RawMessage `json:"id"`
+	Q            string          `json:"q"`
+	OriginalURL  string          `json:"original_url"`
+	ShortName    string          `json:"short_name"`
+	Tags         json.RawMessage `json:"tags"`
+	CreatedAtGte string          `json:"created_at_gte"`
+	CreatedAtLte string          `json:"created_at_lte"`
+	Deleted      bool            `json:"deleted"`
+	Broken       *bool           `json:"broken"`
+}
+
+// ParseFilter reads a react-admin style filter such as
+// {"q":"promo","tags":["spring"],"created_at_gte":"2024-01-01","broken":true}.
+func ParseFilter(filterStr string) (LinkFilter, error) {
+	var filter LinkFilter
+	filterStr = strings.TrimSpace(filterStr)
+	if filterStr == "" {
+		return filter, nil
+	}
+
+	var params linkFilterParams
+	decoder := json.NewDecoder(strings.NewReader(filterStr))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil {
+		return filter, ErrInvalidFilter
+	}
+
+	ids, err := parseIDs(params.ID)
+	if err != nil {
+		return filter, err
+	}
+	tags, err := parseStrings(params.Tags)
+	if err != nil {
+		return filter, err
+	}
+	from, err := ParseFilterTime(params.CreatedAtGte, false)
+	if err != nil {
+		return filter, err
+	}
+	to, err := ParseFilterTime(params.CreatedAtLte, true)
+	if err != nil {
+		return filter, err
+	}
+
+	return LinkFilter{
+		IDs:         ids,
+		Query:       strings.TrimSpace(params.Q),
+		OriginalURL: strings.TrimSpace(params.OriginalURL),
+		ShortName:   strings.TrimSpace(params.ShortName),
+		Tags:        tags,
+		CreatedFrom: from,
+		CreatedTo:   to,
+		Deleted:     params.Deleted,
+		Broken:      params.Broken,
+	}, nil
+}
+
+// visitFilterParams is the filter object accepted by ParseVisitFilter.
+type visitFilterParams struct {
+	LinkID  int64  `json:"link_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Status  int    `json:"status"`
+	IP      string `json:"ip"`
+	Referer string `json:"referer"`
+	Class   string `json:"class"`
+}
+
+// ParseVisitFilter reads a visit filter such as
+// {"link_id":42,"from":"2024-01-01","status":302,"class":"bot"}.
+func ParseVisitFilter(filterStr string) (VisitFilter, error) {
+	var filter VisitFilter
+	filterStr = strings.TrimSpace(filterStr)
+	if filterStr == "" {
+		return filter, nil
+	}
+
+	var params visitFilterParams
+	decoder := json.NewDecoder(strings.NewReader(filterStr))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&params); err != nil || params.LinkID < 0 || params.Status < 0 {
+		return filter, ErrInvalidFilter
+	}
+
+	from, err := ParseFilterTime(params.From, false)
+	if err != nil {
+		return filter, err
+	}
+	to, err := ParseFilterTime(params.To, true)
+	if err != nil {
+		return filter, err
+	}
+	var class VisitClass
+	if params.Class != "" {
+		if class, err = ParseVisitClass(params.Class); err != nil {
+			return filter, err
+		}
+	}
+
+	return VisitFilter{
+		LinkID:  params.LinkID,
+		From:    from,
+		To:      to,
+		Status:  params.Status,
+		IP:      strings.TrimSpace(params.IP),
+		Referer: strings.TrimSpace(params.Referer),
+		Class:   class,
+	}, nil
+}
+
+// ParseSort reads a react-admin style sort such as ["created_at","DESC"].
+func ParseSort(sortStr string) (Sort, error) {
+	sortStr = strings.TrimSpace(sortStr)
+	if sortStr == "" {
+		return Sort{}, nil
+	}
+
+	var parts []string
+	if err := json.Unmarshal([]byte(sortStr), &parts); err != nil || len(parts) != 2 {
+		return Sort{}, ErrInvalidSort
+	}
+
+	field := SortField(parts[0])
+	if !sortFields[field] {
+		return Sort{}, ErrInvalidSort
+	}
+
+	switch strings.ToUpper(parts[1]) {
+	case "ASC":
+		return Sort{Field: field}, nil
+	case "DESC":
+		return Sort{Field: field, Desc: true}, nil
+	default:
+		return Sort{}, ErrInvalidSort
+	}
+}
+
+func parseIDs(raw json.RawMessage) ([]int64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var ids []int64
+	if err := json.Unmarshal(raw, &ids); err == nil {
+		return ids, nil
+	}
+	var id int64
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return nil, ErrInvalidFilter
+	}
+	return []int64{id}, nil
+}
+
+func parseStrings(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return nil, ErrInvalidFilter
+	}
+	return []string{single}, nil
+}
+
+// ParseFilterTime accepts RFC 3339 timestamps or plain dates. An inclusive
+// upper bound (endOfDay) given as a date covers that whole day.
+func ParseFilterTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad date %q", ErrInvalidFilter, value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
@@ -0,0 +1,44 @@
+package link
+
+import "time"
+
+// DefaultBrokenAfter is how many failed health checks in a row mark a link
+// as broken.
+const DefaultBrokenAfter = 3
+
+// HealthCheck is the outcome of one request to a link's destination.
+type HealthCheck struct {
+	ID        int64
+	LinkID    int64
+	CheckedAt time.Time
+	// StatusCode is zero when no response came back, in which case Error
+	// says why.
+	StatusCode int
+	Latency    time.Duration
+	// RedirectChain lists the URLs redirected to, in order.
+	RedirectChain []string
+	Error         string
+}
+
+// Healthy reports whether the destination answered with a success or a
+// redirect that ended in one.
+func (c *HealthCheck) Healthy() bool {
+	return c.Error == "" && c.StatusCode >= 200 && c.StatusCode < 400
+}
+
+// HealthStatus is a link's standing as of its latest health check. A link
+// is broken once ConsecutiveFailures reaches the configured threshold and
+// recovers with the next healthy check.
+type HealthStatus struct {
+	Broken              bool
+	ConsecutiveFailures int
+	CheckedAt           *time.Time
+}
+
+// Health combines a link's standing with its most recent checks, newest
+// first.
+type Health struct {
+	LinkID int64
+	HealthStatus
+	Checks []*HealthCheck
+}
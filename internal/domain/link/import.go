@@ -0,0 +1,18 @@
+package link
+
+import "errors"
+
+// ErrNoShortName is reported for import rows whose short URL has no code,
+// such as "bit.ly/".
+var ErrNoShortName = errors.New("short URL has no short name")
+
+// ImportRow is one link read from an import file. Line points back at the
+// source row so errors can be reported against it, and Err holds a problem
+// found while reading the row.
+type ImportRow struct {
+	Line        int
+	OriginalURL string
+	ShortName   string
+	Tags        []string
+	Err         error
+}
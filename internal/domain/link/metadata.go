@@ -0,0 +1,47 @@
+package link
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxMetadataTitleLength       = 300
+	MaxMetadataDescriptionLength = 1000
+	MaxMetadataURLLength         = 2048
+)
+
+// Metadata is what the destination page says about itself. It is fetched
+// in the background after a link is created or its URL changes; FetchedAt
+// is set once a fetch was attempted, even if it found nothing.
+type Metadata struct {
+	Title       string
+	Description string
+	FaviconURL  string
+	FetchedAt   *time.Time
+}
+
+// NewMetadata cleans up the values scraped from a page: whitespace is
+// collapsed, text is cut to a sane length and overlong URLs are dropped.
+func NewMetadata(title, description, faviconURL string) Metadata {
+	if len(faviconURL) > MaxMetadataURLLength {
+		faviconURL = ""
+	}
+	now := time.Now()
+	return Metadata{
+		Title:       clip(title, MaxMetadataTitleLength),
+		Description: clip(description, MaxMetadataDescriptionLength),
+		FaviconURL:  faviconURL,
+		FetchedAt:   &now,
+	}
+}
+
+func clip(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
@@ -68,12 +68,17 @@ func ParseRange(rangeStr string) (*Pagination, error) {
 	return NewPagination(offset, limit), nil
 }
 
+// ContentRange renders the Content-Range header. A negative total means the
+// total is unknown and is rendered as "*".
 func (p *Pagination) ContentRange(total int) string {
 	if total == 0 {
 		return "links 0-0/0"
 	}
 
 	last := p.Offset + p.Limit - 1
+	if total < 0 {
+		return fmt.Sprintf("links %d-%d/*", p.Offset, last)
+	}
 	if last >= total {
 		last = total - 1
 	}
@@ -0,0 +1,39 @@
+package link
+
+// Patch describes a partial update of a link. Nil fields are left untouched;
+// optional fields are cleared by pointing at their zero value.
+type Patch struct {
+	OriginalURL *string
+	ShortName   *string
+	Tags        *[]string
+	// PreviewTitle, PreviewDescription and PreviewImage set single fields of
+	// the link preview.
+	PreviewTitle       *string
+	PreviewDescription *string
+	PreviewImage       *string
+	AbuseThreshold     *int
+}
+
+func (p Patch) Apply(l *Link) {
+	if p.OriginalURL != nil {
+		l.OriginalURL = *p.OriginalURL
+	}
+	if p.ShortName != nil {
+		l.ShortName = *p.ShortName
+	}
+	if p.Tags != nil {
+		l.Tags = *p.Tags
+	}
+	if p.PreviewTitle != nil {
+		l.Preview.Title = *p.PreviewTitle
+	}
+	if p.PreviewDescription != nil {
+		l.Preview.Description = *p.PreviewDescription
+	}
+	if p.PreviewImage != nil {
+		l.Preview.Image = *p.PreviewImage
+	}
+	if p.AbuseThreshold != nil {
+		l.AbuseThreshold = *p.AbuseThreshold
+	}
+}
@@ -0,0 +1,92 @@
+package link
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrSchemeNotAllowed   = errors.New("URL scheme is not allowed")
+	ErrDomainNotAllowed   = errors.New("destination domain is not on the allow list")
+	ErrDomainDenied       = errors.New("destination domain is blocked")
+	ErrPrivateDestination = errors.New("destination is on a private network")
+	// ErrUnresolvableDestination is returned when the destination host has
+	// no address, which is usually a typo.
+	ErrUnresolvableDestination = errors.New("destination host does not resolve")
+	ErrRedirectLoop            = errors.New("destination points back at this shortener")
+	ErrBlockedDestination      = errors.New("destination is on a phishing or malware blocklist")
+)
+
+// DefaultSchemes are the schemes links may use when a policy lists none.
+var DefaultSchemes = []string{"http", "https"}
+
+// DestinationPolicy decides which URLs links may point at. Domains match
+// themselves and all of their subdomains, case-insensitively.
+type DestinationPolicy struct {
+	// Schemes lists the allowed URL schemes; empty means DefaultSchemes.
+	Schemes []string
+	// AllowedDomains, when set, are the only domains links may point at.
+	AllowedDomains []string
+	// DeniedDomains are refused even when they are on the allow list.
+	DeniedDomains []string
+	// OwnDomains are the hosts the shortener answers on. Links pointing at
+	// them would redirect back into the shortener.
+	OwnDomains []string
+}
+
+// Check validates a destination URL against the policy. Whether the host
+// resolves to a private network is left to the caller, since it needs DNS.
+func (p DestinationPolicy) Check(u *url.URL) error {
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	if !containsFold(schemes, u.Scheme) {
+		return ErrSchemeNotAllowed
+	}
+
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		if u.Scheme == "http" || u.Scheme == "https" {
+			return ErrInvalidURL
+		}
+		return nil
+	}
+	if matchesDomain(host, p.OwnDomains) {
+		return ErrRedirectLoop
+	}
+	if matchesDomain(host, p.DeniedDomains) {
+		return ErrDomainDenied
+	}
+	if len(p.AllowedDomains) > 0 && !matchesDomain(host, p.AllowedDomains) {
+		return ErrDomainNotAllowed
+	}
+	return nil
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = normalizeHost(domain)
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package link
+
+import (
+	"errors"
+	"net/url"
+	"unicode/utf8"
+)
+
+const (
+	MaxPreviewTitleLength       = 200
+	MaxPreviewDescriptionLength = 500
+	MaxPreviewImageLength       = 2048
+)
+
+var (
+	ErrInvalidPreviewTitle       = errors.New("preview title must be at most 200 characters")
+	ErrInvalidPreviewDescription = errors.New("preview description must be at most 500 characters")
+	ErrInvalidPreviewImage       = errors.New("preview image must be an absolute http or https URL")
+)
+
+// Preview overrides how a link unfurls when pasted into chat and social
+// apps. Social crawlers are served these fields as Open Graph and Twitter
+// meta tags instead of being redirected.
+type Preview struct {
+	Title       string
+	Description string
+	Image       string
+}
+
+func (p Preview) IsZero() bool {
+	return p == Preview{}
+}
+
+func (p Preview) Validate() error {
+	if utf8.RuneCountInString(p.Title) > MaxPreviewTitleLength {
+		return ErrInvalidPreviewTitle
+	}
+	if utf8.RuneCountInString(p.Description) > MaxPreviewDescriptionLength {
+		return ErrInvalidPreviewDescription
+	}
+	if p.Image != "" {
+		u, err := url.Parse(p.Image)
+		if err != nil || len(p.Image) > MaxPreviewImageLength || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidPreviewImage
+		}
+	}
+	return nil
+}
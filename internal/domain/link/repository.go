@@ -1,16 +1,82 @@
 package link
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Repository interface {
 	Create(ctx context.Context, link *Link) error
 	GetByID(ctx context.Context, id int64) (*Link, error)
 	GetByShortName(ctx context.Context, shortName string) (*Link, error)
-	GetAll(ctx context.Context, offset, limit int) ([]*Link, int, error)
+	GetAll(ctx context.Context, filter LinkFilter, sort Sort, offset, limit int) ([]*Link, error)
+	// GetLinksPage and GetVisitsPage return up to page.Limit+1 rows newest
+	// first, starting after page.Cursor.
+	GetLinksPage(ctx context.Context, filter LinkFilter, page KeysetPage) ([]*Link, error)
+	CountLinks(ctx context.Context, filter LinkFilter, mode CountMode) (int, error)
 	Update(ctx context.Context, link *Link) error
 	Delete(ctx context.Context, id int64) error
+	SetStatus(ctx context.Context, id int64, status Status, cause StatusCause, reason string) (*Link, error)
+	Restore(ctx context.Context, id int64) (*Link, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 	ExistsByShortName(ctx context.Context, shortName string) (bool, error)
+	// SetMetadata stores metadata fetched from originalURL, unless the link
+	// has since moved to another URL.
+	SetMetadata(ctx context.Context, id int64, originalURL string, metadata Metadata) error
+	// GetLinksWithoutMetadata returns up to limit live links whose metadata
+	// was never fetched, oldest first.
+	GetLinksWithoutMetadata(ctx context.Context, limit int) ([]*Link, error)
+	// GetLinksDueForHealthCheck returns up to limit active links last
+	// checked before the given time, never-checked links first.
+	GetLinksDueForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*Link, error)
+	// RecordHealthCheck stores check and updates the link's health status,
+	// marking it broken after brokenAfter failures in a row.
+	RecordHealthCheck(ctx context.Context, check *HealthCheck, brokenAfter int) (HealthStatus, error)
+	// GetHealthChecks returns a link's latest checks, newest first.
+	GetHealthChecks(ctx context.Context, linkID int64, limit int) ([]*HealthCheck, error)
+	PruneHealthChecks(ctx context.Context, before time.Time) (int64, error)
+	// CreateVisit records a visit and bumps the link's click counter.
 	CreateVisit(ctx context.Context, visit *LinkVisit) error
-	GetVisits(ctx context.Context, offset, limit int) ([]*LinkVisit, int, error)
+	// ReconcileClickCounts recomputes click counters from the stored visits
+	// and returns how many links were off.
+	ReconcileClickCounts(ctx context.Context) (int64, error)
+	GetVisits(ctx context.Context, filter VisitFilter, offset, limit int) ([]*LinkVisit, error)
+	GetVisitsPage(ctx context.Context, filter VisitFilter, page KeysetPage) ([]*LinkVisit, error)
+	CountVisits(ctx context.Context, filter VisitFilter, mode CountMode) (int, error)
+	// DeleteVisit and DeleteVisits also take the deleted visits out of the
+	// click counters and visitor sketches they were counted in.
 	DeleteVisit(ctx context.Context, id int64) error
+	DeleteVisits(ctx context.Context, filter VisitFilter) (int64, error)
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+	// GetDailyStats returns per-day aggregates for visits matching filter,
+	// from both raw visits and rolled-up days. A day may appear once per
+	// source. Rolled-up days keep nothing but link, day and class, so the
+	// filter's status, IP and referer are ignored for both sources.
+	GetDailyStats(ctx context.Context, filter VisitFilter) ([]*DailyStats, error)
+	// GetVisitorSketches returns a link's per-day visitor sketches between
+	// the optional from and to times, whole days included.
+	GetVisitorSketches(ctx context.Context, linkID int64, from, to *time.Time) ([]*VisitorSketch, error)
+	// RollupVisits folds visits from whole days before the given time into
+	// daily aggregates and deletes them, returning how many were folded.
+	RollupVisits(ctx context.Context, before time.Time) (int64, error)
+	// ExportLinks and ExportVisits call fn for every matching row, streaming
+	// them from the database instead of loading the whole result.
+	ExportLinks(ctx context.Context, filter LinkFilter, fn func(*Link) error) error
+	ExportVisits(ctx context.Context, filter VisitFilter, fn func(*LinkVisit) error) error
+	CreateAbuseReport(ctx context.Context, report *AbuseReport) error
+	GetAbuseReport(ctx context.Context, id int64) (*AbuseReport, error)
+	// GetAbuseReports returns one page of matching reports, oldest first.
+	GetAbuseReports(ctx context.Context, filter AbuseReportFilter, offset, limit int) ([]*AbuseReport, error)
+	CountAbuseReports(ctx context.Context, filter AbuseReportFilter) (int, error)
+	// CountAbuseReporters counts the distinct reporter keys among a link's
+	// open reports.
+	CountAbuseReporters(ctx context.Context, linkID int64) (int, error)
+	// ResolveAbuseReport closes an open report with status.
+	ResolveAbuseReport(ctx context.Context, id int64, status AbuseReportStatus) (*AbuseReport, error)
+	// ResolveLinkAbuseReports closes every open report of a link with
+	// status and returns how many there were.
+	ResolveLinkAbuseReports(ctx context.Context, linkID int64, status AbuseReportStatus) (int64, error)
+	// InTx runs fn with a repository whose changes are committed together,
+	// or not at all if fn returns an error.
+	InTx(ctx context.Context, fn func(repo Repository) error) error
 }
@@ -0,0 +1,141 @@
+package link
+
+import (
+	"sort"
+	"time"
+
+	"app/internal/shared/hll"
+)
+
+// TopReferrersLimit is how many referrers daily aggregates and stats keep.
+const TopReferrersLimit = 10
+
+// DirectReferer stands in for visits that came without a referer.
+const DirectReferer = "(direct)"
+
+// DailyStats aggregates one link's visits of one class over one UTC day.
+// Uniques counts distinct stored IP values within the day.
+type DailyStats struct {
+	LinkID int64
+	Day    time.Time
+	Class  VisitClass
+	Clicks int64
+	// Redirects counts the clicks that were sent on to the destination,
+	// which are the ones a link's click counter includes.
+	Redirects int64
+	Uniques   int64
+	Referrers map[string]int64
+}
+
+// VisitorSketch is a HyperLogLog sketch of the stored IP values of human
+// visitors to a link on one UTC day. Unlike DailyStats uniques, sketches of several days
+// can be merged without counting a returning visitor twice.
+type VisitorSketch struct {
+	LinkID int64
+	Day    time.Time
+	Sketch []byte
+}
+
+type ReferrerCount struct {
+	Referer string
+	Clicks  int64
+}
+
+// LinkStats summarises a link's traffic over a period, day by day.
+type LinkStats struct {
+	LinkID int64
+	// Clicks counts every visit of the period, including notice pages and
+	// previews, and Redirects only those sent on to the destination.
+	Clicks       int64
+	Redirects    int64
+	Uniques      int64
+	Days         []*DailyStats
+	TopReferrers []ReferrerCount
+}
+
+// SummarizeStats merges daily aggregates, which may come from both raw
+// visits and rolled-up days, into per-day totals and an overall summary.
+// Uniques come from the visitor sketches where a day has one, merged across
+// days, and are summed per day otherwise, so a visitor returning on a day
+// without a sketch counts again.
+func SummarizeStats(linkID int64, days []*DailyStats, sketches []*VisitorSketch) *LinkStats {
+	byDay := make(map[time.Time]*DailyStats)
+	referrers := make(map[string]int64)
+	stats := &LinkStats{LinkID: linkID, Days: []*DailyStats{}}
+
+	for _, d := range days {
+		day := d.Day.UTC().Truncate(24 * time.Hour)
+		merged, ok := byDay[day]
+		if !ok {
+			merged = &DailyStats{LinkID: linkID, Day: day, Referrers: make(map[string]int64)}
+			byDay[day] = merged
+			stats.Days = append(stats.Days, merged)
+		}
+		merged.Clicks += d.Clicks
+		merged.Redirects += d.Redirects
+		merged.Uniques += d.Uniques
+		for referer, clicks := range d.Referrers {
+			merged.Referrers[referer] += clicks
+			referrers[referer] += clicks
+		}
+
+		stats.Clicks += d.Clicks
+		stats.Redirects += d.Redirects
+		stats.Uniques += d.Uniques
+	}
+
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Day.Before(stats.Days[j].Day) })
+	stats.TopReferrers = TopReferrers(referrers, TopReferrersLimit)
+	if len(sketches) > 0 {
+		applySketches(stats, byDay, sketches)
+	}
+	return stats
+}
+
+// applySketches replaces summed uniques with sketch estimates. Sketches of
+// days without visits, such as days whose visits were erased, are ignored.
+func applySketches(stats *LinkStats, byDay map[time.Time]*DailyStats, sketches []*VisitorSketch) {
+	merged := hll.New()
+	sketched := make(map[time.Time]bool)
+	for _, s := range sketches {
+		day, ok := byDay[s.Day.UTC().Truncate(24*time.Hour)]
+		if !ok {
+			continue
+		}
+		sketch, err := hll.FromBytes(s.Sketch)
+		if err != nil {
+			continue
+		}
+		merged.Merge(sketch)
+		sketched[day.Day] = true
+		day.Uniques = int64(sketch.Estimate())
+	}
+	if len(sketched) == 0 {
+		return
+	}
+
+	stats.Uniques = int64(merged.Estimate())
+	for _, d := range stats.Days {
+		if !sketched[d.Day] {
+			stats.Uniques += d.Uniques
+		}
+	}
+}
+
+// TopReferrers returns the n most frequent referrers, busiest first.
+func TopReferrers(referrers map[string]int64, n int) []ReferrerCount {
+	top := make([]ReferrerCount, 0, len(referrers))
+	for referer, clicks := range referrers {
+		top = append(top, ReferrerCount{Referer: referer, Clicks: clicks})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Clicks != top[j].Clicks {
+			return top[i].Clicks > top[j].Clicks
+		}
+		return top[i].Referer < top[j].Referer
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
@@ -0,0 +1,51 @@
+package link
+
+import "errors"
+
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusDisabled Status = "disabled"
+	StatusBanned   Status = "banned"
+)
+
+// StatusCause records what moved a link into its status when the service
+// did so on its own. Links whose status was set by hand have no cause.
+type StatusCause string
+
+const (
+	CauseManual StatusCause = ""
+	// CauseBlocklist marks links disabled because their destination turned
+	// up on a blocklist.
+	CauseBlocklist StatusCause = "blocklist"
+	// CauseAbuse marks links taken down over abuse reports.
+	CauseAbuse StatusCause = "abuse"
+)
+
+var ErrInvalidStatus = errors.New("invalid status")
+
+func ParseStatus(s string) (Status, error) {
+	switch status := Status(s); status {
+	case StatusActive, StatusDisabled, StatusBanned:
+		return status, nil
+	default:
+		return "", ErrInvalidStatus
+	}
+}
+
+// IsActive reports whether the link may be followed by visitors.
+func (l *Link) IsActive() bool {
+	return l.Status == "" || l.Status == StatusActive
+}
+
+// IsBlocklisted reports whether the link was disabled because its
+// destination is on a blocklist.
+func (l *Link) IsBlocklisted() bool {
+	return l.Status == StatusDisabled && l.StatusCause == CauseBlocklist
+}
+
+// IsAbuseDisabled reports whether the link was disabled over abuse reports.
+func (l *Link) IsAbuseDisabled() bool {
+	return l.Status == StatusDisabled && l.StatusCause == CauseAbuse
+}
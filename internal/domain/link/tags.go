@@ -0,0 +1,40 @@
+package link
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	MaxTags      = 20
+	MaxTagLength = 64
+)
+
+var (
+	ErrTooManyTags = errors.New("too many tags")
+	ErrInvalidTag  = errors.New("tags must be between 1 and 64 characters")
+)
+
+// NormalizeTags trims surrounding whitespace, drops empty entries and
+// duplicates, and enforces the tag limits. The result is never nil.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return nil, ErrInvalidTag
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	return normalized, nil
+}
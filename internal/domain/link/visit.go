@@ -1,6 +1,38 @@
 package link
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// VisitClass tells human clicks apart from automated fetches of a link.
+type VisitClass string
+
+const (
+	VisitHuman    VisitClass = "human"
+	VisitBot      VisitClass = "bot"
+	VisitPreview  VisitClass = "preview"
+	VisitPrefetch VisitClass = "prefetch"
+	// VisitAnyClass is accepted by filters to match every class.
+	VisitAnyClass VisitClass = "all"
+)
+
+var ErrInvalidVisitClass = errors.New("invalid visit class")
+
+// previewAgents are fetchers that unfurl a pasted link into a preview card.
+var previewAgents = []string{
+	"slackbot", "slack-imgproxy", "twitterbot", "facebookexternalhit", "facebookcatalog",
+	"linkedinbot", "discordbot", "telegrambot", "whatsapp", "skypeuripreview",
+	"redditbot", "embedly", "iframely", "pinterestbot", "mastodon",
+}
+
+// botAgents are substrings of crawler, monitor and HTTP library user agents.
+var botAgents = []string{
+	"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests", "python-urllib",
+	"go-http-client", "java/", "okhttp", "axios/", "node-fetch", "libwww-perl", "httpclient",
+	"headlesschrome", "phantomjs", "lighthouse", "pingdom", "uptimerobot",
+}
 
 type LinkVisit struct {
 	ID        int64
@@ -9,16 +41,53 @@ type LinkVisit struct {
 	UserAgent string
 	Referer   string
 	Status    int
+	Class     VisitClass
 	CreatedAt time.Time
 }
 
-func NewLinkVisit(linkID int64, ip, userAgent, referer string, status int) *LinkVisit {
+func NewLinkVisit(linkID int64, ip, userAgent, referer string, status int, class VisitClass) *LinkVisit {
 	return &LinkVisit{
 		LinkID:    linkID,
 		IP:        ip,
 		UserAgent: userAgent,
 		Referer:   referer,
 		Status:    status,
+		Class:     class,
 		CreatedAt: time.Now(),
 	}
 }
+
+// ClassifyVisit tells from the user agent and the Purpose or Sec-Purpose
+// request header whether a visit is a human click. Preview fetchers are
+// checked before bots since many of them call themselves bots.
+func ClassifyVisit(userAgent, purpose string) VisitClass {
+	if strings.Contains(strings.ToLower(purpose), "prefetch") {
+		return VisitPrefetch
+	}
+
+	agent := strings.ToLower(strings.TrimSpace(userAgent))
+	if agent == "" {
+		return VisitBot
+	}
+	for _, name := range previewAgents {
+		if strings.Contains(agent, name) {
+			return VisitPreview
+		}
+	}
+	for _, name := range botAgents {
+		if strings.Contains(agent, name) {
+			return VisitBot
+		}
+	}
+	return VisitHuman
+}
+
+// ParseVisitClass validates a class name, VisitAnyClass included.
+func ParseVisitClass(s string) (VisitClass, error) {
+	switch class := VisitClass(strings.ToLower(strings.TrimSpace(s))); class {
+	case VisitHuman, VisitBot, VisitPreview, VisitPrefetch, VisitAnyClass:
+		return class, nil
+	default:
+		return "", ErrInvalidVisitClass
+	}
+}
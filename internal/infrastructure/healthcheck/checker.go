@@ -0,0 +1,76 @@
+// Package healthcheck requests link destinations to tell whether they still
+// resolve.
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"app/internal/domain/link"
+)
+
+const (
+	userAgent = "Mozilla/5.0 (compatible; url-shortener-healthcheck/1.0)"
+	// drainBytes bounds how much of a GET body is read so the connection
+	// can be reused.
+	drainBytes = 64 * 1024
+)
+
+// Checker requests destinations through client, which should refuse
+// internal addresses and bound redirects (see netguard).
+type Checker struct {
+	client *http.Client
+}
+
+func NewChecker(client *http.Client) *Checker {
+	return &Checker{client: client}
+}
+
+// Check sends a HEAD request to rawURL and falls back to GET when HEAD is
+// refused, since many servers answer HEAD with 404 or 405. Failures are
+// reported in the check rather than as an error.
+func (c *Checker) Check(ctx context.Context, rawURL string) *link.HealthCheck {
+	check := &link.HealthCheck{CheckedAt: time.Now()}
+
+	resp, err := c.do(ctx, http.MethodHead, rawURL)
+	if err == nil && resp.StatusCode >= 400 {
+		resp, err = c.do(ctx, http.MethodGet, rawURL)
+	}
+	check.Latency = time.Since(check.CheckedAt)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	check.StatusCode = resp.StatusCode
+	check.RedirectChain = redirectChain(resp)
+	return check
+}
+
+func (c *Checker) do(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, drainBytes))
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// redirectChain walks back from the final request through the responses
+// that redirected to it.
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		chain = append([]string{req.URL.String()}, chain...)
+	}
+	return chain
+}
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	linkdomain "app/internal/domain/link"
+	"app/internal/shared/validator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	govalidator "github.com/go-playground/validator/v10"
+)
+
+// AbuseReportRequest is accepted as JSON or as a form post from the abuse
+// page. The reason is checked by the domain so that both get the same
+// message.
+type AbuseReportRequest struct {
+	Reason  string `json:"reason" form:"reason" binding:"required"`
+	Details string `json:"details" form:"details" binding:"max=2000"`
+	Email   string `json:"email" form:"email" binding:"omitempty,email,max=254"`
+}
+
+type AbuseReportResponse struct {
+	ID            int64   `json:"id"`
+	LinkID        int64   `json:"link_id"`
+	Reason        string  `json:"reason"`
+	Details       string  `json:"details"`
+	ReporterEmail string  `json:"reporter_email"`
+	ReporterIP    string  `json:"reporter_ip"`
+	Status        string  `json:"status"`
+	CreatedAt     string  `json:"created_at"`
+	ResolvedAt    *string `json:"resolved_at"`
+}
+
+// AbuseActionResponse is returned when a moderator disables a reported link.
+type AbuseActionResponse struct {
+	Report AbuseReportResponse `json:"report"`
+	Link   LinkResponse        `json:"link"`
+}
+
+// ReportLink serves POST /r/:code/report. Reporters get no hint of whether
+// the report took the link down.
+func (h *Handler) ReportLink(c *gin.Context) {
+	h.reportLink(c, c.Param("code"))
+}
+
+// ReportFromPage serves POST /abuse, where the reporter pastes the short
+// URL instead of posting to the link's own report address.
+func (h *Handler) ReportFromPage(c *gin.Context) {
+	h.reportLink(c, shortNameFromInput(c.PostForm("link")))
+}
+
+func (h *Handler) reportLink(c *gin.Context, code string) {
+	page := c.ContentType() != binding.MIMEJSON
+	form := abuseFormData{Reasons: linkdomain.AbuseReasons, Link: code}
+
+	var req AbuseReportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		var ve govalidator.ValidationErrors
+		if !errors.As(err, &ve) {
+			if page {
+				form.Error = "Invalid request."
+				renderPage(c, http.StatusBadRequest, abusePage, form)
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorSingleResponse{Error: "invalid request"})
+			return
+		}
+		if page {
+			form.Error = "Please choose a reason and check the details and email address."
+			renderPage(c, http.StatusUnprocessableEntity, abusePage, form)
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, validator.FormatValidationErrors(ve))
+		return
+	}
+	form.Reason, form.Details, form.Email = req.Reason, req.Details, req.Email
+
+	report, _, err := h.service.ReportLink(c.Request.Context(), code,
+		linkdomain.AbuseReason(req.Reason), req.Details, req.Email, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, linkdomain.ErrLinkNotFound):
+			if page {
+				form.Error = "No link with that address was found."
+				renderPage(c, http.StatusNotFound, abusePage, form)
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		case linkdomain.ErrorField(err) != "":
+			if page {
+				form.Error = err.Error()
+				renderPage(c, http.StatusUnprocessableEntity, abusePage, form)
+				return
+			}
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{linkdomain.ErrorField(err): err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if page {
+		renderPage(c, http.StatusAccepted, noticePage, noticeData{
+			Title:   "Thank you",
+			Message: "Your report has been received and will be reviewed by a moderator.",
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"id": report.ID, "status": report.Status})
+}
+
+// AbusePage serves GET /abuse, a form for reporting a link. The link field
+// is filled in from ?link= when present.
+func (h *Handler) AbusePage(c *gin.Context) {
+	renderPage(c, http.StatusOK, abusePage, abuseFormData{
+		Reasons: linkdomain.AbuseReasons,
+		Link:    c.Query("link"),
+	})
+}
+
+// shortNameFromInput accepts either a short name or a full short URL.
+func shortNameFromInput(input string) string {
+	input = strings.TrimSpace(input)
+	if u, err := url.Parse(input); err == nil && u.Host != "" {
+		input = u.Path
+	}
+	input = strings.TrimSuffix(input, "/")
+	if i := strings.LastIndex(input, "/"); i >= 0 {
+		input = input[i+1:]
+	}
+	return input
+}
+
+func (h *Handler) GetAbuseReports(c *gin.Context) {
+	var filter linkdomain.AbuseReportFilter
+	if status := c.Query("status"); status != "" {
+		parsed, err := linkdomain.ParseAbuseReportStatus(status)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.Status = parsed
+	}
+	if linkID := c.Query("link_id"); linkID != "" {
+		id, err := strconv.ParseInt(linkID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link_id"})
+			return
+		}
+		filter.LinkID = id
+	}
+
+	pagination, err := linkdomain.ParseRange(c.Query("range"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid range format"})
+		return
+	}
+
+	reports, total, err := h.service.GetAbuseReports(c.Request.Context(), filter, pagination.Offset, pagination.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]AbuseReportResponse, len(reports))
+	for i, report := range reports {
+		response[i] = toAbuseReportResponse(report)
+	}
+	c.Header("Content-Range", pagination.ContentRange(total))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) GetAbuseReport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	report, err := h.service.GetAbuseReport(c.Request.Context(), id)
+	if err != nil {
+		respondAbuseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAbuseReportResponse(report))
+}
+
+// DismissAbuseReport serves POST /api/abuse_reports/:id/dismiss.
+func (h *Handler) DismissAbuseReport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	report, err := h.service.DismissAbuseReport(c.Request.Context(), id, c.ClientIP())
+	if err != nil {
+		respondAbuseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAbuseReportResponse(report))
+}
+
+// DisableReportedLink serves POST /api/abuse_reports/:id/disable, which
+// disables the reported link and closes its open reports.
+func (h *Handler) DisableReportedLink(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	report, linkEntity, err := h.service.DisableReportedLink(c.Request.Context(), id, c.ClientIP())
+	if err != nil {
+		respondAbuseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, AbuseActionResponse{
+		Report: toAbuseReportResponse(report),
+		Link:   toLinkResponse(linkEntity, h.service),
+	})
+}
+
+func respondAbuseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, linkdomain.ErrAbuseReportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, linkdomain.ErrAbuseReportResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, linkdomain.ErrLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func toAbuseReportResponse(report *linkdomain.AbuseReport) AbuseReportResponse {
+	response := AbuseReportResponse{
+		ID:            report.ID,
+		LinkID:        report.LinkID,
+		Reason:        string(report.Reason),
+		Details:       report.Details,
+		ReporterEmail: report.ReporterEmail,
+		ReporterIP:    report.ReporterIP,
+		Status:        string(report.Status),
+		CreatedAt:     report.CreatedAt.Format(time.RFC3339),
+	}
+	if report.ResolvedAt != nil {
+		resolvedAt := report.ResolvedAt.Format(time.RFC3339)
+		response.ResolvedAt = &resolvedAt
+	}
+	return response
+}
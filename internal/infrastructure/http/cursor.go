@@ -0,0 +1,77 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keysetPage reads the cursor and limit parameters. Keyset pagination is
+// used whenever cursor is present; an empty cursor asks for the first page.
+func keysetPage(c *gin.Context) (linkdomain.KeysetPage, bool, error) {
+	token, ok := c.GetQuery("cursor")
+	if !ok {
+		return linkdomain.KeysetPage{}, false, nil
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return linkdomain.KeysetPage{}, true, fmt.Errorf("invalid limit")
+		}
+		limit = n
+	}
+
+	page, err := linkdomain.NewKeysetPage(token, limit)
+	return page, true, err
+}
+
+// countMode reads the count parameter: exact, estimated or none.
+func countMode(c *gin.Context, fallback linkdomain.CountMode) (linkdomain.CountMode, error) {
+	mode, err := linkdomain.ParseCountMode(c.Query("count"), fallback)
+	if err != nil {
+		return "", fmt.Errorf("invalid count: expected exact, estimated or none")
+	}
+	return mode, nil
+}
+
+// setCursorHeaders advertises the neighbouring pages in a Link header and
+// as bare tokens for clients that would rather not parse it.
+func setCursorHeaders(c *gin.Context, limit int, next, prev *linkdomain.Cursor) {
+	var links []string
+	if next != nil {
+		token := next.Encode()
+		c.Header("X-Next-Cursor", token)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, cursorURL(c, token, limit)))
+	}
+	if prev != nil {
+		token := prev.Encode()
+		c.Header("X-Prev-Cursor", token)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, cursorURL(c, token, limit)))
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+func cursorURL(c *gin.Context, token string, limit int) string {
+	query := c.Request.URL.Query()
+	query.Set("cursor", token)
+	query.Set("limit", strconv.Itoa(limit))
+	u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// setTotalCount reports the total for keyset listings, where Content-Range
+// does not apply. Unknown totals are left out.
+func setTotalCount(c *gin.Context, total int) {
+	if total >= 0 {
+		c.Header("X-Total-Count", strconv.Itoa(total))
+	}
+}
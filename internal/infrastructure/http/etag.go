@@ -0,0 +1,94 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidIfMatch = errors.New("invalid If-Match header")
+	// errWeakIfMatch means If-Match listed only weak tags, which never
+	// match since If-Match uses strong comparison.
+	errWeakIfMatch = errors.New("If-Match requires a strong entity tag")
+)
+
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch extracts the link versions listed in an If-Match header of
+// tags produced by versionETag. A wildcard matches any version and lists
+// none. Weak tags are skipped.
+func parseIfMatch(header string) ([]int, error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return nil, nil
+	}
+
+	var (
+		versions []int
+		weak     bool
+	)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			tag, weak = tag[2:], true
+			if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+				return nil, errInvalidIfMatch
+			}
+			continue
+		}
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			return nil, errInvalidIfMatch
+		}
+		version, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err != nil || version <= 0 {
+			return nil, errInvalidIfMatch
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 && weak {
+		return nil, errWeakIfMatch
+	}
+	return versions, nil
+}
+
+// ifMatchVersion returns the version of link id that the request's If-Match
+// header makes a change conditional on, or 0 for a wildcard. When it lists
+// several versions, the link's current one is used if it is among them.
+// It writes the error response and returns false when the header is
+// malformed or cannot match.
+func (h *Handler) ifMatchVersion(c *gin.Context, id int64) (int, bool) {
+	versions, err := parseIfMatch(c.GetHeader("If-Match"))
+	switch {
+	case errors.Is(err, errWeakIfMatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return 0, false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, false
+	case len(versions) <= 1:
+		if len(versions) == 0 {
+			return 0, true
+		}
+		return versions[0], true
+	}
+
+	linkEntity, err := h.service.GetLink(c.Request.Context(), id)
+	if err != nil {
+		h.respondUpdated(c, nil, err)
+		return 0, false
+	}
+	if !slices.Contains(versions, linkEntity.Version) {
+		h.respondUpdated(c, nil, linkdomain.ErrVersionConflict)
+		return 0, false
+	}
+	return linkEntity.Version, true
+}
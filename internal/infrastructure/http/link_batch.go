@@ -0,0 +1,152 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"app/internal/application/link"
+	"app/internal/shared/validator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	govalidator "github.com/go-playground/validator/v10"
+)
+
+const defaultBatchMaxOperations = 100
+
+type BatchRequest struct {
+	// Atomic applies all operations in one transaction, or none of them.
+	Atomic     bool                    `json:"atomic"`
+	Operations []BatchOperationRequest `json:"operations" binding:"required,min=1"`
+}
+
+type BatchOperationRequest struct {
+	Op          string   `json:"op" binding:"required,oneof=create update delete"`
+	ID          int64    `json:"id" binding:"omitempty,min=1"`
+	Version     int      `json:"version" binding:"omitempty,min=1"`
+	OriginalURL string   `json:"original_url" binding:"omitempty,url"`
+	ShortName   string   `json:"short_name" binding:"omitempty,min=3,max=32"`
+	Tags        []string `json:"tags" binding:"omitempty,max=20,dive,max=64"`
+	previewFields
+}
+
+type BatchResultResponse struct {
+	Index  int               `json:"index"`
+	Op     string            `json:"op"`
+	Status int               `json:"status"`
+	Link   *LinkResponse     `json:"link,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResultResponse `json:"results"`
+}
+
+func (h *Handler) Batch(c *gin.Context) {
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var ve govalidator.ValidationErrors
+		if errors.As(err, &ve) {
+			c.JSON(http.StatusUnprocessableEntity, validator.FormatValidationErrors(ve))
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorSingleResponse{Error: "invalid request"})
+		return
+	}
+
+	if len(req.Operations) > h.config.BatchMaxOperations {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{
+			"operations": "maximum length is " + strconv.Itoa(h.config.BatchMaxOperations),
+		}})
+		return
+	}
+
+	results := make([]BatchResultResponse, len(req.Operations))
+	ops := make([]link.BatchOperation, 0, len(req.Operations))
+	positions := make([]int, 0, len(req.Operations))
+	invalid := false
+
+	for i, item := range req.Operations {
+		results[i] = BatchResultResponse{Index: i, Op: item.Op}
+		if fieldErrors := validateBatchOperation(item); len(fieldErrors) > 0 {
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Errors = fieldErrors
+			invalid = true
+			continue
+		}
+		ops = append(ops, link.BatchOperation{
+			Op:          link.BatchOp(item.Op),
+			ID:          item.ID,
+			Version:     item.Version,
+			OriginalURL: item.OriginalURL,
+			ShortName:   item.ShortName,
+			Tags:        item.Tags,
+			Preview:     item.preview(),
+		})
+		positions = append(positions, i)
+	}
+
+	if invalid && req.Atomic {
+		for _, i := range positions {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Errors = map[string]string{"batch": link.ErrBatchAborted.Error()}
+		}
+		c.JSON(http.StatusUnprocessableEntity, BatchResponse{Results: results})
+		return
+	}
+
+	outcomes, err := h.service.ApplyBatch(c.Request.Context(), ops, req.Atomic)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	failed := invalid
+	for j, outcome := range outcomes {
+		i := positions[j]
+		if outcome.Err != nil {
+			failed = true
+			results[i].Status, results[i].Errors = linkErrorFields(outcome.Err)
+			continue
+		}
+
+		switch ops[j].Op {
+		case link.BatchCreate:
+			results[i].Status = http.StatusCreated
+		case link.BatchDelete:
+			results[i].Status = http.StatusNoContent
+		default:
+			results[i].Status = http.StatusOK
+		}
+		if outcome.Link != nil {
+			response := toLinkResponse(outcome.Link, h.service)
+			results[i].Link = &response
+		}
+	}
+
+	status := http.StatusOK
+	if failed && req.Atomic {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, BatchResponse{Results: results})
+}
+
+func validateBatchOperation(item BatchOperationRequest) map[string]string {
+	if err := binding.Validator.ValidateStruct(&item); err != nil {
+		var ve govalidator.ValidationErrors
+		if errors.As(err, &ve) {
+			return validator.FormatValidationErrors(ve).Errors
+		}
+		return map[string]string{"op": "invalid value"}
+	}
+
+	fieldErrors := make(map[string]string)
+	if item.Op == string(link.BatchCreate) && item.OriginalURL == "" {
+		fieldErrors["original_url"] = "field is required"
+	}
+	if item.Op != string(link.BatchCreate) && item.ID == 0 {
+		fieldErrors["id"] = "field is required"
+	}
+	return fieldErrors
+}
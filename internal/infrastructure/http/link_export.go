@@ -0,0 +1,208 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+
+	// exportFlushEvery bounds how many rows are buffered before they are
+	// pushed to the client.
+	exportFlushEvery = 500
+)
+
+var (
+	linkExportColumns  = []string{"id", "original_url", "short_name", "short_url", "status", "tags", "click_count", "last_visited_at", "created_at", "deleted_at"}
+	visitExportColumns = []string{"id", "link_id", "created_at", "ip", "user_agent", "referer", "status", "class"}
+)
+
+func (h *Handler) ExportLinks(c *gin.Context) {
+	filter, err := linkFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.CreatedFrom == nil {
+		if filter.CreatedFrom, err = queryTime(c, "from", false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if filter.CreatedTo == nil {
+		if filter.CreatedTo, err = queryTime(c, "to", true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	w, ok := h.startExport(c, "links", linkExportColumns)
+	if !ok {
+		return
+	}
+
+	err = h.service.ExportLinks(c.Request.Context(), filter, func(l *linkdomain.Link) error {
+		response := toLinkResponse(l, h.service)
+		deletedAt, lastVisitedAt := "", ""
+		if response.DeletedAt != nil {
+			deletedAt = *response.DeletedAt
+		}
+		if response.LastVisitedAt != nil {
+			lastVisitedAt = *response.LastVisitedAt
+		}
+		return w.write(response, []string{
+			strconv.FormatInt(l.ID, 10),
+			l.OriginalURL,
+			l.ShortName,
+			response.ShortURL,
+			response.Status,
+			strings.Join(l.Tags, ";"),
+			strconv.FormatInt(l.ClickCount, 10),
+			lastVisitedAt,
+			l.CreatedAt.Format(time.RFC3339),
+			deletedAt,
+		})
+	})
+	w.finish(c, err)
+}
+
+func (h *Handler) ExportVisits(c *gin.Context) {
+	filter, err := visitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w, ok := h.startExport(c, "link_visits", visitExportColumns)
+	if !ok {
+		return
+	}
+
+	err = h.service.ExportVisits(c.Request.Context(), filter, func(v *linkdomain.LinkVisit) error {
+		return w.write(toVisitResponse(v), []string{
+			strconv.FormatInt(v.ID, 10),
+			strconv.FormatInt(v.LinkID, 10),
+			v.CreatedAt.Format(time.RFC3339),
+			v.IP,
+			v.UserAgent,
+			v.Referer,
+			strconv.Itoa(v.Status),
+			string(v.Class),
+		})
+	})
+	w.finish(c, err)
+}
+
+// exportFormat picks the format from ?format= first and the Accept header
+// second, defaulting to CSV.
+func exportFormat(c *gin.Context) (string, bool) {
+	if format := c.Query("format"); format != "" {
+		if format == exportFormatCSV || format == exportFormatNDJSON {
+			return format, true
+		}
+		return "", false
+	}
+
+	switch c.NegotiateFormat(mimeCSV, mimeNDJSON) {
+	case mimeNDJSON:
+		return exportFormatNDJSON, true
+	default:
+		return exportFormatCSV, true
+	}
+}
+
+type exportWriter struct {
+	flush func()
+	csv   *csv.Writer
+	json  *json.Encoder
+	rows  int
+}
+
+func (h *Handler) startExport(c *gin.Context, name string, columns []string) (*exportWriter, bool) {
+	format, ok := exportFormat(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return nil, false
+	}
+
+	w := &exportWriter{flush: c.Writer.Flush}
+	if format == exportFormatNDJSON {
+		c.Header("Content-Type", mimeNDJSON)
+		w.json = json.NewEncoder(c.Writer)
+	} else {
+		c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+		w.csv = csv.NewWriter(c.Writer)
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	c.Status(http.StatusOK)
+
+	if w.csv != nil {
+		if err := w.csv.Write(columns); err != nil {
+			return nil, false
+		}
+	}
+	return w, true
+}
+
+func (w *exportWriter) write(record any, fields []string) error {
+	var err error
+	if w.csv != nil {
+		for i, field := range fields {
+			fields[i] = escapeFormula(field)
+		}
+		err = w.csv.Write(fields)
+	} else {
+		err = w.json.Encode(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%exportFlushEvery == 0 {
+		w.flushAll()
+	}
+	return nil
+}
+
+// escapeFormula prefixes a cell that a spreadsheet would evaluate as a
+// formula with a single quote, so visitor-supplied values such as user
+// agents and referers are shown as text when the export is opened.
+func escapeFormula(field string) string {
+	if field != "" && strings.ContainsRune("=+-@\t\r", rune(field[0])) {
+		return "'" + field
+	}
+	return field
+}
+
+func (w *exportWriter) flushAll() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	w.flush()
+}
+
+// finish flushes what is left. Once streaming has started the status line
+// is gone, so a failure can only be logged and the response cut short.
+func (w *exportWriter) finish(c *gin.Context, err error) {
+	w.flushAll()
+	if err != nil {
+		log.Printf("error: export of %s aborted after %d rows: %v", c.Request.URL.Path, w.rows, err)
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"app/internal/application/link"
 	linkdomain "app/internal/domain/link"
+	"app/internal/shared/ratelimit"
 	"app/internal/shared/validator"
 
 	"github.com/gin-gonic/gin"
@@ -16,38 +17,119 @@ import (
 	"github.com/lib/pq"
 )
 
+const (
+	defaultDisabledStatus = http.StatusForbidden
+	defaultBannedStatus   = http.StatusGone
+)
+
+// HandlerConfig controls how the handler answers for links that are out of
+// service. Zero values fall back to the defaults.
+type HandlerConfig struct {
+	DisabledStatus int
+	BannedStatus   int
+	// BatchMaxOperations caps the number of operations in POST /api/links/batch.
+	BatchMaxOperations int
+	// CreateLimiter limits creating single links and BulkLimiter batches
+	// and imports, which create many links per request. RedirectLimiter
+	// limits /r/:code and ReportLimiter both ways of reporting abuse. Nil
+	// means unlimited.
+	CreateLimiter   *ratelimit.Limiter
+	BulkLimiter     *ratelimit.Limiter
+	RedirectLimiter *ratelimit.Limiter
+	ReportLimiter   *ratelimit.Limiter
+}
+
 type Handler struct {
 	service *link.Service
+	config  HandlerConfig
 }
 
-func NewHandler(service *link.Service) *Handler {
+func NewHandler(service *link.Service, config HandlerConfig) *Handler {
+	if config.DisabledStatus == 0 {
+		config.DisabledStatus = defaultDisabledStatus
+	}
+	if config.BannedStatus == 0 {
+		config.BannedStatus = defaultBannedStatus
+	}
+	if config.BatchMaxOperations == 0 {
+		config.BatchMaxOperations = defaultBatchMaxOperations
+	}
+
 	return &Handler{
 		service: service,
+		config:  config,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *gin.Engine) {
-	router.GET("/r/:code", h.Redirect)
+	limitCreate := RateLimit(h.config.CreateLimiter)
+	limitBulk := RateLimit(h.config.BulkLimiter)
+	limitReport := RateLimit(h.config.ReportLimiter)
+	router.GET("/r/:code", RateLimit(h.config.RedirectLimiter), h.Redirect)
+	router.POST("/r/:code/report", limitReport, h.ReportLink)
+	router.GET("/abuse", h.AbusePage)
+	router.POST("/abuse", limitReport, h.ReportFromPage)
 
 	api := router.Group("/api/links")
 	{
 		api.GET("", h.GetAll)
-		api.POST("", h.Create)
+		api.POST("", limitCreate, h.Create)
+		api.POST("/batch", limitBulk, h.Batch)
+		api.POST("/import", limitBulk, h.Import)
+		api.GET("/import/:job_id", h.GetImport)
+		api.GET("/export", h.ExportLinks)
 		api.GET("/:id", h.GetByID)
 		api.PUT("/:id", h.Update)
+		api.PATCH("/:id", h.Patch)
 		api.DELETE("/:id", h.Delete)
+		api.GET("/:id/visits", h.GetLinkVisits)
+		api.GET("/:id/stats", h.GetStats)
+		api.GET("/:id/health", h.GetHealth)
+		api.POST("/:id/restore", h.Restore)
+		api.POST("/:id/activate", h.SetStatus(linkdomain.StatusActive))
+		api.POST("/:id/disable", h.SetStatus(linkdomain.StatusDisabled))
+		api.POST("/:id/ban", h.SetStatus(linkdomain.StatusBanned))
 	}
 
 	apiVisits := router.Group("/api")
 	{
 		apiVisits.GET("/link_visits", h.GetVisits)
+		apiVisits.GET("/link_visits/export", h.ExportVisits)
+		apiVisits.GET("/link_visits/subject", h.ExportSubjectVisits)
+		apiVisits.DELETE("/link_visits", h.DeleteVisits)
 		apiVisits.DELETE("/link_visits/:id", h.DeleteVisit)
 	}
+
+	apiAbuse := router.Group("/api/abuse_reports")
+	{
+		apiAbuse.GET("", h.GetAbuseReports)
+		apiAbuse.GET("/:id", h.GetAbuseReport)
+		apiAbuse.POST("/:id/dismiss", h.DismissAbuseReport)
+		apiAbuse.POST("/:id/disable", h.DisableReportedLink)
+	}
 }
 
 type CreateLinkRequest struct {
-	OriginalURL string `json:"original_url" binding:"required,url"`
-	ShortName   string `json:"short_name" binding:"omitempty,min=3,max=32"`
+	OriginalURL string   `json:"original_url" binding:"required,url"`
+	ShortName   string   `json:"short_name" binding:"omitempty,min=3,max=32"`
+	Tags        []string `json:"tags" binding:"omitempty,max=20,dive,max=64"`
+	previewFields
+}
+
+// previewFields are the Open Graph overrides accepted wherever a link is
+// created or replaced.
+type previewFields struct {
+	OGTitle       string `json:"og_title" binding:"omitempty,max=200"`
+	OGDescription string `json:"og_description" binding:"omitempty,max=500"`
+	OGImage       string `json:"og_image" binding:"omitempty,url,max=2048"`
+}
+
+func (f previewFields) preview() linkdomain.Preview {
+	return linkdomain.Preview{Title: f.OGTitle, Description: f.OGDescription, Image: f.OGImage}
+}
+
+type SetStatusRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
 }
 
 type ErrorResponse struct {
@@ -59,10 +141,24 @@ type ErrorSingleResponse struct {
 }
 
 type LinkResponse struct {
-	ID          int64  `json:"id"`
-	OriginalURL string `json:"original_url"`
-	ShortName   string `json:"short_name"`
-	ShortURL    string `json:"short_url"`
+	ID             int64    `json:"id"`
+	OriginalURL    string   `json:"original_url"`
+	ShortName      string   `json:"short_name"`
+	ShortURL       string   `json:"short_url"`
+	Status         string   `json:"status"`
+	StatusReason   string   `json:"status_reason,omitempty"`
+	Tags           []string `json:"tags"`
+	OGTitle        string   `json:"og_title"`
+	OGDescription  string   `json:"og_description"`
+	OGImage        string   `json:"og_image"`
+	Title          string   `json:"title"`
+	Description    string   `json:"description"`
+	FaviconURL     string   `json:"favicon_url"`
+	Broken         bool     `json:"broken"`
+	AbuseThreshold int      `json:"abuse_threshold"`
+	ClickCount     int64    `json:"click_count"`
+	LastVisitedAt  *string  `json:"last_visited_at"`
+	DeletedAt      *string  `json:"deleted_at,omitempty"`
 }
 
 type VisitResponse struct {
@@ -73,9 +169,26 @@ type VisitResponse struct {
 	UserAgent string `json:"user_agent"`
 	Referer   string `json:"referer"`
 	Status    int    `json:"status"`
+	Class     string `json:"class"`
 }
 
 func (h *Handler) GetAll(c *gin.Context) {
+	filter, err := linkFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, keyset, err := keysetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if keyset {
+		h.getLinksPage(c, filter, page)
+		return
+	}
+
 	rangeStr := c.Query("range")
 	pagination, err := linkdomain.ParseRange(rangeStr)
 	if err != nil {
@@ -83,14 +196,60 @@ func (h *Handler) GetAll(c *gin.Context) {
 		return
 	}
 
-	links, total, err := h.service.GetAllLinks(c.Request.Context(), pagination.Offset, pagination.Limit)
+	sort, err := linkdomain.ParseSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := countMode(c, linkdomain.CountExact)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	links, total, err := h.service.GetAllLinks(c.Request.Context(), filter, sort, pagination.Offset, pagination.Limit, count)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.Header("Content-Range", pagination.ContentRange(total))
+	h.respondLinks(c, links)
+}
+
+// getLinksPage serves GET /api/links?cursor=..., which always lists newest
+// first and only counts when asked to.
+func (h *Handler) getLinksPage(c *gin.Context, filter linkdomain.LinkFilter, page linkdomain.KeysetPage) {
+	if c.Query("sort") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort is not supported with cursor pagination"})
+		return
+	}
+
+	count, err := countMode(c, linkdomain.CountNone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	links, next, prev, err := h.service.GetLinksPage(ctx, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total, err := h.service.CountLinks(ctx, filter, count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	setCursorHeaders(c, page.Limit, next, prev)
+	setTotalCount(c, total)
+	h.respondLinks(c, links)
+}
+
+func (h *Handler) respondLinks(c *gin.Context, links []*linkdomain.Link) {
 	response := make([]LinkResponse, len(links))
 	for i, l := range links {
 		response[i] = toLinkResponse(l, h.service)
@@ -118,16 +277,21 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
-	linkEntity, err := h.service.CreateLink(c.Request.Context(), req.OriginalURL, req.ShortName)
+	linkEntity, err := h.service.CreateLink(c.Request.Context(), req.OriginalURL, req.ShortName, req.Tags, req.preview())
 	if err != nil {
 		if isUniqueViolation(err) {
 			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{"short_name": "short name already in use"}})
 			return
 		}
+		if field := linkdomain.ErrorField(err); field != "" {
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{field: err.Error()}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", versionETag(linkEntity.Version))
 	c.JSON(http.StatusCreated, toLinkResponse(linkEntity, h.service))
 }
 
@@ -144,6 +308,7 @@ func (h *Handler) GetByID(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", versionETag(linkEntity.Version))
 	c.JSON(http.StatusOK, toLinkResponse(linkEntity, h.service))
 }
 
@@ -154,6 +319,15 @@ func (h *Handler) Update(c *gin.Context) {
 		return
 	}
 
+	if c.GetHeader("If-Match") == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return
+	}
+	version, ok := h.ifMatchVersion(c, id)
+	if !ok {
+		return
+	}
+
 	var req CreateLinkRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		var ve govalidator.ValidationErrors
@@ -172,20 +346,33 @@ func (h *Handler) Update(c *gin.Context) {
 		return
 	}
 
-	linkEntity, err := h.service.UpdateLink(c.Request.Context(), id, req.OriginalURL, req.ShortName)
+	linkEntity, err := h.service.UpdateLink(c.Request.Context(), id, version, req.OriginalURL, req.ShortName, req.Tags, req.preview())
+	h.respondUpdated(c, linkEntity, err)
+}
+
+func (h *Handler) respondUpdated(c *gin.Context, linkEntity *linkdomain.Link, err error) {
 	if err != nil {
-		if strings.Contains(err.Error(), "link not found") {
+		if errors.Is(err, linkdomain.ErrLinkNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
 			return
 		}
+		if errors.Is(err, linkdomain.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
 		if isUniqueViolation(err) {
 			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{"short_name": "short name already in use"}})
 			return
 		}
+		if status, fields := linkErrorFields(err); status == http.StatusUnprocessableEntity {
+			c.JSON(status, ErrorResponse{Errors: fields})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", versionETag(linkEntity.Version))
 	c.JSON(http.StatusOK, toLinkResponse(linkEntity, h.service))
 }
 
@@ -198,7 +385,7 @@ func (h *Handler) Delete(c *gin.Context) {
 
 	err = h.service.DeleteLink(c.Request.Context(), id)
 	if err != nil {
-		if err.Error() == "link not found" {
+		if errors.Is(err, linkdomain.ErrLinkNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
 			return
 		}
@@ -209,6 +396,63 @@ func (h *Handler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func (h *Handler) Restore(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	linkEntity, err := h.service.RestoreLink(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, linkdomain.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLinkResponse(linkEntity, h.service))
+}
+
+// SetStatus returns a handler that moves a link into the given status,
+// recording an optional reason.
+func (h *Handler) SetStatus(status linkdomain.Status) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req SetStatusRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				var ve govalidator.ValidationErrors
+				if errors.As(err, &ve) {
+					c.JSON(http.StatusUnprocessableEntity, validator.FormatValidationErrors(ve))
+					return
+				}
+				c.JSON(http.StatusBadRequest, ErrorSingleResponse{Error: "invalid request"})
+				return
+			}
+		}
+
+		linkEntity, err := h.service.SetLinkStatus(c.Request.Context(), id, status, req.Reason)
+		if err != nil {
+			if errors.Is(err, linkdomain.ErrLinkNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, toLinkResponse(linkEntity, h.service))
+	}
+}
+
 func (h *Handler) Redirect(c *gin.Context) {
 	code := c.Param("code")
 
@@ -217,17 +461,121 @@ func (h *Handler) Redirect(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
 		return
 	}
+	// Lists learn about destinations after links are created, so each
+	// redirect checks again.
+	linkEntity, err = h.service.EnforceBlocklist(c.Request.Context(), linkEntity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	ip := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
 	referer := c.GetHeader("Referer")
+	class := visitClass(c)
 
-	_ = h.service.RecordVisit(c.Request.Context(), linkEntity.ID, ip, userAgent, referer, http.StatusFound)
+	if !linkEntity.IsActive() {
+		status, notice := h.inactiveResponse(linkEntity)
+		_ = h.service.RecordVisit(c.Request.Context(), linkEntity.ID, ip, userAgent, referer, status, class)
+		renderPage(c, status, noticePage, notice)
+		return
+	}
+
+	if class == linkdomain.VisitPreview && !linkEntity.Preview.IsZero() {
+		_ = h.service.RecordVisit(c.Request.Context(), linkEntity.ID, ip, userAgent, referer, http.StatusOK, class)
+		renderPage(c, http.StatusOK, previewPage, previewData{
+			URL:         h.service.GetShortURL(linkEntity),
+			Destination: linkEntity.OriginalURL,
+			Title:       linkEntity.Preview.Title,
+			Description: linkEntity.Preview.Description,
+			Image:       linkEntity.Preview.Image,
+		})
+		return
+	}
+
+	_ = h.service.RecordVisit(c.Request.Context(), linkEntity.ID, ip, userAgent, referer, http.StatusFound, class)
 
 	c.Redirect(http.StatusFound, linkEntity.OriginalURL)
 }
 
+func (h *Handler) inactiveResponse(l *linkdomain.Link) (int, noticeData) {
+	if l.IsBlocklisted() {
+		return h.config.DisabledStatus, noticeData{
+			Title:   "Warning: suspected phishing or malware",
+			Message: "This link has been disabled because its destination was reported as a phishing or malware site. Do not enter passwords or download files from it.",
+		}
+	}
+	if l.IsAbuseDisabled() {
+		return h.config.DisabledStatus, noticeData{
+			Title:   "Link disabled",
+			Message: "This link has been disabled after it was reported for abuse.",
+		}
+	}
+	if l.Status == linkdomain.StatusBanned {
+		return h.config.BannedStatus, noticeData{
+			Title:   "Link removed",
+			Message: "This link has been removed and is no longer available.",
+		}
+	}
+	return h.config.DisabledStatus, noticeData{
+		Title:   "Link disabled",
+		Message: "This link has been temporarily disabled.",
+	}
+}
+
+// visitClass classifies a redirect request. Browsers announce speculative
+// loads with Sec-Purpose, older ones with Purpose.
+func visitClass(c *gin.Context) linkdomain.VisitClass {
+	purpose := c.GetHeader("Sec-Purpose")
+	if purpose == "" {
+		purpose = c.GetHeader("Purpose")
+	}
+	return linkdomain.ClassifyVisit(c.GetHeader("User-Agent"), purpose)
+}
+
 func (h *Handler) GetVisits(c *gin.Context) {
+	filter, err := visitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.listVisits(c, filter)
+}
+
+// GetLinkVisits serves GET /api/links/:id/visits, the visits of one link
+// under the same filters as GET /api/link_visits.
+func (h *Handler) GetLinkVisits(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if _, err := h.service.GetLink(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+
+	filter, err := visitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.LinkID = id
+	h.listVisits(c, filter)
+}
+
+func (h *Handler) listVisits(c *gin.Context, filter linkdomain.VisitFilter) {
+	page, keyset, err := keysetPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if keyset {
+		h.getVisitsPage(c, filter, page)
+		return
+	}
+
 	rangeStr := c.Query("range")
 	pagination, err := linkdomain.ParseRange(rangeStr)
 	if err != nil {
@@ -235,25 +583,50 @@ func (h *Handler) GetVisits(c *gin.Context) {
 		return
 	}
 
-	visits, total, err := h.service.GetVisits(c.Request.Context(), pagination.Offset, pagination.Limit)
+	count, err := countMode(c, linkdomain.CountExact)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	visits, total, err := h.service.GetVisits(c.Request.Context(), filter, pagination.Offset, pagination.Limit, count)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.Header("Content-Range", pagination.ContentRange(total))
+	respondVisits(c, visits)
+}
 
+func (h *Handler) getVisitsPage(c *gin.Context, filter linkdomain.VisitFilter, page linkdomain.KeysetPage) {
+	count, err := countMode(c, linkdomain.CountNone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	visits, next, prev, err := h.service.GetVisitsPage(ctx, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total, err := h.service.CountVisits(ctx, filter, count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setCursorHeaders(c, page.Limit, next, prev)
+	setTotalCount(c, total)
+	respondVisits(c, visits)
+}
+
+func respondVisits(c *gin.Context, visits []*linkdomain.LinkVisit) {
 	response := make([]VisitResponse, len(visits))
 	for i, v := range visits {
-		response[i] = VisitResponse{
-			ID:        v.ID,
-			LinkID:    v.LinkID,
-			CreatedAt: v.CreatedAt.Format(time.RFC3339),
-			IP:        v.IP,
-			UserAgent: v.UserAgent,
-			Referer:   v.Referer,
-			Status:    v.Status,
-		}
+		response[i] = toVisitResponse(v)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -274,6 +647,24 @@ func (h *Handler) DeleteVisit(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func linkErrorFields(err error) (int, map[string]string) {
+	switch {
+	case errors.Is(err, link.ErrBatchAborted):
+		return http.StatusFailedDependency, map[string]string{"batch": err.Error()}
+	case errors.Is(err, linkdomain.ErrLinkNotFound):
+		return http.StatusNotFound, map[string]string{"id": "link not found"}
+	case errors.Is(err, linkdomain.ErrVersionConflict):
+		return http.StatusPreconditionFailed, map[string]string{"version": err.Error()}
+	case errors.Is(err, linkdomain.ErrShortNameExists), isUniqueViolation(err):
+		return http.StatusUnprocessableEntity, map[string]string{"short_name": "short name already in use"}
+	}
+
+	if field := linkdomain.ErrorField(err); field != "" {
+		return http.StatusUnprocessableEntity, map[string]string{field: err.Error()}
+	}
+	return http.StatusInternalServerError, map[string]string{"error": err.Error()}
+}
+
 func isUniqueViolation(err error) bool {
 	var pqErr *pq.Error
 	if errors.As(err, &pqErr) {
@@ -282,11 +673,48 @@ func isUniqueViolation(err error) bool {
 	return false
 }
 
+func toVisitResponse(v *linkdomain.LinkVisit) VisitResponse {
+	return VisitResponse{
+		ID:        v.ID,
+		LinkID:    v.LinkID,
+		CreatedAt: v.CreatedAt.Format(time.RFC3339),
+		IP:        v.IP,
+		UserAgent: v.UserAgent,
+		Referer:   v.Referer,
+		Status:    v.Status,
+		Class:     string(v.Class),
+	}
+}
+
 func toLinkResponse(l *linkdomain.Link, service *link.Service) LinkResponse {
-	return LinkResponse{
-		ID:          l.ID,
-		OriginalURL: l.OriginalURL,
-		ShortName:   l.ShortName,
-		ShortURL:    service.GetShortURL(l),
+	response := LinkResponse{
+		ID:             l.ID,
+		OriginalURL:    l.OriginalURL,
+		ShortName:      l.ShortName,
+		ShortURL:       service.GetShortURL(l),
+		Status:         string(l.Status),
+		StatusReason:   l.StatusReason,
+		Tags:           l.Tags,
+		OGTitle:        l.Preview.Title,
+		OGDescription:  l.Preview.Description,
+		OGImage:        l.Preview.Image,
+		Title:          l.Metadata.Title,
+		Description:    l.Metadata.Description,
+		FaviconURL:     l.Metadata.FaviconURL,
+		Broken:         l.Health.Broken,
+		AbuseThreshold: l.AbuseThreshold,
+		ClickCount:     l.ClickCount,
+	}
+	if response.Tags == nil {
+		response.Tags = []string{}
+	}
+	if l.LastVisitedAt != nil {
+		lastVisitedAt := l.LastVisitedAt.Format(time.RFC3339)
+		response.LastVisitedAt = &lastVisitedAt
+	}
+	if l.DeletedAt != nil {
+		deletedAt := l.DeletedAt.Format(time.RFC3339)
+		response.DeletedAt = &deletedAt
 	}
+	return response
 }
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthResponse struct {
+	LinkID              int64                 `json:"link_id"`
+	Broken              bool                  `json:"broken"`
+	ConsecutiveFailures int                   `json:"consecutive_failures"`
+	LastCheckedAt       *string               `json:"last_checked_at"`
+	Checks              []HealthCheckResponse `json:"checks"`
+}
+
+type HealthCheckResponse struct {
+	CheckedAt     string   `json:"checked_at"`
+	OK            bool     `json:"ok"`
+	StatusCode    int      `json:"status_code"`
+	LatencyMs     int64    `json:"latency_ms"`
+	RedirectChain []string `json:"redirect_chain"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// GetHealth serves GET /api/links/:id/health, the link's standing and its
+// most recent destination checks, newest first.
+func (h *Handler) GetHealth(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	health, err := h.service.GetLinkHealth(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, linkdomain.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toHealthResponse(health))
+}
+
+func toHealthResponse(health *linkdomain.Health) HealthResponse {
+	response := HealthResponse{
+		LinkID:              health.LinkID,
+		Broken:              health.Broken,
+		ConsecutiveFailures: health.ConsecutiveFailures,
+		Checks:              make([]HealthCheckResponse, len(health.Checks)),
+	}
+	if health.CheckedAt != nil {
+		checkedAt := health.CheckedAt.Format(time.RFC3339)
+		response.LastCheckedAt = &checkedAt
+	}
+	for i, check := range health.Checks {
+		redirects := check.RedirectChain
+		if redirects == nil {
+			redirects = []string{}
+		}
+		response.Checks[i] = HealthCheckResponse{
+			CheckedAt:     check.CheckedAt.Format(time.RFC3339),
+			OK:            check.Healthy(),
+			StatusCode:    check.StatusCode,
+			LatencyMs:     check.Latency.Milliseconds(),
+			RedirectChain: redirects,
+			Error:         check.Error,
+		}
+	}
+	return response
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"app/internal/application/link"
+	"app/internal/infrastructure/importer"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxImportSize = 10 << 20
+
+type ImportRowErrorResponse struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+type ImportJobResponse struct {
+	ID         string                   `json:"id"`
+	Status     string                   `json:"status"`
+	DryRun     bool                     `json:"dry_run"`
+	Total      int                      `json:"total"`
+	Processed  int                      `json:"processed"`
+	Imported   int                      `json:"imported"`
+	Failed     int                      `json:"failed"`
+	Errors     []ImportRowErrorResponse `json:"errors"`
+	CreatedAt  string                   `json:"created_at"`
+	FinishedAt *string                  `json:"finished_at,omitempty"`
+}
+
+// Import accepts a CSV or JSON file, either as the "file" field of a
+// multipart form or as the raw request body, and starts a background job.
+// Jobs are kept in memory by the instance that runs them: they cannot be
+// polled through other instances and are lost on restart.
+func (h *Handler) Import(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	body, filename, err := importBody(c)
+	if err != nil {
+		if isTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorSingleResponse{Error: "file too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorSingleResponse{Error: "invalid request"})
+		return
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	reader := bufio.NewReader(body)
+	format := importer.DetectFormat(filename, c.ContentType(), peek(reader))
+	if f := c.Query("format"); f != "" {
+		if format, err = importer.ParseFormat(f); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{"format": err.Error()}})
+			return
+		}
+	}
+
+	rows, err := importer.Parse(reader, format)
+	if err != nil {
+		if isTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorSingleResponse{Error: "file too large"})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: map[string]string{"file": err.Error()}})
+		return
+	}
+
+	job, err := h.service.StartImport(c.Request.Context(), rows, c.Query("dry_run") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/api/links/import/"+job.ID)
+	c.JSON(http.StatusAccepted, toImportJobResponse(job))
+}
+
+func (h *Handler) GetImport(c *gin.Context) {
+	job, ok := h.service.GetImport(c.Param("job_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "import not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toImportJobResponse(job))
+}
+
+func importBody(c *gin.Context) (io.ReadCloser, string, error) {
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return c.Request.Body, "", nil
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	return file, header.Filename, nil
+}
+
+// isTooLarge reports whether err comes from reading past maxImportSize.
+func isTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+func peek(r *bufio.Reader) []byte {
+	head, _ := r.Peek(512)
+	return head
+}
+
+func toImportJobResponse(job *link.ImportJob) ImportJobResponse {
+	response := ImportJobResponse{
+		ID:        job.ID,
+		Status:    string(job.Status),
+		DryRun:    job.DryRun,
+		Total:     job.Total,
+		Processed: job.Processed,
+		Imported:  job.Imported,
+		Failed:    job.Failed,
+		Errors:    make([]ImportRowErrorResponse, len(job.Errors)),
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+	}
+	for i, e := range job.Errors {
+		response.Errors[i] = ImportRowErrorResponse{Row: e.Line, Errors: e.Errors}
+	}
+	if job.FinishedAt != nil {
+		finishedAt := job.FinishedAt.Format(time.RFC3339)
+		response.FinishedAt = &finishedAt
+	}
+	return response
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	linkdomain "app/internal/domain/link"
+	"app/internal/shared/validator"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	govalidator "github.com/go-playground/validator/v10"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// PatchLinkRequest is a JSON Merge Patch (RFC 7396) document for a link.
+// Members that are absent are left untouched.
+type PatchLinkRequest struct {
+	OriginalURL *string   `json:"original_url" binding:"omitempty,url"`
+	ShortName   *string   `json:"short_name" binding:"omitempty,min=3,max=32"`
+	Tags        *[]string `json:"tags" binding:"omitempty,max=20,dive,max=64"`
+	// The preview fields are cleared with null.
+	OGTitle       *string `json:"og_title" binding:"omitempty,max=200"`
+	OGDescription *string `json:"og_description" binding:"omitempty,max=500"`
+	OGImage       *string `json:"og_image" binding:"omitempty,url,max=2048"`
+	// AbuseThreshold overrides the service-wide threshold; 0 restores it.
+	AbuseThreshold *int `json:"abuse_threshold" binding:"omitempty,min=0,max=1000"`
+}
+
+// nonNullableFields may be changed by a patch but never removed.
+var nonNullableFields = []string{"original_url", "short_name", "abuse_threshold"}
+
+func (h *Handler) Patch(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if ct := c.ContentType(); ct != mergePatchContentType && ct != binding.MIMEJSON {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type must be " + mergePatchContentType})
+		return
+	}
+
+	if c.GetHeader("If-Match") == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return
+	}
+	version, ok := h.ifMatchVersion(c, id)
+	if !ok {
+		return
+	}
+
+	req, fieldErrors, err := decodeMergePatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorSingleResponse{Error: "invalid request"})
+		return
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Errors: fieldErrors})
+		return
+	}
+
+	linkEntity, err := h.service.PatchLink(c.Request.Context(), id, version, req.toDomain())
+	h.respondUpdated(c, linkEntity, err)
+}
+
+func decodeMergePatch(c *gin.Context) (*PatchLinkRequest, map[string]string, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, nil, err
+	}
+
+	fieldErrors := make(map[string]string)
+	for _, field := range nonNullableFields {
+		if raw, ok := members[field]; ok && string(raw) == "null" {
+			fieldErrors[field] = "field cannot be null"
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors, nil
+	}
+
+	var req PatchLinkRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, err
+	}
+	if raw, ok := members["tags"]; ok && string(raw) == "null" {
+		req.Tags = &[]string{}
+	}
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		var ve govalidator.ValidationErrors
+		if errors.As(err, &ve) {
+			return nil, validator.FormatValidationErrors(ve).Errors, nil
+		}
+		return nil, nil, err
+	}
+	// Cleared fields are set after validation, which would reject an empty
+	// URL.
+	for field, value := range map[string]**string{
+		"og_title":       &req.OGTitle,
+		"og_description": &req.OGDescription,
+		"og_image":       &req.OGImage,
+	} {
+		if raw, ok := members[field]; ok && string(raw) == "null" {
+			*value = new(string)
+		}
+	}
+
+	return &req, nil, nil
+}
+
+func (r *PatchLinkRequest) toDomain() linkdomain.Patch {
+	return linkdomain.Patch{
+		OriginalURL:        r.OriginalURL,
+		ShortName:          r.ShortName,
+		Tags:               r.Tags,
+		PreviewTitle:       r.OGTitle,
+		PreviewDescription: r.OGDescription,
+		PreviewImage:       r.OGImage,
+		AbuseThreshold:     r.AbuseThreshold,
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsUnsupportedFilters are visit filters that rolled-up days cannot answer.
+var statsUnsupportedFilters = []string{"status", "ip", "referer"}
+
+// StatsResponse reports as clicks the visits that were redirected, which is
+// what a link's click_count counts, and as visits every visit, notice pages
+// and previews included.
+type StatsResponse struct {
+	LinkID       int64                `json:"link_id"`
+	Clicks       int64                `json:"clicks"`
+	Visits       int64                `json:"visits"`
+	Uniques      int64                `json:"uniques"`
+	Days         []DailyStatsResponse `json:"days"`
+	TopReferrers []ReferrerResponse   `json:"top_referrers"`
+}
+
+type DailyStatsResponse struct {
+	Date    string `json:"date"`
+	Clicks  int64  `json:"clicks"`
+	Visits  int64  `json:"visits"`
+	Uniques int64  `json:"uniques"`
+}
+
+type ReferrerResponse struct {
+	Referer string `json:"referer"`
+	Clicks  int64  `json:"clicks"`
+}
+
+// GetStats serves GET /api/links/:id/stats with optional from/to bounds and
+// a class, which defaults to human visits and takes "all" for every visit.
+// Days that were already rolled up are counted whole. Rolled-up days no
+// longer know their visits' status, IP or referer, so filtering on those is
+// refused.
+func (h *Handler) GetStats(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	for _, param := range statsUnsupportedFilters {
+		if _, ok := c.GetQuery(param); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stats cannot be filtered by " + param})
+			return
+		}
+	}
+
+	from, err := queryTime(c, "from", false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := queryTime(c, "to", true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var class linkdomain.VisitClass
+	if value := c.Query("class"); value != "" {
+		if class, err = linkdomain.ParseVisitClass(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	stats, err := h.service.GetLinkStats(c.Request.Context(), id, linkdomain.VisitFilter{From: from, To: to, Class: class})
+	if err != nil {
+		if errors.Is(err, linkdomain.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toStatsResponse(stats))
+}
+
+func toStatsResponse(stats *linkdomain.LinkStats) StatsResponse {
+	response := StatsResponse{
+		LinkID:       stats.LinkID,
+		Clicks:       stats.Redirects,
+		Visits:       stats.Clicks,
+		Uniques:      stats.Uniques,
+		Days:         make([]DailyStatsResponse, len(stats.Days)),
+		TopReferrers: make([]ReferrerResponse, len(stats.TopReferrers)),
+	}
+	for i, d := range stats.Days {
+		response.Days[i] = DailyStatsResponse{
+			Date:    d.Day.Format("2006-01-02"),
+			Clicks:  d.Redirects,
+			Visits:  d.Clicks,
+			Uniques: d.Uniques,
+		}
+	}
+	for i, r := range stats.TopReferrers {
+		response.TopReferrers[i] = ReferrerResponse{Referer: r.Referer, Clicks: r.Clicks}
+	}
+	return response
+}
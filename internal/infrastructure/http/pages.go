@@ -0,0 +1,114 @@
+package http
+
+import (
+	"html/template"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+var noticePage = template.Must(template.New("notice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+// previewPage is served to social crawlers in place of a redirect so that
+// the link unfurls with the link's own preview.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:url" content="{{.URL}}">
+{{- if .Title}}
+<meta property="og:title" content="{{.Title}}">
+<meta name="twitter:title" content="{{.Title}}">
+{{- end}}
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+</head>
+<body>
+<p><a href="{{.Destination}}">{{or .Title .Destination}}</a></p>
+</body>
+</html>
+`))
+
+// abusePage lets anyone report a link. It posts to /abuse, which reads
+// the short URL from the link field.
+var abusePage = template.Must(template.New("abuse").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Report abuse</title>
+</head>
+<body>
+<h1>Report abuse</h1>
+{{- if .Error}}
+<p role="alert">{{.Error}}</p>
+{{- end}}
+<form method="post" action="/abuse">
+<p><label>Short link <input type="text" name="link" value="{{.Link}}" required></label></p>
+<p><label>Reason <select name="reason" required>
+{{- range .Reasons}}
+<option value="{{.}}"{{if eq (print .) $.Reason}} selected{{end}}>{{.}}</option>
+{{- end}}
+</select></label></p>
+<p><label>Details <textarea name="details" maxlength="2000">{{.Details}}</textarea></label></p>
+<p><label>Your email (optional) <input type="email" name="email" value="{{.Email}}"></label></p>
+<p><button type="submit">Send report</button></p>
+</form>
+</body>
+</html>
+`))
+
+type abuseFormData struct {
+	Reasons []linkdomain.AbuseReason
+	Link    string
+	Reason  string
+	Details string
+	Email   string
+	Error   string
+}
+
+type previewData struct {
+	URL         string
+	Destination string
+	Title       string
+	Description string
+	Image       string
+}
+
+type noticeData struct {
+	Title   string
+	Message string
+}
+
+func renderPage(c *gin.Context, status int, page *template.Template, data any) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(c.Writer, data); err != nil {
+		_ = c.Error(err)
+	}
+}
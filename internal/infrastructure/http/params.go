@@ -0,0 +1,101 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryTime parses an optional RFC 3339 timestamp or YYYY-MM-DD date from
+// the query string. Dates used as an upper bound cover the whole day.
+func queryTime(c *gin.Context, key string, upperBound bool) (*time.Time, error) {
+	t, err := linkdomain.ParseFilterTime(c.Query(key), upperBound)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: expected RFC 3339 timestamp or YYYY-MM-DD", key)
+	}
+	return t, nil
+}
+
+// queryID parses an optional positive integer id from the query string.
+func queryID(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s", key)
+	}
+	return id, nil
+}
+
+// linkFilter reads the react-admin filter parameter, with the standalone
+// deleted flag kept for the trash view and a standalone broken flag.
+func linkFilter(c *gin.Context) (linkdomain.LinkFilter, error) {
+	filter, err := linkdomain.ParseFilter(c.Query("filter"))
+	if err != nil {
+		return filter, err
+	}
+	if c.Query("deleted") == "true" {
+		filter.Deleted = true
+	}
+	if value := c.Query("broken"); value != "" {
+		broken, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid broken")
+		}
+		filter.Broken = &broken
+	}
+	return filter, nil
+}
+
+// visitFilter reads the filter parameter and the standalone link_id, from,
+// to, status, ip, referer and class parameters, which take precedence.
+func visitFilter(c *gin.Context) (linkdomain.VisitFilter, error) {
+	filter, err := linkdomain.ParseVisitFilter(c.Query("filter"))
+	if err != nil {
+		return filter, err
+	}
+
+	if id, err := queryID(c, "link_id"); err != nil {
+		return filter, err
+	} else if id != 0 {
+		filter.LinkID = id
+	}
+	if from, err := queryTime(c, "from", false); err != nil {
+		return filter, err
+	} else if from != nil {
+		filter.From = from
+	}
+	if to, err := queryTime(c, "to", true); err != nil {
+		return filter, err
+	} else if to != nil {
+		filter.To = to
+	}
+	if value := c.Query("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status <= 0 {
+			return filter, fmt.Errorf("invalid status")
+		}
+		filter.Status = status
+	}
+	if ip := c.Query("ip"); ip != "" {
+		filter.IP = ip
+	}
+	if referer := c.Query("referer"); referer != "" {
+		filter.Referer = referer
+	}
+	if value := c.Query("class"); value != "" {
+		class, err := linkdomain.ParseVisitClass(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Class = class
+	}
+	return filter, nil
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"app/internal/shared/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authentication middleware identifies callers by setting these context
+// keys, and rate limiting then counts against the caller rather than the
+// address. Request headers are never used directly: anyone can send a
+// fresh API key header with every request.
+const (
+	APIKeyContextKey = "api_key"
+	UserContextKey   = "user"
+)
+
+// RateLimit refuses requests beyond limiter's limit with 429 and reports
+// the caller's bucket in RateLimit-* headers. When the store fails the
+// request goes through, so an outage of a shared store does not take the
+// service down with it. A nil limiter lets everything through.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	if limiter == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limit := limiter.Limit()
+	policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(ceilSeconds(limit.Period))
+	return func(c *gin.Context) {
+		result, err := limiter.Allow(c.Request.Context(), rateLimitKey(c))
+		if err != nil {
+			_ = c.Error(err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorSingleResponse{Error: "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey picks the most specific identity known for the caller.
+// c.ClientIP only reads forwarding headers from the router's trusted
+// proxies.
+func rateLimitKey(c *gin.Context) string {
+	if key := c.GetString(APIKeyContextKey); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:16])
+	}
+	if user := c.GetString(UserContextKey); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + clientNetwork(c.ClientIP())
+}
+
+// clientNetwork keys IPv6 clients by their /64, the block a single
+// subscriber usually holds, so that hopping between its addresses does not
+// open new buckets.
+func clientNetwork(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		if prefix, err := addr.Prefix(64); err == nil {
+			return prefix.String()
+		}
+	}
+	return addr.String()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	linkdomain "app/internal/domain/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeleteVisitsResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// DeleteVisits serves DELETE /api/link_visits, erasing every visit that
+// matches the visit filters. before=... is an exclusive alternative to to=...
+// At least one criterion is required.
+func (h *Handler) DeleteVisits(c *gin.Context) {
+	filter, err := visitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before, err := queryTime(c, "before", false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if before != nil {
+		to := before.Add(-time.Nanosecond)
+		filter.To = &to
+	}
+
+	actor := c.ClientIP()
+	deleted, err := h.service.DeleteVisits(c.Request.Context(), filter, actor)
+	if errors.Is(err, linkdomain.ErrEmptyVisitFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logAudit(linkdomain.AuditVisitsDeleted, actor, filter, deleted)
+	c.JSON(http.StatusOK, DeleteVisitsResponse{Deleted: deleted})
+}
+
+// ExportSubjectVisits serves GET /api/link_visits/subject?ip=..., every
+// visit tied to one IP address in the export formats.
+func (h *Handler) ExportSubjectVisits(c *gin.Context) {
+	ip := c.Query("ip")
+	if ip == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ip is required"})
+		return
+	}
+
+	w, ok := h.startExport(c, "subject_visits", visitExportColumns)
+	if !ok {
+		return
+	}
+
+	actor := c.ClientIP()
+	exported, err := h.service.ExportSubjectVisits(c.Request.Context(), ip, actor, func(v *linkdomain.LinkVisit) error {
+		return w.write(toVisitResponse(v), []string{
+			strconv.FormatInt(v.ID, 10),
+			strconv.FormatInt(v.LinkID, 10),
+			v.CreatedAt.Format(time.RFC3339),
+			v.IP,
+			v.UserAgent,
+			v.Referer,
+			strconv.Itoa(v.Status),
+			string(v.Class),
+		})
+	})
+	w.finish(c, err)
+	if err == nil {
+		h.logAudit(linkdomain.AuditVisitsSubjectExport, actor, linkdomain.VisitFilter{IP: ip}, exported)
+	}
+}
+
+// logAudit mirrors audit log entries to the application log, with IPs in
+// the form they are stored in. Hash candidates are only counted.
+func (h *Handler) logAudit(action, actor string, filter linkdomain.VisitFilter, affected int64) {
+	resolved := h.service.ResolveVisitFilter(filter)
+	candidates := len(resolved.IPs)
+	resolved.IPs = nil
+
+	criteria, _ := json.Marshal(resolved)
+	log.Printf("audit: %s by %s matching %s (%d IP values) affected %d visits", action, actor, criteria, candidates, affected)
+}
@@ -0,0 +1,337 @@
+// Package importer reads links from CSV and JSON files, including the export
+// formats of Bitly and YOURLS, and maps them onto import rows.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"app/internal/domain/link"
+)
+
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported import format")
+	ErrNoURLColumn       = errors.New("no original_url column found")
+	ErrNoRows            = errors.New("no rows found")
+)
+
+// Column aliases in order of preference. Bitly exports use long_url, link
+// and custom_bitlinks; YOURLS uses url and keyword.
+var (
+	urlColumns       = []string{"original_url", "long_url", "url", "destination", "destination_url", "target"}
+	shortNameColumns = []string{"short_name", "keyword", "slug", "custom_bitlinks", "short_url", "shorturl", "bitlink", "link"}
+	tagColumns       = []string{"tags", "tag", "labels"}
+)
+
+// ParseFormat validates a user supplied format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatCSV, FormatJSON:
+		return f, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// DetectFormat guesses the format from the file name, the content type and
+// finally the first non-blank byte of the content.
+func DetectFormat(filename, contentType string, head []byte) Format {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	}
+
+	switch {
+	case strings.Contains(contentType, "json"):
+		return FormatJSON
+	case strings.Contains(contentType, "csv"):
+		return FormatCSV
+	}
+
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return FormatJSON
+	}
+	return FormatCSV
+}
+
+func Parse(r io.Reader, format Format) ([]link.ImportRow, error) {
+	var (
+		rows []link.ImportRow
+		err  error
+	)
+
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(r)
+	case FormatJSON:
+		rows, err = parseJSON(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrNoRows
+	}
+	return rows, nil
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func parseCSV(r io.Reader) ([]link.ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNoRows
+		}
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, string(utf8BOM))
+		}
+		name = normalizeColumn(name)
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+
+	urlIdx := findColumns(columns, urlColumns)
+	if len(urlIdx) == 0 {
+		return nil, ErrNoURLColumn
+	}
+	shortIdx := findColumns(columns, shortNameColumns)
+	tagsIdx := findColumns(columns, tagColumns)
+
+	var rows []link.ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := link.ImportRow{
+			Line:        line,
+			OriginalURL: firstField(record, urlIdx),
+			Tags:        splitTags(firstField(record, tagsIdx)),
+		}
+		row.ShortName, row.Err = shortNameFrom(firstField(record, shortIdx))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseJSON accepts an array of link objects, or an object holding them
+// under "links" either as an array (Bitly) or keyed by id (YOURLS).
+func parseJSON(r io.Reader) ([]link.ImportRow, error) {
+	var doc any
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	items, err := jsonItems(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]link.ImportRow, 0, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid JSON: item %d is not an object", i+1)
+		}
+
+		fields := make(map[string]any, len(obj))
+		for k, v := range obj {
+			name := normalizeColumn(k)
+			if _, ok := fields[name]; !ok {
+				fields[name] = v
+			}
+		}
+
+		row := link.ImportRow{
+			Line:        i + 1,
+			OriginalURL: firstString(findField(fields, urlColumns)),
+			Tags:        stringList(findField(fields, tagColumns)),
+		}
+		row.ShortName, row.Err = shortNameFrom(firstString(findField(fields, shortNameColumns)))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func jsonItems(doc any) ([]any, error) {
+	switch v := doc.(type) {
+	case []any:
+		return v, nil
+	case map[string]any:
+		links, ok := v["links"]
+		if !ok {
+			return []any{v}, nil
+		}
+		switch l := links.(type) {
+		case []any:
+			return l, nil
+		case map[string]any:
+			keys := make([]string, 0, len(l))
+			for k := range l {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			items := make([]any, len(keys))
+			for i, k := range keys {
+				items[i] = l[k]
+			}
+			return items, nil
+		}
+	}
+	return nil, errors.New("invalid JSON: expected an array of links")
+}
+
+func normalizeColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+	return name
+}
+
+// findColumns returns the indexes of all columns matching aliases, most
+// preferred first.
+func findColumns(columns map[string]int, aliases []string) []int {
+	var idx []int
+	for _, alias := range aliases {
+		if i, ok := columns[alias]; ok {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// firstField returns the first non-empty value among the given columns.
+func firstField(record []string, idx []int) string {
+	for _, i := range idx {
+		if i < len(record) {
+			if v := strings.TrimSpace(record[i]); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// findField returns the first non-empty value among the aliased fields.
+func findField(fields map[string]any, aliases []string) any {
+	for _, alias := range aliases {
+		if v, ok := fields[alias]; ok && firstString(v) != "" {
+			return v
+		}
+	}
+	return nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// shortNameFrom extracts a short name from either a bare code or a full
+// short URL such as https://bit.ly/abc. Lists keep their first entry. An
+// empty value means the link gets a generated name, but a URL without a
+// code is an error rather than a reason to make one up.
+func shortNameFrom(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexAny(value, ",; "); i >= 0 {
+		value = value[:i]
+	}
+	if !strings.Contains(value, "/") {
+		return value, nil
+	}
+
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", link.ErrNoShortName, value)
+	}
+	name := path.Base(strings.TrimSuffix(u.Path, "/"))
+	if name == "" || name == "." || name == "/" {
+		return "", fmt.Errorf("%w: %q", link.ErrNoShortName, value)
+	}
+	return name, nil
+}
+
+func splitTags(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|'
+	})
+}
+
+func firstString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []any:
+		if len(val) > 0 {
+			return firstString(val[0])
+		}
+	case json.Number:
+		return val.String()
+	}
+	return ""
+}
+
+func stringList(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return splitTags(val)
+	case []any:
+		list := make([]string, 0, len(val))
+		for _, item := range val {
+			if s := firstString(item); s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
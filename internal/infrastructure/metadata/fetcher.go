@@ -0,0 +1,179 @@
+// Package metadata fetches destination pages and scrapes their title,
+// description and favicon.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"app/internal/domain/link"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	DefaultMaxBytes = 512 * 1024
+	userAgent       = "Mozilla/5.0 (compatible; url-shortener-metadata/1.0)"
+)
+
+var ErrUnexpectedStatus = errors.New("unexpected response status")
+
+// Fetcher reads pages through client, which should refuse internal
+// addresses (see netguard), and never reads more than maxBytes of a body.
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+func NewFetcher(client *http.Client, maxBytes int64) *Fetcher {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &Fetcher{client: client, maxBytes: maxBytes}
+}
+
+// Fetch returns the metadata of the page at rawURL. Pages that are not HTML
+// yield empty metadata rather than an error.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (link.Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return link.Metadata{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return link.Metadata{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return link.Metadata{}, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return link.NewMetadata("", "", ""), nil
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.maxBytes), contentType)
+	if err != nil {
+		return link.Metadata{}, err
+	}
+	page := parseHead(body)
+
+	// The final URL after redirects is what relative links resolve against.
+	base := resp.Request.URL
+	favicon := resolve(base, page.icon)
+	if favicon == "" {
+		favicon = resolve(base, "/favicon.ico")
+	}
+	return link.NewMetadata(page.title, page.description, favicon), nil
+}
+
+type head struct {
+	title       string
+	description string
+	icon        string
+}
+
+// parseHead scans the document up to the body for the title, description
+// and icon, preferring the page's own values over Open Graph ones.
+func parseHead(r io.Reader) head {
+	var (
+		page          head
+		ogTitle       string
+		ogDescription string
+		inTitle       bool
+		title         strings.Builder
+	)
+
+	z := html.NewTokenizer(r)
+	for done := false; !done; {
+		switch z.Next() {
+		case html.ErrorToken:
+			done = true
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				done = true
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+
+			switch string(name) {
+			case "title":
+				inTitle = title.Len() == 0
+			case "body":
+				done = true
+			case "meta":
+				switch strings.ToLower(attrs["name"] + attrs["property"]) {
+				case "description":
+					page.description = attrs["content"]
+				case "og:title":
+					ogTitle = attrs["content"]
+				case "og:description":
+					ogDescription = attrs["content"]
+				}
+			case "link":
+				if page.icon == "" && isIconRel(attrs["rel"]) {
+					page.icon = attrs["href"]
+				}
+			}
+		}
+	}
+
+	page.title = title.String()
+	if strings.TrimSpace(page.title) == "" {
+		page.title = ogTitle
+	}
+	if strings.TrimSpace(page.description) == "" {
+		page.description = ogDescription
+	}
+	return page
+}
+
+func isIconRel(rel string) bool {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == "icon" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve turns ref into an absolute http or https URL, or returns "".
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
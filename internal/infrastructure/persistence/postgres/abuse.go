@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"app/db/sqlc"
+	"app/internal/domain/link"
+)
+
+func (r *LinkRepository) CreateAbuseReport(ctx context.Context, report *link.AbuseReport) error {
+	dbReport, err := r.queries.CreateAbuseReport(ctx, report.LinkID, string(report.Reason), report.Details,
+		report.ReporterEmail, report.ReporterIP, report.ReporterKey, report.CreatedAt)
+	if err != nil {
+		return err
+	}
+	*report = *toDomainAbuseReport(dbReport)
+	return nil
+}
+
+func (r *LinkRepository) GetAbuseReport(ctx context.Context, id int64) (*link.AbuseReport, error) {
+	dbReport, err := r.queries.GetAbuseReport(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, link.ErrAbuseReportNotFound
+		}
+		return nil, err
+	}
+	return toDomainAbuseReport(dbReport), nil
+}
+
+func (r *LinkRepository) GetAbuseReports(ctx context.Context, filter link.AbuseReportFilter, offset, limit int) ([]*link.AbuseReport, error) {
+	where := abuseReportFilterClause(filter)
+	args := append(where.args, limit, offset)
+	query := fmt.Sprintf("SELECT %s FROM abuse_reports%s ORDER BY created_at, id LIMIT $%d OFFSET $%d",
+		sqlc.AbuseReportColumns, where.String(), len(args)-1, len(args))
+
+	rows, err := r.queries.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var reports []*link.AbuseReport
+	for rows.Next() {
+		dbReport, err := sqlc.ScanAbuseReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, toDomainAbuseReport(dbReport))
+	}
+	return reports, rows.Err()
+}
+
+func (r *LinkRepository) CountAbuseReports(ctx context.Context, filter link.AbuseReportFilter) (int, error) {
+	return r.count(ctx, "abuse_reports", abuseReportFilterClause(filter), link.CountExact)
+}
+
+func (r *LinkRepository) CountAbuseReporters(ctx context.Context, linkID int64) (int, error) {
+	return r.queries.CountAbuseReporters(ctx, linkID)
+}
+
+func (r *LinkRepository) ResolveAbuseReport(ctx context.Context, id int64, status link.AbuseReportStatus) (*link.AbuseReport, error) {
+	dbReport, err := r.queries.ResolveAbuseReport(ctx, id, string(status))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Either there is no such report or it is no longer open.
+			if _, err := r.GetAbuseReport(ctx, id); err != nil {
+				return nil, err
+			}
+			return nil, link.ErrAbuseReportResolved
+		}
+		return nil, err
+	}
+	return toDomainAbuseReport(dbReport), nil
+}
+
+func (r *LinkRepository) ResolveLinkAbuseReports(ctx context.Context, linkID int64, status link.AbuseReportStatus) (int64, error) {
+	return r.queries.ResolveLinkAbuseReports(ctx, linkID, string(status))
+}
+
+func toDomainAbuseReport(dbReport sqlc.AbuseReport) *link.AbuseReport {
+	report := &link.AbuseReport{
+		ID:            dbReport.ID,
+		LinkID:        dbReport.LinkID,
+		Reason:        link.AbuseReason(dbReport.Reason),
+		Details:       dbReport.Details,
+		ReporterEmail: dbReport.ReporterEmail,
+		ReporterIP:    dbReport.ReporterIP,
+		ReporterKey:   dbReport.ReporterKey,
+		Status:        link.AbuseReportStatus(dbReport.Status),
+		CreatedAt:     dbReport.CreatedAt,
+	}
+	if dbReport.ResolvedAt.Valid {
+		resolvedAt := dbReport.ResolvedAt.Time
+		report.ResolvedAt = &resolvedAt
+	}
+	return report
+}
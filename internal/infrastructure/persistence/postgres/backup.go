@@ -0,0 +1,362 @@
+package postgres
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	BackupFormat  = "url-shortener-backup"
+	BackupVersion = 1
+
+	restoreBatchSize = 1000
+)
+
+// backupTables lists every table that belongs in a backup, parents before
+// children so that a restore satisfies foreign keys.
+var backupTables = []string{"links", "link_visits", "link_daily_stats", "link_visitor_sketches", "link_health", "abuse_reports", "audit_log"}
+
+// backupKeys orders the backup tables that have no id column, which also
+// have no sequence to reset on restore.
+var backupKeys = map[string]string{
+	"link_daily_stats":      "link_id, day",
+	"link_visitor_sketches": "link_id, day",
+}
+
+// restoreConflictKeys names the primary key of the tables not keyed by id.
+// A restore skips rows whose primary key is taken, and only those: a clash
+// on another unique key such as links.short_name fails the restore.
+var restoreConflictKeys = map[string]string{
+	"link_visits":           "id, created_at",
+	"link_daily_stats":      "link_id, day, class",
+	"link_visitor_sketches": "link_id, day",
+}
+
+// restoreIdentityColumns names, per table, an immutable column that tells
+// whether an existing row with an archived row's id is that same row. Only
+// then is the archived row skipped; otherwise its children would attach to
+// a different parent.
+var restoreIdentityColumns = map[string]string{
+	"links": "created_at",
+}
+
+var (
+	ErrUnsupportedBackup = errors.New("unsupported backup archive")
+	ErrRestoreConflict   = errors.New("archived row conflicts with an existing one")
+)
+
+type backupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tables    []string  `json:"tables"`
+}
+
+type backupRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// BackupStats reports rows per table. For a restore, Skipped counts rows
+// that were already present.
+type BackupStats struct {
+	Rows    map[string]int
+	Skipped map[string]int
+}
+
+func newBackupStats() BackupStats {
+	return BackupStats{Rows: make(map[string]int), Skipped: make(map[string]int)}
+}
+
+// Backup writes a gzip-compressed archive of all tables to w. The archive is
+// NDJSON: a header line followed by one line per row, each row rendered by
+// Postgres' row_to_json so it does not depend on the server version.
+func Backup(ctx context.Context, db *sql.DB, w io.Writer) (BackupStats, error) {
+	stats := newBackupStats()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+
+	header := backupHeader{
+		Format:    BackupFormat,
+		Version:   BackupVersion,
+		CreatedAt: time.Now().UTC(),
+		Tables:    backupTables,
+	}
+	if err := encoder.Encode(header); err != nil {
+		return stats, err
+	}
+
+	for _, table := range backupTables {
+		order, ok := backupKeys[table]
+		if !ok {
+			order = "id"
+		}
+		query := fmt.Sprintf("SELECT row_to_json(t) FROM %s t ORDER BY %s", pq.QuoteIdentifier(table), order)
+		rows, err := tx.QueryContext(ctx, query)
+		if err != nil {
+			return stats, fmt.Errorf("backup %s: %w", table, err)
+		}
+
+		for rows.Next() {
+			var row json.RawMessage
+			if err := rows.Scan(&row); err != nil {
+				_ = rows.Close()
+				return stats, fmt.Errorf("backup %s: %w", table, err)
+			}
+			if err := encoder.Encode(backupRecord{Table: table, Row: row}); err != nil {
+				_ = rows.Close()
+				return stats, err
+			}
+			stats.Rows[table]++
+		}
+		if err := rows.Close(); err != nil {
+			return stats, err
+		}
+		if err := rows.Err(); err != nil {
+			return stats, fmt.Errorf("backup %s: %w", table, err)
+		}
+	}
+
+	return stats, gz.Close()
+}
+
+// Restore loads an archive written by Backup in a single transaction. Rows
+// keep their ids and rows whose id is already taken are skipped, so
+// restoring the same archive twice is a no-op. An archived link whose id or
+// short name belongs to another link fails the whole restore with
+// ErrRestoreConflict. Columns missing from older archives take their
+// defaults.
+func Restore(ctx context.Context, db *sql.DB, r io.Reader) (BackupStats, error) {
+	stats := newBackupStats()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("%w: %v", ErrUnsupportedBackup, err)
+	}
+	defer func() {
+		_ = gz.Close()
+	}()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		return stats, fmt.Errorf("%w: missing header", ErrUnsupportedBackup)
+	}
+	var header backupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != BackupFormat {
+		return stats, fmt.Errorf("%w: not a %s archive", ErrUnsupportedBackup, BackupFormat)
+	}
+	if header.Version > BackupVersion {
+		return stats, fmt.Errorf("%w: version %d is newer than %d", ErrUnsupportedBackup, header.Version, BackupVersion)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	restorer := &tableRestorer{tx: tx, stats: stats, columns: make(map[string][]string)}
+	for scanner.Scan() {
+		var record backupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return stats, fmt.Errorf("%w: %v", ErrUnsupportedBackup, err)
+		}
+		if err := restorer.add(ctx, record); err != nil {
+			return stats, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+	if err := restorer.flush(ctx); err != nil {
+		return stats, err
+	}
+
+	for _, table := range backupTables {
+		if _, ok := backupKeys[table]; ok {
+			continue
+		}
+		if err := resetSequence(ctx, tx, table); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, tx.Commit()
+}
+
+// tableRestorer batches consecutive rows of the same table into a single
+// json_populate_recordset insert.
+type tableRestorer struct {
+	tx      *sql.Tx
+	stats   BackupStats
+	columns map[string][]string
+	table   string
+	batch   []json.RawMessage
+}
+
+func (t *tableRestorer) add(ctx context.Context, record backupRecord) error {
+	if !isBackupTable(record.Table) {
+		return fmt.Errorf("%w: unknown table %q", ErrUnsupportedBackup, record.Table)
+	}
+
+	if record.Table != t.table || len(t.batch) >= restoreBatchSize {
+		if err := t.flush(ctx); err != nil {
+			return err
+		}
+		t.table = record.Table
+	}
+	t.batch = append(t.batch, record.Row)
+	return nil
+}
+
+func (t *tableRestorer) flush(ctx context.Context) error {
+	if len(t.batch) == 0 {
+		return nil
+	}
+
+	columns, err := t.restoreColumns(ctx, t.batch[0])
+	if err != nil {
+		return err
+	}
+
+	rows, err := json.Marshal(t.batch)
+	if err != nil {
+		return err
+	}
+
+	key, ok := restoreConflictKeys[t.table]
+	if !ok {
+		key = "id"
+	}
+	table := pq.QuoteIdentifier(t.table)
+	list := strings.Join(columns, ", ")
+
+	if identity, ok := restoreIdentityColumns[t.table]; ok && slices.Contains(columns, pq.QuoteIdentifier(identity)) {
+		if err := t.checkIdentity(ctx, table, pq.QuoteIdentifier(identity), rows); err != nil {
+			return err
+		}
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM json_populate_recordset(NULL::%s, $1::json) ON CONFLICT (%s) DO NOTHING",
+		table, list, list, table, key)
+
+	result, err := t.tx.ExecContext(ctx, query, string(rows))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("restore %s: %w: %s", t.table, ErrRestoreConflict, pqErr.Detail)
+		}
+		return fmt.Errorf("restore %s: %w", t.table, err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	t.stats.Rows[t.table] += int(inserted)
+	t.stats.Skipped[t.table] += len(t.batch) - int(inserted)
+	t.batch = t.batch[:0]
+	return nil
+}
+
+// checkIdentity fails with ErrRestoreConflict when an archived row's id is
+// held by a different row, telling them apart by the identity column.
+func (t *tableRestorer) checkIdentity(ctx context.Context, table, identity string, rows []byte) error {
+	query := fmt.Sprintf(
+		"SELECT a.id FROM json_populate_recordset(NULL::%s, $1::json) a JOIN %s t ON t.id = a.id WHERE t.%s IS DISTINCT FROM a.%s LIMIT 1",
+		table, table, identity, identity)
+
+	var id int64
+	err := t.tx.QueryRowContext(ctx, query, string(rows)).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return fmt.Errorf("restore %s: %w", t.table, err)
+	default:
+		return fmt.Errorf("restore %s: %w: id %d belongs to a different row", t.table, ErrRestoreConflict, id)
+	}
+}
+
+// restoreColumns returns the columns present both in the archived row and
+// in the current table, so archives from older or newer schemas still load.
+func (t *tableRestorer) restoreColumns(ctx context.Context, sample json.RawMessage) ([]string, error) {
+	existing, ok := t.columns[t.table]
+	if !ok {
+		rows, err := t.tx.QueryContext(ctx,
+			"SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position",
+			t.table)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			existing = append(existing, name)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		t.columns[t.table] = existing
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(sample, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedBackup, err)
+	}
+
+	columns := make([]string, 0, len(existing))
+	for _, name := range existing {
+		if _, ok := fields[name]; ok {
+			columns = append(columns, pq.QuoteIdentifier(name))
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: no known columns for %s", ErrUnsupportedBackup, t.table)
+	}
+	return columns, nil
+}
+
+func resetSequence(ctx context.Context, tx *sql.Tx, table string) error {
+	query := fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)",
+		pq.QuoteIdentifier(table))
+	_, err := tx.ExecContext(ctx, query, table)
+	return err
+}
+
+func isBackupTable(table string) bool {
+	for _, t := range backupTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+const truncateBackupTables = "TRUNCATE links, link_visits, link_daily_stats, link_visitor_sketches, link_health, abuse_reports, audit_log RESTART IDENTITY CASCADE"
+
+func TestBackupRestore(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	execAll(t, db,
+		"INSERT INTO links (id, original_url, short_name) VALUES (1, 'https://example.com/a', 'alpha'), (2, 'https://example.com/b', 'beta')",
+		"INSERT INTO link_visits (link_id, ip, status, created_at) VALUES (1, '203.0.113.1', 302, NOW()), (2, '203.0.113.2', 302, NOW()), (2, '203.0.113.3', 302, NOW())",
+		"INSERT INTO abuse_reports (link_id, reason) VALUES (2, 'spam')",
+	)
+
+	var archive bytes.Buffer
+	stats, err := Backup(ctx, db, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rows["links"] != 2 || stats.Rows["link_visits"] != 3 || stats.Rows["abuse_reports"] != 1 {
+		t.Fatalf("unexpected backup stats %v", stats.Rows)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		execAll(t, db, truncateBackupTables)
+
+		stats, err := Restore(ctx, db, bytes.NewReader(archive.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Rows["links"] != 2 || stats.Rows["link_visits"] != 3 || stats.Rows["abuse_reports"] != 1 {
+			t.Errorf("unexpected restore stats %v", stats.Rows)
+		}
+		if n := queryInt(t, db, "SELECT COUNT(*) FROM link_visits WHERE link_id = 2"); n != 2 {
+			t.Errorf("expected 2 visits of beta, got %d", n)
+		}
+
+		// Sequences continue after the restored ids.
+		if id := queryInt(t, db, "INSERT INTO links (original_url, short_name) VALUES ('https://example.com/c', 'gamma') RETURNING id"); id != 3 {
+			t.Errorf("expected the next link id to be 3, got %d", id)
+		}
+
+		stats, err = Restore(ctx, db, bytes.NewReader(archive.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Rows["links"] != 0 || stats.Skipped["links"] != 2 || stats.Skipped["link_visits"] != 3 {
+			t.Errorf("expected a second restore to skip everything, got %v skipped %v", stats.Rows, stats.Skipped)
+		}
+	})
+
+	t.Run("clashing short name", func(t *testing.T) {
+		execAll(t, db, truncateBackupTables,
+			"INSERT INTO links (id, original_url, short_name) VALUES (7, 'https://example.org/other', 'beta')",
+		)
+
+		_, err := Restore(ctx, db, bytes.NewReader(archive.Bytes()))
+		if !errors.Is(err, ErrRestoreConflict) {
+			t.Fatalf("expected %v, got %v", ErrRestoreConflict, err)
+		}
+		if n := queryInt(t, db, "SELECT COUNT(*) FROM links"); n != 1 {
+			t.Errorf("expected the restore to be rolled back, found %d links", n)
+		}
+		if n := queryInt(t, db, "SELECT COUNT(*) FROM link_visits"); n != 0 {
+			t.Errorf("expected no visits restored, found %d", n)
+		}
+	})
+
+	t.Run("different link with the same id", func(t *testing.T) {
+		execAll(t, db, truncateBackupTables,
+			"INSERT INTO links (id, original_url, short_name, created_at) VALUES (2, 'https://example.org/other', 'other', NOW() - INTERVAL '1 day')",
+		)
+
+		_, err := Restore(ctx, db, bytes.NewReader(archive.Bytes()))
+		if !errors.Is(err, ErrRestoreConflict) {
+			t.Fatalf("expected %v, got %v", ErrRestoreConflict, err)
+		}
+		if n := queryInt(t, db, "SELECT COUNT(*) FROM link_visits WHERE link_id = 2"); n != 0 {
+			t.Errorf("expected no visits attached to the other link, found %d", n)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"app/db/sqlc"
+	"app/internal/domain/link"
+)
+
+// exportBatchSize is how many rows are fetched from the cursor at a time.
+const exportBatchSize = 1000
+
+func (r *LinkRepository) ExportLinks(ctx context.Context, filter link.LinkFilter, fn func(*link.Link) error) error {
+	where := linkFilterClause(filter)
+	query := "SELECT " + sqlc.LinkColumns + " FROM links" + where.String() + " ORDER BY id"
+	return r.streamCursor(ctx, query, where.args, func(rows *sql.Rows) error {
+		dbLink, err := sqlc.ScanLink(rows)
+		if err != nil {
+			return err
+		}
+		return fn(toDomainLink(dbLink))
+	})
+}
+
+func (r *LinkRepository) ExportVisits(ctx context.Context, filter link.VisitFilter, fn func(*link.LinkVisit) error) error {
+	where := visitFilterClause(filter)
+	query := "SELECT " + sqlc.LinkVisitColumns + " FROM link_visits" + where.String() + " ORDER BY created_at, id"
+	return r.streamCursor(ctx, query, where.args, func(rows *sql.Rows) error {
+		dbVisit, err := sqlc.ScanLinkVisit(rows)
+		if err != nil {
+			return err
+		}
+		return fn(toDomainVisit(dbVisit))
+	})
+}
+
+// streamCursor walks query through a server-side cursor inside a read-only
+// transaction so that memory use stays flat however many rows match.
+func (r *LinkRepository) streamCursor(ctx context.Context, query string, args []any, scan func(*sql.Rows) error) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportBatchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			n++
+			if err := scan(rows); err != nil {
+				_ = rows.Close()
+				return err
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
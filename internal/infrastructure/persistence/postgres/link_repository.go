@@ -3,29 +3,63 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"app/db/sqlc"
 	"app/internal/domain/link"
+	"app/internal/shared/hll"
 )
 
 type LinkRepository struct {
+	db      *sql.DB
+	tx      *sql.Tx
 	queries *sqlc.Queries
 }
 
 func NewLinkRepository(db *sql.DB) *LinkRepository {
 	return &LinkRepository{
+		db:      db,
 		queries: sqlc.New(db),
 	}
 }
 
+// InTx runs fn against a repository bound to a single transaction, committing
+// if fn succeeds and rolling back otherwise. Nested calls reuse the outer
+// transaction.
+func (r *LinkRepository) InTx(ctx context.Context, fn func(repo link.Repository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txRepo := &LinkRepository{
+		db:      r.db,
+		tx:      tx,
+		queries: r.queries.WithTx(tx),
+	}
+	if err := fn(txRepo); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (r *LinkRepository) Create(ctx context.Context, linkEntity *link.Link) error {
-	dbLink, err := r.queries.CreateLink(ctx, linkEntity.OriginalURL, linkEntity.ShortName)
+	preview := linkEntity.Preview
+	dbLink, err := r.queries.CreateLink(ctx, linkEntity.OriginalURL, linkEntity.ShortName, nonNilTags(linkEntity.Tags),
+		preview.Title, preview.Description, preview.Image)
 	if err != nil {
 		return err
 	}
-	linkEntity.ID = dbLink.ID
-	linkEntity.CreatedAt = dbLink.CreatedAt
+	*linkEntity = *toDomainLink(dbLink)
 	return nil
 }
 
@@ -33,7 +67,7 @@ func (r *LinkRepository) GetByID(ctx context.Context, id int64) (*link.Link, err
 	dbLink, err := r.queries.GetLinkByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("link not found")
+			return nil, link.ErrLinkNotFound
 		}
 		return nil, err
 	}
@@ -43,42 +77,106 @@ func (r *LinkRepository) GetByID(ctx context.Context, id int64) (*link.Link, err
 func (r *LinkRepository) GetByShortName(ctx context.Context, shortName string) (*link.Link, error) {
 	dbLink, err := r.queries.GetLinkByShortName(ctx, shortName)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, link.ErrLinkNotFound
+		}
 		return nil, err
 	}
 	return toDomainLink(dbLink), nil
 }
 
-func (r *LinkRepository) GetAll(ctx context.Context, offset, limit int) ([]*link.Link, int, error) {
-	total, err := r.count(ctx)
+func (r *LinkRepository) GetAll(ctx context.Context, filter link.LinkFilter, sort link.Sort, offset, limit int) ([]*link.Link, error) {
+	where := linkFilterClause(filter)
+	args := append(where.args, limit, offset)
+	query := fmt.Sprintf("SELECT %s FROM links%s%s LIMIT $%d OFFSET $%d",
+		sqlc.LinkColumns, where.String(), linkOrderBy(sort, filter.Deleted), len(args)-1, len(args))
+	return r.queryLinks(ctx, query, args...)
+}
+
+func (r *LinkRepository) GetLinksPage(ctx context.Context, filter link.LinkFilter, page link.KeysetPage) ([]*link.Link, error) {
+	where := linkFilterClause(filter)
+	query, args := keysetQuery("SELECT "+sqlc.LinkColumns+" FROM links", where, page)
+	return r.queryLinks(ctx, query, args...)
+}
+
+func (r *LinkRepository) CountLinks(ctx context.Context, filter link.LinkFilter, mode link.CountMode) (int, error) {
+	return r.count(ctx, "links", linkFilterClause(filter), mode)
+}
+
+func (r *LinkRepository) queryLinks(ctx context.Context, query string, args ...any) ([]*link.Link, error) {
+	rows, err := r.queries.DB().QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	defer func() {
+		_ = rows.Close()
+	}()
 
-	dbLinks, err := r.queries.GetAllLinks(ctx, offset, limit)
-	if err != nil {
-		return nil, 0, err
+	var links []*link.Link
+	for rows.Next() {
+		dbLink, err := sqlc.ScanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, toDomainLink(dbLink))
 	}
+	return links, rows.Err()
+}
 
-	links := make([]*link.Link, len(dbLinks))
-	for i, dbLink := range dbLinks {
-		links[i] = toDomainLink(dbLink)
+func (r *LinkRepository) Update(ctx context.Context, linkEntity *link.Link) error {
+	preview := linkEntity.Preview
+	dbLink, err := r.queries.UpdateLink(ctx, linkEntity.OriginalURL, linkEntity.ShortName, linkEntity.ID, linkEntity.Version, nonNilTags(linkEntity.Tags),
+		preview.Title, preview.Description, preview.Image, linkEntity.AbuseThreshold)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return r.updateMissError(ctx, linkEntity.ID)
+		}
+		return err
 	}
-	return links, total, nil
+	*linkEntity = *toDomainLink(dbLink)
+	return nil
 }
 
-func (r *LinkRepository) count(ctx context.Context) (int, error) {
-	var total int
-	err := r.queries.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM links").Scan(&total)
-	return total, err
+// updateMissError explains why a conditional update matched no rows: either
+// the link is gone or its version moved on.
+func (r *LinkRepository) updateMissError(ctx context.Context, id int64) error {
+	if _, err := r.queries.GetLinkByID(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return link.ErrLinkNotFound
+		}
+		return err
+	}
+	return link.ErrVersionConflict
 }
 
-func (r *LinkRepository) Update(ctx context.Context, linkEntity *link.Link) error {
-	_, err := r.queries.UpdateLink(ctx, linkEntity.OriginalURL, linkEntity.ShortName, linkEntity.ID)
-	return err
+func (r *LinkRepository) SetStatus(ctx context.Context, id int64, status link.Status, cause link.StatusCause, reason string) (*link.Link, error) {
+	dbLink, err := r.queries.SetLinkStatus(ctx, id, string(status), string(cause), reason)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, link.ErrLinkNotFound
+		}
+		return nil, err
+	}
+	return toDomainLink(dbLink), nil
 }
 
 func (r *LinkRepository) Delete(ctx context.Context, id int64) error {
-	return r.queries.DeleteLink(ctx, id)
+	return r.queries.SoftDeleteLink(ctx, id)
+}
+
+func (r *LinkRepository) Restore(ctx context.Context, id int64) (*link.Link, error) {
+	dbLink, err := r.queries.RestoreLink(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, link.ErrLinkNotFound
+		}
+		return nil, err
+	}
+	return toDomainLink(dbLink), nil
+}
+
+func (r *LinkRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return r.queries.PurgeDeletedLinks(ctx, before)
 }
 
 func (r *LinkRepository) ExistsByShortName(ctx context.Context, shortName string) (bool, error) {
@@ -86,30 +184,241 @@ func (r *LinkRepository) ExistsByShortName(ctx context.Context, shortName string
 }
 
 func (r *LinkRepository) CreateVisit(ctx context.Context, visit *link.LinkVisit) error {
-	_, err := r.queries.CreateLinkVisit(ctx, visit.LinkID, visit.IP, visit.UserAgent, visit.Referer, visit.Status)
+	index, rank := hll.Position(visit.IP)
+	_, err := r.queries.CreateLinkVisit(ctx, visit.LinkID, visit.IP, visit.UserAgent, visit.Referer, visit.Status, string(visit.Class), index, rank)
 	return err
 }
 
-func (r *LinkRepository) GetVisits(ctx context.Context, offset, limit int) ([]*link.LinkVisit, int, error) {
-	total, err := r.queries.CountLinkVisits(ctx)
+func (r *LinkRepository) SetMetadata(ctx context.Context, id int64, originalURL string, metadata link.Metadata) error {
+	fetchedAt := time.Now()
+	if metadata.FetchedAt != nil {
+		fetchedAt = *metadata.FetchedAt
+	}
+	return r.queries.SetLinkMetadata(ctx, id, originalURL, metadata.Title, metadata.Description, metadata.FaviconURL, fetchedAt)
+}
+
+func (r *LinkRepository) GetLinksWithoutMetadata(ctx context.Context, limit int) ([]*link.Link, error) {
+	dbLinks, err := r.queries.GetLinksWithoutMetadata(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]*link.Link, len(dbLinks))
+	for i, dbLink := range dbLinks {
+		links[i] = toDomainLink(dbLink)
+	}
+	return links, nil
+}
+
+func (r *LinkRepository) GetLinksDueForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*link.Link, error) {
+	dbLinks, err := r.queries.GetLinksDueForHealthCheck(ctx, checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]*link.Link, len(dbLinks))
+	for i, dbLink := range dbLinks {
+		links[i] = toDomainLink(dbLink)
+	}
+	return links, nil
+}
+
+func (r *LinkRepository) RecordHealthCheck(ctx context.Context, check *link.HealthCheck, brokenAfter int) (link.HealthStatus, error) {
+	if check.CheckedAt.IsZero() {
+		check.CheckedAt = time.Now()
+	}
+	redirects := check.RedirectChain
+	if redirects == nil {
+		redirects = []string{}
+	}
+	dbStatus, err := r.queries.RecordLinkHealthCheck(ctx, check.LinkID, check.CheckedAt, check.StatusCode,
+		int(check.Latency.Milliseconds()), redirects, check.Error, check.Healthy(), brokenAfter)
 	if err != nil {
-		return nil, 0, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return link.HealthStatus{}, link.ErrLinkNotFound
+		}
+		return link.HealthStatus{}, err
 	}
+	return toDomainHealthStatus(dbStatus.Broken, dbStatus.HealthFailures, dbStatus.HealthCheckedAt), nil
+}
 
-	dbVisits, err := r.queries.GetLinkVisits(ctx, limit, offset)
+func (r *LinkRepository) GetHealthChecks(ctx context.Context, linkID int64, limit int) ([]*link.HealthCheck, error) {
+	dbChecks, err := r.queries.GetLinkHealthChecks(ctx, linkID, limit)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	checks := make([]*link.HealthCheck, len(dbChecks))
+	for i, dbCheck := range dbChecks {
+		checks[i] = &link.HealthCheck{
+			ID:            dbCheck.ID,
+			LinkID:        dbCheck.LinkID,
+			CheckedAt:     dbCheck.CheckedAt,
+			StatusCode:    dbCheck.StatusCode,
+			Latency:       time.Duration(dbCheck.LatencyMs) * time.Millisecond,
+			RedirectChain: dbCheck.RedirectChain,
+			Error:         dbCheck.Error,
+		}
+	}
+	return checks, nil
+}
 
-	visits := make([]*link.LinkVisit, len(dbVisits))
-	for i, dbVisit := range dbVisits {
-		visits[i] = toDomainVisit(dbVisit)
+func (r *LinkRepository) PruneHealthChecks(ctx context.Context, before time.Time) (int64, error) {
+	return r.queries.PruneLinkHealthChecks(ctx, before)
+}
+
+func (r *LinkRepository) ReconcileClickCounts(ctx context.Context) (int64, error) {
+	return r.queries.ReconcileClickCounts(ctx, nil)
+}
+
+func (r *LinkRepository) GetVisits(ctx context.Context, filter link.VisitFilter, offset, limit int) ([]*link.LinkVisit, error) {
+	where := visitFilterClause(filter)
+	args := append(where.args, limit, offset)
+	query := fmt.Sprintf("SELECT %s FROM link_visits%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d",
+		sqlc.LinkVisitColumns, where.String(), len(args)-1, len(args))
+	return r.queryVisits(ctx, query, args...)
+}
+
+func (r *LinkRepository) GetVisitsPage(ctx context.Context, filter link.VisitFilter, page link.KeysetPage) ([]*link.LinkVisit, error) {
+	query, args := keysetQuery("SELECT "+sqlc.LinkVisitColumns+" FROM link_visits", visitFilterClause(filter), page)
+	return r.queryVisits(ctx, query, args...)
+}
+
+func (r *LinkRepository) CountVisits(ctx context.Context, filter link.VisitFilter, mode link.CountMode) (int, error) {
+	return r.count(ctx, "link_visits", visitFilterClause(filter), mode)
+}
+
+func (r *LinkRepository) queryVisits(ctx context.Context, query string, args ...any) ([]*link.LinkVisit, error) {
+	rows, err := r.queries.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
-	return visits, total, nil
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var visits []*link.LinkVisit
+	for rows.Next() {
+		dbVisit, err := sqlc.ScanLinkVisit(rows)
+		if err != nil {
+			return nil, err
+		}
+		visits = append(visits, toDomainVisit(dbVisit))
+	}
+	return visits, rows.Err()
 }
 
 func (r *LinkRepository) DeleteVisit(ctx context.Context, id int64) error {
-	return r.queries.DeleteLinkVisit(ctx, id)
+	var where whereClause
+	where.add("id = $%d", id)
+	_, err := r.deleteVisits(ctx, where)
+	return err
+}
+
+func (r *LinkRepository) DeleteVisits(ctx context.Context, filter link.VisitFilter) (int64, error) {
+	return r.deleteVisits(ctx, visitFilterClause(filter))
+}
+
+// deleteVisits deletes the visits matching where and, in the same
+// transaction, brings the click counters and visitor sketches they were
+// counted in back in line with the visits that are left.
+func (r *LinkRepository) deleteVisits(ctx context.Context, where whereClause) (int64, error) {
+	var deleted int64
+	err := r.InTx(ctx, func(repo link.Repository) error {
+		var err error
+		deleted, err = repo.(*LinkRepository).deleteAndRecount(ctx, where)
+		return err
+	})
+	return deleted, err
+}
+
+type linkDay struct {
+	linkID int64
+	day    time.Time
+}
+
+func (r *LinkRepository) deleteAndRecount(ctx context.Context, where whereClause) (int64, error) {
+	rows, err := r.queries.DB().QueryContext(ctx,
+		`WITH deleted AS (DELETE FROM link_visits`+where.String()+` RETURNING link_id, created_at, class, status)
+		SELECT link_id, created_at::date, COUNT(*), bool_or(class = 'human' AND status BETWEEN 300 AND 399)
+		FROM deleted GROUP BY 1, 2`,
+		where.args...)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var (
+		deleted int64
+		linkIDs []int64
+		days    []linkDay
+	)
+	for rows.Next() {
+		var (
+			d       linkDay
+			n       int64
+			counted bool
+		)
+		if err := rows.Scan(&d.linkID, &d.day, &n, &counted); err != nil {
+			return 0, err
+		}
+		deleted += n
+		if counted {
+			days = append(days, d)
+			if !slices.Contains(linkIDs, d.linkID) {
+				linkIDs = append(linkIDs, d.linkID)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	_ = rows.Close()
+
+	if len(linkIDs) == 0 {
+		return deleted, nil
+	}
+	if _, err := r.queries.ReconcileClickCounts(ctx, linkIDs); err != nil {
+		return 0, err
+	}
+	for _, d := range days {
+		if err := r.resketch(ctx, d); err != nil {
+			return 0, err
+		}
+	}
+	return deleted, nil
+}
+
+// resketch rebuilds a day's visitor sketch from the visits left that day.
+// Only days with raw visits get here: rolled-up days have none to delete.
+func (r *LinkRepository) resketch(ctx context.Context, d linkDay) error {
+	ips, err := r.queries.GetSketchedVisitorIPs(ctx, d.linkID, d.day)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return r.queries.DeleteVisitorSketch(ctx, d.linkID, d.day)
+	}
+
+	sketch := hll.New()
+	for _, ip := range ips {
+		sketch.Add(ip)
+	}
+	return r.queries.SetVisitorSketch(ctx, d.linkID, d.day, sketch.Bytes())
+}
+
+func (r *LinkRepository) RecordAudit(ctx context.Context, entry *link.AuditEntry) error {
+	criteria, err := json.Marshal(entry.Criteria)
+	if err != nil {
+		return err
+	}
+
+	dbEntry, err := r.queries.CreateAuditEntry(ctx, entry.Action, entry.Actor, criteria, entry.Affected)
+	if err != nil {
+		return err
+	}
+	entry.ID = dbEntry.ID
+	entry.CreatedAt = dbEntry.CreatedAt
+	return nil
 }
 
 func toDomainVisit(dbVisit sqlc.LinkVisit) *link.LinkVisit {
@@ -120,15 +429,64 @@ func toDomainVisit(dbVisit sqlc.LinkVisit) *link.LinkVisit {
 		UserAgent: dbVisit.UserAgent,
 		Referer:   dbVisit.Referer,
 		Status:    dbVisit.Status,
+		Class:     link.VisitClass(dbVisit.Class),
 		CreatedAt: dbVisit.CreatedAt,
 	}
 }
 
 func toDomainLink(dbLink sqlc.Link) *link.Link {
-	return &link.Link{
-		ID:          dbLink.ID,
-		OriginalURL: dbLink.OriginalURL,
-		ShortName:   dbLink.ShortName,
-		CreatedAt:   dbLink.CreatedAt,
+	l := &link.Link{
+		ID:             dbLink.ID,
+		OriginalURL:    dbLink.OriginalURL,
+		ShortName:      dbLink.ShortName,
+		CreatedAt:      dbLink.CreatedAt,
+		Status:         link.Status(dbLink.Status),
+		StatusReason:   dbLink.StatusReason,
+		StatusCause:    link.StatusCause(dbLink.StatusCause),
+		Version:        dbLink.Version,
+		Tags:           dbLink.Tags,
+		ClickCount:     dbLink.ClickCount,
+		AbuseThreshold: dbLink.AbuseThreshold,
+		Preview: link.Preview{
+			Title:       dbLink.OGTitle,
+			Description: dbLink.OGDescription,
+			Image:       dbLink.OGImage,
+		},
+		Metadata: link.Metadata{
+			Title:       dbLink.Title,
+			Description: dbLink.Description,
+			FaviconURL:  dbLink.FaviconURL,
+		},
+	}
+	if dbLink.DeletedAt.Valid {
+		deletedAt := dbLink.DeletedAt.Time
+		l.DeletedAt = &deletedAt
+	}
+	if dbLink.LastVisitedAt.Valid {
+		lastVisitedAt := dbLink.LastVisitedAt.Time
+		l.LastVisitedAt = &lastVisitedAt
+	}
+	if dbLink.MetadataFetchedAt.Valid {
+		fetchedAt := dbLink.MetadataFetchedAt.Time
+		l.Metadata.FetchedAt = &fetchedAt
+	}
+	l.Health = toDomainHealthStatus(dbLink.Broken, dbLink.HealthFailures, dbLink.HealthCheckedAt)
+	return l
+}
+
+func toDomainHealthStatus(broken bool, failures int, checkedAt sql.NullTime) link.HealthStatus {
+	status := link.HealthStatus{Broken: broken, ConsecutiveFailures: failures}
+	if checkedAt.Valid {
+		t := checkedAt.Time
+		status.CheckedAt = &t
+	}
+	return status
+}
+
+// nonNilTags keeps pq from sending NULL for the NOT NULL tags column.
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
 	}
+	return tags
 }
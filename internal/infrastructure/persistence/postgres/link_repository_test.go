@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"app/internal/domain/link"
+	"app/internal/shared/hll"
+)
+
+func TestDeleteVisitsRecounts(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	repo := NewLinkRepository(db)
+
+	execAll(t, db, "INSERT INTO links (id, original_url, short_name) VALUES (1, 'https://example.com', 'alpha')")
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.2"} {
+		visit := &link.LinkVisit{LinkID: 1, IP: ip, Status: http.StatusFound, Class: link.VisitHuman}
+		if err := repo.CreateVisit(ctx, visit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := repo.DeleteVisits(ctx, link.VisitFilter{IP: "203.0.113.2"})
+	if err != nil || deleted != 2 {
+		t.Fatalf("expected 2 visits deleted, got %d (%v)", deleted, err)
+	}
+	if n := queryInt(t, db, "SELECT click_count FROM links WHERE id = 1"); n != 1 {
+		t.Errorf("expected 1 click left, got %d", n)
+	}
+
+	sketches, err := repo.GetVisitorSketches(ctx, 1, nil, nil)
+	if err != nil || len(sketches) != 1 {
+		t.Fatalf("expected one day's sketch, got %d (%v)", len(sketches), err)
+	}
+	sketch, err := hll.FromBytes(sketches[0].Sketch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := sketch.Estimate(); n != 1 {
+		t.Errorf("expected 1 visitor left in the sketch, got %d", n)
+	}
+
+	if _, err := repo.DeleteVisits(ctx, link.VisitFilter{LinkID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM link_visitor_sketches"); n != 0 {
+		t.Errorf("expected the emptied day's sketch removed, got %d", n)
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM links WHERE click_count = 0 AND last_visited_at IS NULL"); n != 1 {
+		t.Error("expected the counters reset")
+	}
+}
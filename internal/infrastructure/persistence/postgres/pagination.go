@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"app/internal/domain/link"
+)
+
+// keysetQuery appends the cursor condition, ordering and limit for a
+// newest-first (created_at, id) listing. Backward pages are read in
+// ascending order and flipped back by an outer query.
+func keysetQuery(selectFrom string, where whereClause, page link.KeysetPage) (string, []any) {
+	order := " ORDER BY created_at DESC, id DESC"
+	if cursor := page.Cursor; cursor != nil {
+		if cursor.Backward {
+			where.add("(created_at, id) > ($%d, $%d)", cursor.CreatedAt, cursor.ID)
+			order = " ORDER BY created_at, id"
+		} else {
+			where.add("(created_at, id) < ($%d, $%d)", cursor.CreatedAt, cursor.ID)
+		}
+	}
+
+	args := append(where.args, page.Limit+1)
+	query := fmt.Sprintf("%s%s%s LIMIT $%d", selectFrom, where.String(), order, len(args))
+	if page.Cursor != nil && page.Cursor.Backward {
+		query = fmt.Sprintf("SELECT * FROM (%s) page ORDER BY created_at DESC, id DESC", query)
+	}
+	return query, args
+}
+
+// count returns the number of rows in table matching where. Estimated counts
+// come from the planner, which avoids scanning large tables.
+func (r *LinkRepository) count(ctx context.Context, table string, where whereClause, mode link.CountMode) (int, error) {
+	switch mode {
+	case link.CountNone:
+		return -1, nil
+	case link.CountEstimated:
+		return r.estimate(ctx, "SELECT 1 FROM "+table+where.String(), where.args...)
+	}
+
+	var total int
+	err := r.queries.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+where.String(), where.args...).Scan(&total)
+	return total, err
+}
+
+func (r *LinkRepository) estimate(ctx context.Context, query string, args ...any) (int, error) {
+	var raw []byte
+	if err := r.queries.DB().QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&raw); err != nil {
+		return 0, err
+	}
+
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil {
+		return 0, err
+	}
+	if len(plans) == 0 {
+		return 0, fmt.Errorf("empty query plan")
+	}
+	return int(plans[0].Plan.Rows), nil
+}
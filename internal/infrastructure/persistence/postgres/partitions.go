@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"app/internal/domain/link"
+
+	"github.com/lib/pq"
+)
+
+const (
+	visitPartitionPrefix  = "link_visits_"
+	visitDefaultPartition = "link_visits_default"
+	visitPartitionLayout  = "2006_01"
+
+	// VisitPartitionsAhead is how many months after the current one get a
+	// partition in advance.
+	VisitPartitionsAhead = 3
+)
+
+// VisitPartitions maintains the monthly partitions of link_visits.
+type VisitPartitions struct {
+	repo *LinkRepository
+}
+
+func NewVisitPartitions(db *sql.DB) *VisitPartitions {
+	return &VisitPartitions{repo: NewLinkRepository(db)}
+}
+
+type PartitionReport struct {
+	Created []string
+	Dropped []string
+	// Moved counts rows moved out of the default partition.
+	Moved int64
+}
+
+// Maintain makes sure the months from now to VisitPartitionsAhead months
+// later have partitions, moves rows that fell into the default partition
+// into their own month, and drops months that ended before expireBefore
+// once their visits are rolled up into daily stats. A zero expireBefore
+// keeps every partition.
+func (p *VisitPartitions) Maintain(ctx context.Context, now, expireBefore time.Time) (PartitionReport, error) {
+	var report PartitionReport
+
+	existing, err := p.partitions(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	stray, err := p.defaultMonths(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, month := range stray {
+		moved, err := p.moveFromDefault(ctx, month, !existing[month])
+		if err != nil {
+			return report, err
+		}
+		if !existing[month] {
+			existing[month] = true
+			report.Created = append(report.Created, partitionName(month))
+		}
+		report.Moved += moved
+	}
+
+	current := monthStart(now)
+	for i := 0; i <= VisitPartitionsAhead; i++ {
+		month := current.AddDate(0, i, 0)
+		if existing[month] {
+			continue
+		}
+		if _, err := p.repo.queries.DB().ExecContext(ctx, createPartitionSQL(month)); err != nil {
+			return report, err
+		}
+		existing[month] = true
+		report.Created = append(report.Created, partitionName(month))
+	}
+
+	if expireBefore.IsZero() {
+		return report, nil
+	}
+	cutoff := expireBefore.UTC().Truncate(oneDay)
+	for month := range existing {
+		if month.AddDate(0, 1, 0).After(cutoff) {
+			continue
+		}
+		if err := p.drop(ctx, month); err != nil {
+			return report, err
+		}
+		report.Dropped = append(report.Dropped, partitionName(month))
+	}
+	return report, nil
+}
+
+// partitions returns the months that have a partition.
+func (p *VisitPartitions) partitions(ctx context.Context) (map[time.Time]bool, error) {
+	rows, err := p.repo.queries.DB().QueryContext(ctx, `SELECT c.relname
+		FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'link_visits'::regclass`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	months := make(map[time.Time]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		month, err := time.Parse(visitPartitionLayout, strings.TrimPrefix(name, visitPartitionPrefix))
+		if err != nil || !strings.HasPrefix(name, visitPartitionPrefix) {
+			continue
+		}
+		months[month] = true
+	}
+	return months, rows.Err()
+}
+
+// defaultMonths returns the months of the rows in the default partition.
+func (p *VisitPartitions) defaultMonths(ctx context.Context) ([]time.Time, error) {
+	rows, err := p.repo.queries.DB().QueryContext(ctx,
+		"SELECT DISTINCT date_trunc('month', created_at) FROM "+visitDefaultPartition)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var months []time.Time
+	for rows.Next() {
+		var month time.Time
+		if err := rows.Scan(&month); err != nil {
+			return nil, err
+		}
+		months = append(months, monthStart(month))
+	}
+	return months, rows.Err()
+}
+
+// moveFromDefault moves a month's rows out of the default partition,
+// creating the month's partition first if needed. Postgres refuses to
+// create a partition while the default still holds rows in its range.
+func (p *VisitPartitions) moveFromDefault(ctx context.Context, month time.Time, create bool) (int64, error) {
+	var moved int64
+	err := p.repo.InTx(ctx, func(repo link.Repository) error {
+		db := repo.(*LinkRepository).queries.DB()
+		where := visitRangeClause(month, month.AddDate(0, 1, 0))
+
+		if _, err := db.ExecContext(ctx,
+			"CREATE TEMP TABLE link_visits_moving (LIKE link_visits) ON COMMIT DROP"); err != nil {
+			return err
+		}
+		result, err := db.ExecContext(ctx,
+			"WITH moved AS (DELETE FROM "+visitDefaultPartition+where.String()+" RETURNING *) "+
+				"INSERT INTO link_visits_moving SELECT * FROM moved", where.args...)
+		if err != nil {
+			return err
+		}
+		if moved, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		if create {
+			if _, err := db.ExecContext(ctx, createPartitionSQL(month)); err != nil {
+				return err
+			}
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO link_visits SELECT * FROM link_visits_moving")
+		return err
+	})
+	return moved, err
+}
+
+// drop rolls a month's remaining visits up into daily stats and drops its
+// partition, which is far cheaper than deleting the rows.
+func (p *VisitPartitions) drop(ctx context.Context, month time.Time) error {
+	return p.repo.InTx(ctx, func(repo link.Repository) error {
+		txRepo := repo.(*LinkRepository)
+		if err := txRepo.aggregateRange(ctx, visitRangeClause(month, month.AddDate(0, 1, 0))); err != nil {
+			return err
+		}
+		_, err := txRepo.queries.DB().ExecContext(ctx, "DROP TABLE "+pq.QuoteIdentifier(partitionName(month)))
+		return err
+	})
+}
+
+func createPartitionSQL(month time.Time) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF link_visits FOR VALUES FROM (%s) TO (%s)",
+		pq.QuoteIdentifier(partitionName(month)),
+		pq.QuoteLiteral(month.Format(time.DateOnly)),
+		pq.QuoteLiteral(month.AddDate(0, 1, 0).Format(time.DateOnly)))
+}
+
+func partitionName(month time.Time) string {
+	return visitPartitionPrefix + month.Format(visitPartitionLayout)
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
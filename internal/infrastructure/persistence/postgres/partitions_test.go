@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVisitPartitionsMaintain(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	partitions := NewVisitPartitions(db)
+
+	// The migration partitions the current month and the next three, so
+	// both of these land in the default partition.
+	now := time.Now().UTC()
+	past := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	future := monthStart(now).AddDate(0, 8, 3)
+
+	execAll(t, db, "INSERT INTO links (id, original_url, short_name) VALUES (1, 'https://example.com', 'alpha')")
+	for _, at := range []time.Time{past, past.Add(time.Hour), future} {
+		if _, err := db.Exec("INSERT INTO link_visits (link_id, ip, status, created_at) VALUES (1, '203.0.113.1', 302, $1)", at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM "+visitDefaultPartition); n != 3 {
+		t.Fatalf("expected 3 visits in the default partition, got %d", n)
+	}
+
+	report, err := partitions.Maintain(ctx, now, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Moved != 3 {
+		t.Errorf("expected 3 visits moved, got %d", report.Moved)
+	}
+	for _, name := range []string{partitionName(monthStart(past)), partitionName(monthStart(future))} {
+		if !slices.Contains(report.Created, name) {
+			t.Errorf("expected %s in created partitions %v", name, report.Created)
+		}
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM "+visitDefaultPartition); n != 0 {
+		t.Errorf("expected an empty default partition, got %d visits", n)
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM "+partitionName(monthStart(past))); n != 2 {
+		t.Errorf("expected 2 visits in %s, got %d", partitionName(monthStart(past)), n)
+	}
+
+	report, err = partitions.Maintain(ctx, now, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Moved != 0 || len(report.Created) != 0 {
+		t.Errorf("expected a second run to do nothing, got %+v", report)
+	}
+
+	report, err = partitions.Maintain(ctx, now, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Dropped, []string{partitionName(monthStart(past))}) {
+		t.Errorf("expected only %s dropped, got %v", partitionName(monthStart(past)), report.Dropped)
+	}
+	if n := queryInt(t, db, "SELECT COALESCE(SUM(clicks), 0) FROM link_daily_stats WHERE link_id = 1 AND day = $1", past.Format(time.DateOnly)); n != 2 {
+		t.Errorf("expected the dropped visits rolled up into 2 clicks, got %d", n)
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM link_visits"); n != 1 {
+		t.Errorf("expected 1 visit left, got %d", n)
+	}
+}
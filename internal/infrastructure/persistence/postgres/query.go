@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"app/internal/domain/link"
+
+	"github.com/lib/pq"
+)
+
+// whereClause collects AND-ed conditions with positional arguments. Each
+// %d in a condition is replaced by the number of the matching argument.
+type whereClause struct {
+	conditions []string
+	args       []any
+}
+
+func (w *whereClause) add(condition string, args ...any) {
+	numbers := make([]any, len(args))
+	for i, arg := range args {
+		w.args = append(w.args, arg)
+		numbers[i] = len(w.args)
+	}
+	if len(numbers) > 0 {
+		condition = fmt.Sprintf(condition, numbers...)
+	}
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *whereClause) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+func linkFilterClause(filter link.LinkFilter) whereClause {
+	var where whereClause
+	if filter.Deleted {
+		where.add("deleted_at IS NOT NULL")
+	} else {
+		where.add("deleted_at IS NULL")
+	}
+	if len(filter.IDs) > 0 {
+		where.add("id = ANY($%d)", pq.Array(filter.IDs))
+	}
+	if filter.Query != "" {
+		where.add("(original_url ILIKE $%d OR short_name ILIKE $%[1]d)", containsPattern(filter.Query))
+	}
+	if filter.OriginalURL != "" {
+		where.add("original_url ILIKE $%d", containsPattern(filter.OriginalURL))
+	}
+	if filter.ShortName != "" {
+		where.add("short_name ILIKE $%d", containsPattern(filter.ShortName))
+	}
+	if len(filter.Tags) > 0 {
+		where.add("tags @> $%d", pq.Array(filter.Tags))
+	}
+	if filter.CreatedFrom != nil {
+		where.add("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		where.add("created_at <= $%d", *filter.CreatedTo)
+	}
+	if filter.Broken != nil {
+		where.add("broken = $%d", *filter.Broken)
+	}
+	return where
+}
+
+func visitFilterClause(filter link.VisitFilter) whereClause {
+	var where whereClause
+	if filter.LinkID != 0 {
+		where.add("link_id = $%d", filter.LinkID)
+	}
+	if filter.From != nil {
+		where.add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		where.add("created_at <= $%d", *filter.To)
+	}
+	if filter.Status != 0 {
+		where.add("status = $%d", filter.Status)
+	}
+	if filter.IP != "" {
+		where.add("ip = $%d", filter.IP)
+	}
+	if len(filter.IPs) > 0 {
+		where.add("ip = ANY($%d)", pq.Array(filter.IPs))
+	}
+	if filter.Referer != "" {
+		where.add("referer ILIKE $%d", containsPattern(filter.Referer))
+	}
+	if filter.HasClass() {
+		where.add("class = $%d", string(filter.Class))
+	}
+	return where
+}
+
+func abuseReportFilterClause(filter link.AbuseReportFilter) whereClause {
+	var where whereClause
+	if filter.LinkID != 0 {
+		where.add("link_id = $%d", filter.LinkID)
+	}
+	if filter.Status != "" {
+		where.add("status = $%d", string(filter.Status))
+	}
+	return where
+}
+
+// linkOrderBy turns a sort into an ORDER BY clause. Columns come from the
+// domain's allow-list, and id breaks ties so pages are stable.
+func linkOrderBy(sort link.Sort, deleted bool) string {
+	if sort.Field == "" {
+		if deleted {
+			return " ORDER BY deleted_at DESC, id"
+		}
+		return " ORDER BY id"
+	}
+
+	direction := "ASC"
+	if sort.Desc {
+		direction = "DESC"
+	}
+	if sort.Field == link.SortByID {
+		return " ORDER BY id " + direction
+	}
+	return " ORDER BY " + pq.QuoteIdentifier(string(sort.Field)) + " " + direction + " NULLS LAST, id"
+}
+
+// containsPattern builds an ILIKE pattern matching value anywhere, with
+// LIKE wildcards in value taken literally.
+func containsPattern(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return "%" + escaped + "%"
+}
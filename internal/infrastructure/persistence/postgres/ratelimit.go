@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"app/db/sqlc"
+	"app/internal/shared/ratelimit"
+)
+
+// RateLimitStore keeps token buckets in the rate_limits table so that every
+// instance of the service spends from the same buckets. Bucket levels are
+// computed with the database clock.
+type RateLimitStore struct {
+	queries *sqlc.Queries
+}
+
+func NewRateLimitStore(db *sql.DB) *RateLimitStore {
+	return &RateLimitStore{queries: sqlc.New(db)}
+}
+
+func (s *RateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds()
+
+	tokens, err := s.queries.TakeRateLimitToken(ctx, key, capacity, rate)
+	if err == nil {
+		return ratelimit.NewResult(limit, tokens, true), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return ratelimit.Result{}, err
+	}
+
+	tokens, err = s.queries.GetRateLimitTokens(ctx, key, capacity, rate)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.NewResult(limit, tokens, false), nil
+}
+
+// Prune deletes buckets idle for longer than idle. Buckets idle for a full
+// period are full again and no different from missing ones.
+func (s *RateLimitStore) Prune(ctx context.Context, idle time.Duration) (int64, error) {
+	return s.queries.PruneRateLimits(ctx, idle.Seconds())
+}
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"app/internal/domain/link"
+
+	"github.com/lib/pq"
+)
+
+const oneDay = 24 * time.Hour
+
+// dailyAggregateQuery groups the visits matching where by link, UTC day and
+// class into the columns of link_daily_stats, keeping the busiest referrers.
+func dailyAggregateQuery(where string) string {
+	return fmt.Sprintf(`WITH visits AS (
+		SELECT link_id, created_at::date AS day, class, status, ip, COALESCE(NULLIF(referer, ''), %[2]s) AS referer
+		FROM link_visits%[1]s
+	), referers AS (
+		SELECT link_id, day, class, referer, COUNT(*) AS hits,
+			ROW_NUMBER() OVER (PARTITION BY link_id, day, class ORDER BY COUNT(*) DESC, referer) AS rank
+		FROM visits
+		GROUP BY link_id, day, class, referer
+	)
+	SELECT v.link_id, v.day, v.class, COUNT(*) AS clicks,
+		COUNT(*) FILTER (WHERE v.status BETWEEN 300 AND 399) AS redirects, COUNT(DISTINCT v.ip) AS uniques,
+		COALESCE((
+			SELECT jsonb_object_agg(r.referer, r.hits) FROM referers r
+			WHERE r.link_id = v.link_id AND r.day = v.day AND r.class = v.class AND r.rank <= %[3]d
+		), '{}') AS referrers
+	FROM visits v
+	GROUP BY v.link_id, v.day, v.class`, where, pq.QuoteLiteral(link.DirectReferer), link.TopReferrersLimit)
+}
+
+func (r *LinkRepository) GetDailyStats(ctx context.Context, filter link.VisitFilter) ([]*link.DailyStats, error) {
+	raw := visitFilterClause(link.VisitFilter{LinkID: filter.LinkID, From: filter.From, To: filter.To, Class: filter.Class})
+
+	rolled := whereClause{args: append([]any(nil), raw.args...)}
+	if filter.LinkID != 0 {
+		rolled.add("link_id = $%d", filter.LinkID)
+	}
+	if filter.From != nil {
+		rolled.add("day >= $%d::date", *filter.From)
+	}
+	if filter.To != nil {
+		rolled.add("day <= $%d::date", *filter.To)
+	}
+	if filter.HasClass() {
+		rolled.add("class = $%d", string(filter.Class))
+	}
+
+	query := dailyAggregateQuery(raw.String()) +
+		" UNION ALL SELECT link_id, day, class, clicks, redirects, uniques, referrers FROM link_daily_stats" + rolled.String() +
+		" ORDER BY day"
+
+	rows, err := r.queries.DB().QueryContext(ctx, query, rolled.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var stats []*link.DailyStats
+	for rows.Next() {
+		var (
+			d         link.DailyStats
+			referrers []byte
+		)
+		if err := rows.Scan(&d.LinkID, &d.Day, &d.Class, &d.Clicks, &d.Redirects, &d.Uniques, &referrers); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(referrers, &d.Referrers); err != nil {
+			return nil, err
+		}
+		stats = append(stats, &d)
+	}
+	return stats, rows.Err()
+}
+
+func (r *LinkRepository) GetVisitorSketches(ctx context.Context, linkID int64, from, to *time.Time) ([]*link.VisitorSketch, error) {
+	var where whereClause
+	where.add("link_id = $%d", linkID)
+	if from != nil {
+		where.add("day >= $%d::date", *from)
+	}
+	if to != nil {
+		where.add("day <= $%d::date", *to)
+	}
+
+	rows, err := r.queries.DB().QueryContext(ctx,
+		"SELECT link_id, day, sketch FROM link_visitor_sketches"+where.String()+" ORDER BY day", where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var sketches []*link.VisitorSketch
+	for rows.Next() {
+		var s link.VisitorSketch
+		if err := rows.Scan(&s.LinkID, &s.Day, &s.Sketch); err != nil {
+			return nil, err
+		}
+		sketches = append(sketches, &s)
+	}
+	return sketches, rows.Err()
+}
+
+// RollupVisits works through the expired visits one day at a time so that
+// each transaction stays small however large the backlog is.
+func (r *LinkRepository) RollupVisits(ctx context.Context, before time.Time) (int64, error) {
+	cutoff := before.UTC().Truncate(oneDay)
+
+	var total int64
+	for {
+		var oldest sql.NullTime
+		err := r.queries.DB().QueryRowContext(ctx,
+			"SELECT MIN(created_at) FROM link_visits WHERE created_at < $1", cutoff).Scan(&oldest)
+		if err != nil {
+			return total, err
+		}
+		if !oldest.Valid {
+			return total, nil
+		}
+
+		from := oldest.Time.UTC().Truncate(oneDay)
+		to := from.Add(oneDay)
+		if to.After(cutoff) {
+			to = cutoff
+		}
+
+		var n int64
+		err = r.InTx(ctx, func(repo link.Repository) error {
+			var err error
+			n, err = repo.(*LinkRepository).rollupRange(ctx, from, to)
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+}
+
+func (r *LinkRepository) rollupRange(ctx context.Context, from, to time.Time) (int64, error) {
+	where := visitRangeClause(from, to)
+	if err := r.aggregateRange(ctx, where); err != nil {
+		return 0, err
+	}
+
+	result, err := r.queries.DB().ExecContext(ctx, "DELETE FROM link_visits"+where.String(), where.args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// aggregateRange adds the visits matching where to link_daily_stats,
+// merging with days that already have an aggregate.
+func (r *LinkRepository) aggregateRange(ctx context.Context, where whereClause) error {
+	insert := `INSERT INTO link_daily_stats (link_id, day, class, clicks, redirects, uniques, referrers) ` +
+		dailyAggregateQuery(where.String()) + fmt.Sprintf(`
+		ON CONFLICT (link_id, day, class) DO UPDATE SET
+			clicks = link_daily_stats.clicks + EXCLUDED.clicks,
+			redirects = link_daily_stats.redirects + EXCLUDED.redirects,
+			uniques = link_daily_stats.uniques + EXCLUDED.uniques,
+			referrers = (
+				SELECT COALESCE(jsonb_object_agg(key, hits), '{}') FROM (
+					SELECT key, SUM(value::bigint) AS hits
+					FROM (
+						SELECT * FROM jsonb_each_text(link_daily_stats.referrers)
+						UNION ALL
+						SELECT * FROM jsonb_each_text(EXCLUDED.referrers)
+					) merged
+					GROUP BY key
+					ORDER BY hits DESC, key
+					LIMIT %d
+				) top
+			)`, link.TopReferrersLimit)
+
+	_, err := r.queries.DB().ExecContext(ctx, insert, where.args...)
+	return err
+}
+
+// visitRangeClause matches visits created in [from, to).
+func visitRangeClause(from, to time.Time) whereClause {
+	var where whereClause
+	where.add("created_at >= $%d", from)
+	where.add("created_at < $%d", to)
+	return where
+}
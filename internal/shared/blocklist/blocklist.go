@@ -0,0 +1,276 @@
+// Package blocklist matches URLs against local copies of phishing and
+// malware lists. Three formats are understood: plain domain lists (hosts
+// files included), URLhaus URL dumps in text or CSV form, and Safe Browsing
+// style SHA-256 hash prefixes of canonical URL expressions.
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+type Format string
+
+const (
+	FormatDomains      Format = "domains"
+	FormatURLhaus      Format = "urlhaus"
+	FormatSafeBrowsing Format = "safebrowsing"
+)
+
+var (
+	ErrInvalidSource = errors.New("blocklist source must be format:path with format domains, urlhaus or safebrowsing")
+	ErrInvalidPrefix = errors.New("invalid hash prefix")
+)
+
+// Source is a local list file. Name identifies it in matches.
+type Source struct {
+	Name   string
+	Format Format
+	Path   string
+}
+
+// ParseSource reads a source written as format:path, such as
+// urlhaus:/var/lib/blocklists/urlhaus.csv.
+func ParseSource(spec string) (Source, error) {
+	format, path, ok := strings.Cut(spec, ":")
+	if !ok || path == "" {
+		return Source{}, ErrInvalidSource
+	}
+	switch Format(format) {
+	case FormatDomains, FormatURLhaus, FormatSafeBrowsing:
+	default:
+		return Source{}, ErrInvalidSource
+	}
+	return Source{Name: filepath.Base(path), Format: Format(format), Path: path}, nil
+}
+
+// List is an immutable set of entries loaded from one or more sources.
+// Each entry remembers the name of the source it came from.
+type List struct {
+	domains  map[string]string
+	urls     map[string]string
+	prefixes map[string]string
+	// prefixLengths are the distinct prefix lengths in bytes, so a hash is
+	// looked up once per length.
+	prefixLengths []int
+}
+
+func newList() *List {
+	return &List{domains: map[string]string{}, urls: map[string]string{}, prefixes: map[string]string{}}
+}
+
+// Load reads every source into a new list.
+func Load(sources []Source) (*List, error) {
+	list := newList()
+	for _, source := range sources {
+		f, err := os.Open(source.Path)
+		if err != nil {
+			return nil, err
+		}
+		err = list.read(f, source)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.Path, err)
+		}
+	}
+	return list, nil
+}
+
+// Parse reads a single list from r.
+func Parse(r io.Reader, source Source) (*List, error) {
+	list := newList()
+	if err := list.read(r, source); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *List) read(r io.Reader, source Source) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := l.add(text, source); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *List) add(text string, source Source) error {
+	switch source.Format {
+	case FormatDomains:
+		// Hosts files put an address before the name.
+		fields := strings.Fields(text)
+		domain := normalizeHost(fields[len(fields)-1])
+		if domain != "" && domain != "localhost" {
+			l.domains[domain] = source.Name
+		}
+	case FormatURLhaus:
+		if strings.HasPrefix(text, `"`) {
+			record, err := csv.NewReader(strings.NewReader(text)).Read()
+			if err != nil {
+				return err
+			}
+			if len(record) < 3 {
+				return nil
+			}
+			text = record[2]
+		}
+		if key, ok := urlKey(text); ok {
+			l.urls[key] = source.Name
+		}
+	case FormatSafeBrowsing:
+		prefix, err := hex.DecodeString(text)
+		if err != nil || len(prefix) < 4 || len(prefix) > 32 {
+			return ErrInvalidPrefix
+		}
+		if !containsInt(l.prefixLengths, len(prefix)) {
+			l.prefixLengths = append(l.prefixLengths, len(prefix))
+		}
+		l.prefixes[string(prefix)] = source.Name
+	default:
+		return ErrInvalidSource
+	}
+	return nil
+}
+
+// Len returns the number of entries in the list.
+func (l *List) Len() int {
+	return len(l.domains) + len(l.urls) + len(l.prefixes)
+}
+
+// Match reports whether rawURL is listed and, if so, by which source. The
+// exact URL is tried first, then its host and parent domains, then the hash
+// of each of its Safe Browsing expressions.
+func (l *List) Match(rawURL string) (string, bool) {
+	if key, ok := urlKey(rawURL); ok {
+		if source, ok := l.urls[key]; ok {
+			return source, true
+		}
+	}
+
+	host, path, ok := canonicalize(rawURL)
+	if !ok {
+		return "", false
+	}
+	for domain := host; domain != ""; domain = parentDomain(domain) {
+		if source, ok := l.domains[domain]; ok {
+			return source, true
+		}
+	}
+
+	if len(l.prefixes) == 0 {
+		return "", false
+	}
+	for _, expression := range expressions(host, path) {
+		hash := hashExpression(expression)
+		for _, n := range l.prefixLengths {
+			if source, ok := l.prefixes[string(hash[:n])]; ok {
+				return source, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Blocklist holds the current list and swaps in a new one on reload, so
+// matching never waits for a reload.
+type Blocklist struct {
+	sources []Source
+	list    atomic.Pointer[List]
+}
+
+// New returns an empty blocklist for sources; call Reload to load them.
+func New(sources []Source) *Blocklist {
+	b := &Blocklist{sources: sources}
+	b.list.Store(newList())
+	return b
+}
+
+// Reload reads every source again. The previous list stays in use when any
+// source fails to load.
+func (b *Blocklist) Reload() error {
+	list, err := Load(b.sources)
+	if err != nil {
+		return err
+	}
+	b.list.Store(list)
+	return nil
+}
+
+// Refresh downloads each source from mirror, which serves the files under
+// their base names, replaces the local copies and reloads.
+func (b *Blocklist) Refresh(ctx context.Context, client *http.Client, mirror string) error {
+	for _, source := range b.sources {
+		if err := download(ctx, client, strings.TrimRight(mirror, "/")+"/"+filepath.Base(source.Path), source.Path); err != nil {
+			return fmt.Errorf("%s: %w", source.Name, err)
+		}
+	}
+	return b.Reload()
+}
+
+func (b *Blocklist) Match(rawURL string) (string, bool) {
+	return b.list.Load().Match(rawURL)
+}
+
+func (b *Blocklist) Len() int {
+	return b.list.Load().Len()
+}
+
+// download writes the body at rawURL next to path and renames it into
+// place, so a failed download never leaves a truncated list behind.
+func download(ctx context.Context, client *http.Client, rawURL, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package blocklist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	source, err := ParseSource("urlhaus:/var/lib/lists/urlhaus.csv")
+	if err != nil || source != (Source{Name: "urlhaus.csv", Format: FormatURLhaus, Path: "/var/lib/lists/urlhaus.csv"}) {
+		t.Errorf("unexpected source %+v (%v)", source, err)
+	}
+	for _, spec := range []string{"", "urlhaus", "urlhaus:", "adblock:/tmp/list.txt"} {
+		if _, err := ParseSource(spec); !errors.Is(err, ErrInvalidSource) {
+			t.Errorf("ParseSource(%q): expected %v, got %v", spec, ErrInvalidSource, err)
+		}
+	}
+}
+
+func TestDomains(t *testing.T) {
+	list, err := Parse(strings.NewReader("# phishing\nevil.example\n0.0.0.0 Bad.Example.\n127.0.0.1 localhost\n"),
+		Source{Name: "domains.txt", Format: FormatDomains})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rawURL, want := range map[string]bool{
+		"https://evil.example/login":         true,
+		"https://secure.login.evil.example/": true,
+		"http://BAD.example:8080/":           true,
+		"https://notevil.example/":           false,
+		"https://example/":                   false,
+		"http://localhost/":                  false,
+	} {
+		if source, got := list.Match(rawURL); got != want || (got && source != "domains.txt") {
+			t.Errorf("Match(%s) = %q, %v, want %v", rawURL, source, got, want)
+		}
+	}
+}
+
+func TestURLhaus(t *testing.T) {
+	dump := `# id,dateadded,url,url_status,last_online,threat,tags,urlhaus_link,reporter
+"3281234","2024-05-01 10:00:00","http://203.0.113.9:80/bins/x86","online","2024-05-01 10:00:00","malware_download","elf","https://urlhaus.abuse.ch/url/3281234/","someone"
+https://Phish.example/Login?session=1
+`
+	list, err := Parse(strings.NewReader(dump), Source{Name: "urlhaus", Format: FormatURLhaus})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rawURL, want := range map[string]bool{
+		"http://203.0.113.9/bins/x86":                true,
+		"https://phish.example/Login?session=1#form": true,
+		"https://phish.example/login?session=1":      false,
+		"https://phish.example/":                     false,
+	} {
+		if _, got := list.Match(rawURL); got != want {
+			t.Errorf("Match(%s) = %v, want %v", rawURL, got, want)
+		}
+	}
+}
+
+func TestSafeBrowsing(t *testing.T) {
+	full := sha256.Sum256([]byte("evil.example/phish/"))
+	list, err := Parse(strings.NewReader(hex.EncodeToString(full[:4])+"\n"), Source{Name: "sb", Format: FormatSafeBrowsing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := list.Match("http://login.evil.example/phish/page.html?x=1"); !ok {
+		t.Error("expected a match through the host suffix and path prefix")
+	}
+	if _, ok := list.Match("http://evil.example/other/"); ok {
+		t.Error("expected no match for another path")
+	}
+
+	if _, err := Parse(strings.NewReader("abc\n"), Source{Format: FormatSafeBrowsing}); !errors.Is(err, ErrInvalidPrefix) {
+		t.Errorf("expected %v, got %v", ErrInvalidPrefix, err)
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	host, p, ok := canonicalize("http://a.b.c/1/2.html?param=1")
+	if !ok {
+		t.Fatal("expected the URL to canonicalize")
+	}
+	want := []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}
+	if got := expressions(host, p); !reflect.DeepEqual(got, want) {
+		t.Errorf("expressions = %v, want %v", got, want)
+	}
+
+	host, _, _ = canonicalize("http://a.b.c.d.e.f.g/1.html")
+	if got := hostSuffixes(host); !reflect.DeepEqual(got, []string{"a.b.c.d.e.f.g", "c.d.e.f.g", "d.e.f.g", "e.f.g", "f.g"}) {
+		t.Errorf("unexpected host suffixes %v", got)
+	}
+	if got := pathPrefixes("/1/2/3/4/5/6"); len(got) != 5 {
+		t.Errorf("expected 5 path prefixes, got %v", got)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	for rawURL, want := range map[string]string{
+		"http://www.GOOgle.com/":                          "www.google.com/",
+		"http://www.google.com.../":                       "www.google.com/",
+		"http://host/%25%32%35":                           "host/%25",
+		"http://host/asdf%25%32%35asd":                    "host/asdf%25asd",
+		"http://www.google.com/blah/..":                   "www.google.com/",
+		"http://www.evil.com/blah#frag":                   "www.evil.com/blah",
+		"http://www.google.com/q?r?":                      "www.google.com/q?r?",
+		"http://\x01\x80.com/":                            "",
+		"http://168.188.99.26/%2E%73%65%63%75%72%65/abc/": "168.188.99.26/.secure/abc/",
+	} {
+		host, p, ok := canonicalize(rawURL)
+		if got := host + p; ok && got != want || !ok && want != "" {
+			t.Errorf("canonicalize(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestReloadAndRefresh(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "domains.txt")
+	if err := os.WriteFile(path, []byte("old.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New([]Source{{Name: "domains.txt", Format: FormatDomains, Path: path}})
+	if err := b.Reload(); err != nil || b.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d (%v)", b.Len(), err)
+	}
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/domains.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("new.example\nnewer.example\n"))
+	}))
+	defer mirror.Close()
+
+	if err := b.Refresh(context.Background(), mirror.Client(), mirror.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Match("https://new.example/"); !ok || b.Len() != 2 {
+		t.Errorf("expected the refreshed list, got %d entries", b.Len())
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Reload(); err == nil {
+		t.Error("expected reloading a missing file to fail")
+	}
+	if _, ok := b.Match("https://new.example/"); !ok {
+		t.Error("expected the previous list to stay in use")
+	}
+}
@@ -0,0 +1,172 @@
+package blocklist
+
+import (
+	"crypto/sha256"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	maxHostSuffixes = 5
+	maxPathPrefixes = 4
+)
+
+// urlKey normalizes a URL for exact matching: scheme and host lowercased,
+// default ports and fragments dropped and an empty path written as "/".
+func urlKey(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := normalizeHost(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	key := scheme + "://" + host + p
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key, true
+}
+
+// canonicalize follows the Safe Browsing canonicalization closely enough
+// for local lists: the host loses its port and stray dots and is
+// lowercased, the path is unescaped and cleaned, and the query is kept.
+func canonicalize(rawURL string) (host, pathAndQuery string, ok bool) {
+	rawURL = strings.NewReplacer("\t", "", "\r", "", "\n", "").Replace(strings.TrimSpace(rawURL))
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+
+	host = normalizeHost(unescapeAll(u.Hostname()))
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+	if host == "" {
+		return "", "", false
+	}
+
+	p := unescapeAll(u.EscapedPath())
+	if p == "" {
+		p = "/"
+	}
+	trailing := strings.HasSuffix(p, "/")
+	p = path.Clean(p)
+	if trailing && p != "/" {
+		p += "/"
+	}
+	p = escapeSpecial(p)
+	if u.RawQuery != "" || u.ForceQuery {
+		p += "?" + escapeSpecial(unescapeAll(u.RawQuery))
+	}
+	return host, p, true
+}
+
+// expressions lists the host suffix and path prefix combinations a URL is
+// looked up under, most specific first.
+func expressions(host, pathAndQuery string) []string {
+	var result []string
+	for _, h := range hostSuffixes(host) {
+		for _, p := range pathPrefixes(pathAndQuery) {
+			result = append(result, h+p)
+		}
+	}
+	return result
+}
+
+func hostSuffixes(host string) []string {
+	suffixes := []string{host}
+	if net.ParseIP(host) != nil {
+		return suffixes
+	}
+	parts := strings.Split(host, ".")
+	// Start from at most the last five components and never use the
+	// top-level domain alone.
+	start := max(len(parts)-maxHostSuffixes, 1)
+	for i := start; i < len(parts)-1; i++ {
+		suffix := strings.Join(parts[i:], ".")
+		if suffix != host {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes
+}
+
+func pathPrefixes(pathAndQuery string) []string {
+	p, query, hasQuery := strings.Cut(pathAndQuery, "?")
+	var prefixes []string
+	if hasQuery {
+		prefixes = append(prefixes, p+"?"+query)
+	}
+	prefixes = append(prefixes, p)
+
+	// Then the root and the directories below it, without the query.
+	current := "/"
+	components := strings.Split(strings.Trim(p, "/"), "/")
+	for i, added := 0, 0; i < len(components) && added < maxPathPrefixes; i++ {
+		if current != p {
+			prefixes = append(prefixes, current)
+			added++
+		}
+		if components[i] == "" {
+			break
+		}
+		current += components[i] + "/"
+	}
+	return prefixes
+}
+
+func hashExpression(expression string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(expression))
+}
+
+// unescapeAll percent-decodes until nothing changes, undoing multiple
+// layers of escaping.
+func unescapeAll(s string) string {
+	for i := 0; i < 10; i++ {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil || unescaped == s {
+			return s
+		}
+		s = unescaped
+	}
+	return s
+}
+
+// escapeSpecial escapes control characters, spaces, non-ASCII bytes and
+// the characters that would otherwise be ambiguous.
+func escapeSpecial(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || c == '#' || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func normalizeHost(host string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func parentDomain(domain string) string {
+	_, parent, ok := strings.Cut(domain, ".")
+	if !ok {
+		return ""
+	}
+	return parent
+}
@@ -0,0 +1,106 @@
+// Package hll implements HyperLogLog sketches for approximate distinct
+// counting. A sketch is Registers bytes, one register per byte, so it can be
+// stored as bytea and updated in SQL with get_byte/set_byte.
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits used to pick a register. It
+	// gives a standard error of about 1.6%.
+	Precision = 12
+	// Registers is the number of registers and the sketch size in bytes.
+	Registers = 1 << Precision
+)
+
+var ErrInvalidSketch = errors.New("invalid HyperLogLog sketch")
+
+type Sketch struct {
+	registers [Registers]uint8
+}
+
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// FromBytes decodes a sketch stored with Bytes.
+func FromBytes(data []byte) (*Sketch, error) {
+	if len(data) != Registers {
+		return nil, ErrInvalidSketch
+	}
+	s := &Sketch{}
+	copy(s.registers[:], data)
+	return s, nil
+}
+
+func (s *Sketch) Bytes() []byte {
+	data := make([]byte, Registers)
+	copy(data, s.registers[:])
+	return data
+}
+
+// Position returns the register value updates and the rank to raise it to,
+// for callers that update stored sketches in place.
+func Position(value string) (index int, rank uint8) {
+	h := hash(value)
+	index = int(h >> (64 - Precision))
+	// The guard bit caps the rank when the remaining bits are all zero.
+	rest := h<<Precision | 1<<(Precision-1)
+	return index, uint8(bits.LeadingZeros64(rest)) + 1
+}
+
+func (s *Sketch) Add(value string) {
+	index, rank := Position(value)
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge folds other into s, so that s counts the union of both.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Estimate returns the approximate number of distinct values added.
+func (s *Sketch) Estimate() uint64 {
+	const m = float64(Registers)
+
+	sum, zeros := 0.0, 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is far more accurate for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// hash spreads FNV-1a through the SplitMix64 finalizer, whose output bits
+// are far more uniform than FNV's alone.
+func hash(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
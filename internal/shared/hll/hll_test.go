@@ -0,0 +1,63 @@
+package hll
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		s := New()
+		for i := 0; i < n; i++ {
+			s.Add("visitor-" + strconv.Itoa(i))
+			s.Add("visitor-" + strconv.Itoa(i))
+		}
+
+		got := float64(s.Estimate())
+		if n == 0 {
+			if got != 0 {
+				t.Errorf("expected 0 for an empty sketch, got %v", got)
+			}
+			continue
+		}
+		if errRate := math.Abs(got-float64(n)) / float64(n); errRate > 0.05 {
+			t.Errorf("estimate for %d is %v, off by %.1f%%", n, got, errRate*100)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 6000; i++ {
+		a.Add(strconv.Itoa(i))
+	}
+	for i := 4000; i < 10000; i++ {
+		b.Add(strconv.Itoa(i))
+	}
+
+	a.Merge(b)
+	if got := float64(a.Estimate()); math.Abs(got-10000)/10000 > 0.05 {
+		t.Errorf("expected about 10000 after merging, got %v", got)
+	}
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	s := New()
+	s.Add("203.0.113.7")
+
+	index, rank := Position("203.0.113.7")
+	data := s.Bytes()
+	if len(data) != Registers || data[index] != rank {
+		t.Fatalf("expected register %d to hold %d", index, rank)
+	}
+
+	decoded, err := FromBytes(data)
+	if err != nil || !bytes.Equal(decoded.Bytes(), data) {
+		t.Errorf("round trip failed: %v", err)
+	}
+	if _, err := FromBytes(data[:10]); err == nil {
+		t.Error("expected an error for a truncated sketch")
+	}
+}
@@ -0,0 +1,201 @@
+// Package ipprivacy turns visitor IP addresses into values that are safe to
+// store: either the network they belong to or a salted hash that rotates
+// every day.
+package ipprivacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+type Mode string
+
+const (
+	// ModeNone stores addresses as they are.
+	ModeNone Mode = "none"
+	// ModeTruncate keeps the /24 of IPv4 and the /48 of IPv6 addresses.
+	ModeTruncate Mode = "truncate"
+	// ModeHash replaces addresses with an HMAC keyed by the salt and the
+	// UTC date, so the same visitor hashes alike within a day only.
+	ModeHash Mode = "hash"
+)
+
+// hashPrefix marks stored values as hashes rather than addresses.
+const hashPrefix = "h:"
+
+// MaxLookback bounds how many days of hashes Candidates produces for an
+// open-ended time range.
+const MaxLookback = 400 * 24 * time.Hour
+
+var (
+	ErrInvalidMode = errors.New("invalid IP privacy mode")
+	ErrMissingSalt = errors.New("IP hashing requires a salt")
+)
+
+type Anonymizer struct {
+	mode Mode
+	salt []byte
+	now  func() time.Time
+}
+
+// New builds an anonymizer. An empty mode means ModeNone.
+func New(mode, salt string) (*Anonymizer, error) {
+	m := Mode(mode)
+	switch m {
+	case "":
+		m = ModeNone
+	case ModeNone, ModeTruncate:
+	case ModeHash:
+		if salt == "" {
+			return nil, ErrMissingSalt
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMode, mode)
+	}
+	return &Anonymizer{mode: m, salt: []byte(salt), now: time.Now}, nil
+}
+
+func (a *Anonymizer) Mode() Mode {
+	return a.mode
+}
+
+// Anonymize returns the value to store for a visit from ip right now.
+// Values that do not parse as an address are dropped unless the mode is
+// ModeNone.
+func (a *Anonymizer) Anonymize(ip string) string {
+	return a.anonymizeAt(ip, a.now())
+}
+
+func (a *Anonymizer) anonymizeAt(ip string, at time.Time) string {
+	switch a.mode {
+	case ModeTruncate:
+		return truncate(ip)
+	case ModeHash:
+		return a.hash(ip, at)
+	default:
+		return ip
+	}
+}
+
+// Candidates returns every stored value ip may have been recorded as
+// between from and to, for looking visits up by address. In hash mode that
+// is one hash per day, with the range capped to MaxLookback.
+func (a *Anonymizer) Candidates(ip string, from, to *time.Time) []string {
+	if a.mode != ModeHash {
+		if value := a.anonymizeAt(ip, time.Time{}); value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+
+	end := a.now()
+	if to != nil && to.Before(end) {
+		end = *to
+	}
+	start := end.Add(-MaxLookback)
+	if from != nil && from.After(start) {
+		start = *from
+	}
+
+	var values []string
+	for day := start.UTC().Truncate(24 * time.Hour); !day.After(end); day = day.AddDate(0, 0, 1) {
+		if value := a.hash(ip, day); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ReporterKey returns a value that stays the same for one person across
+// days, for counting how many different people reported something. IPv6
+// addresses count per /64, the block a single subscriber usually holds. In
+// ModeNone the key is that network address; otherwise it is an HMAC of it
+// keyed by the salt, which unlike stored visits does not rotate. Without a
+// salt outside ModeNone no key can tell reporters apart without storing
+// their address, and ReporterKey returns "".
+func (a *Anonymizer) ReporterKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, err := addr.Prefix(64)
+		if err != nil {
+			return ""
+		}
+		addr = prefix.Addr()
+	}
+
+	if a.mode == ModeNone {
+		return addr.String()
+	}
+	if len(a.salt) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte("reporter"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(addr.String()))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// KeysReporters reports whether ReporterKey can tell reporters apart.
+func (a *Anonymizer) KeysReporters() bool {
+	return a.mode == ModeNone || len(a.salt) > 0
+}
+
+// AuditSubject returns what the audit log keeps of an address or stored
+// value that visits were looked up by, since the log outlives the visits.
+// Addresses become an HMAC keyed by the salt or, without one, their
+// truncated network. Other values, such as stored hashes, are kept.
+func (a *Anonymizer) AuditSubject(value string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return value
+	}
+	if len(a.salt) == 0 {
+		return truncate(value)
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte("audit"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(addr.Unmap().String()))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func truncate(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+func (a *Anonymizer) hash(ip string, at time.Time) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(at.UTC().Format("2006-01-02")))
+	mac.Write([]byte{0})
+	mac.Write([]byte(addr.Unmap().String()))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,129 @@
+package ipprivacy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	a, err := New("truncate", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"203.0.113.77":           "203.0.113.0",
+		"::ffff:203.0.113.77":    "203.0.113.0",
+		"2001:db8:abcd:12::1":    "2001:db8:abcd::",
+		"not an address":         "",
+		"2001:db8:abcd:ffff::ff": "2001:db8:abcd::",
+	}
+	for ip, want := range tests {
+		if got := a.Anonymize(ip); got != want {
+			t.Errorf("Anonymize(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestHashRotatesDaily(t *testing.T) {
+	a, err := New("hash", "pepper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	morning := a.anonymizeAt("203.0.113.77", day)
+	evening := a.anonymizeAt("203.0.113.77", day.Add(12*time.Hour))
+	tomorrow := a.anonymizeAt("203.0.113.77", day.Add(24*time.Hour))
+	other := a.anonymizeAt("203.0.113.78", day)
+
+	if morning != evening {
+		t.Errorf("expected the same hash within a day, got %q and %q", morning, evening)
+	}
+	if morning == tomorrow || morning == other {
+		t.Error("expected different hashes across days and addresses")
+	}
+
+	a.now = func() time.Time { return day.Add(48 * time.Hour) }
+	from := day.Add(-time.Hour)
+	candidates := a.Candidates("203.0.113.77", &from, nil)
+	if len(candidates) != 3 || candidates[0] != morning || candidates[1] != tomorrow {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	if _, err := New("scramble", ""); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := New("hash", ""); err == nil {
+		t.Error("expected an error for hashing without a salt")
+	}
+}
+
+func TestReporterKey(t *testing.T) {
+	plain, err := New("none", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plain.ReporterKey("2001:db8:abcd:12:1::7"); got != "2001:db8:abcd:12::" {
+		t.Errorf("expected IPv6 reporters keyed by /64, got %q", got)
+	}
+	if got := plain.ReporterKey("::ffff:203.0.113.77"); got != "203.0.113.77" {
+		t.Errorf("expected the IPv4 address, got %q", got)
+	}
+
+	hashed, err := New("hash", "pepper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hashed.ReporterKey("203.0.113.77")
+	hashed.now = func() time.Time { return time.Now().Add(72 * time.Hour) }
+	if again := hashed.ReporterKey("203.0.113.77"); key == "" || key != again {
+		t.Errorf("expected a key that does not rotate, got %q and %q", key, again)
+	}
+	if key == hashed.ReporterKey("203.0.113.78") {
+		t.Error("expected neighbouring addresses to have different keys")
+	}
+	if key == hashed.Anonymize("203.0.113.77") {
+		t.Error("expected the key to differ from the stored visitor hash")
+	}
+
+	truncated, err := New("truncate", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated.KeysReporters() || truncated.ReporterKey("203.0.113.77") != "" {
+		t.Error("expected no reporter keys when truncating without a salt")
+	}
+	salted, err := New("truncate", "pepper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !salted.KeysReporters() || salted.ReporterKey("203.0.113.77") == salted.ReporterKey("203.0.113.78") {
+		t.Error("expected a salt to key reporters by full address")
+	}
+}
+
+func TestAuditSubject(t *testing.T) {
+	plain, err := New("none", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plain.AuditSubject("203.0.113.77"); got != "203.0.113.0" {
+		t.Errorf("expected the address truncated without a salt, got %q", got)
+	}
+
+	salted, err := New("none", "pepper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := salted.AuditSubject("203.0.113.77")
+	if !strings.HasPrefix(subject, hashPrefix) || subject == salted.ReporterKey("203.0.113.77") {
+		t.Errorf("expected a hash of its own, got %q", subject)
+	}
+	if got := salted.AuditSubject("h:0123abcd"); got != "h:0123abcd" {
+		t.Errorf("expected stored values kept, got %q", got)
+	}
+}
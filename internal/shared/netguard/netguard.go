@@ -0,0 +1,201 @@
+// Package netguard builds HTTP clients for fetching user-supplied URLs
+// without letting them reach the internal network. Addresses are checked
+// when the connection is dialled, after DNS resolution, so a hostname that
+// resolves to a private address is refused as well.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxRedirects = 5
+)
+
+var (
+	ErrBlockedAddress   = errors.New("address is not publicly routable")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrUnsupportedURL   = errors.New("only http and https URLs can be fetched")
+	ErrInvalidIPv4      = errors.New("invalid IPv4 address")
+)
+
+// reservedPrefixes are special-purpose ranges that netip does not already
+// classify as private, loopback, link-local or multicast.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// IsPublic reports whether addr is a globally routable unicast address.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// HostAddr returns the address a URL host names when it is an IP literal.
+// Besides the usual forms it accepts the IPv4 shorthands that browsers and
+// the C resolver understand, such as 2130706433, 0x7f.1 and 127.1, which
+// name 127.0.0.1. ok is false for host names. A host whose last label is
+// numeric is an IPv4 address to browsers, so one that does not parse as
+// such returns ErrInvalidIPv4.
+func HostAddr(host string) (addr netip.Addr, ok bool, err error) {
+	host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSuffix(host, "]"), "["), ".")
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr, true, nil
+	}
+
+	parts := strings.Split(host, ".")
+	if !endsInNumber(parts[len(parts)-1]) {
+		return netip.Addr{}, false, nil
+	}
+	if len(parts) > 4 {
+		return netip.Addr{}, false, fmt.Errorf("%w: %s", ErrInvalidIPv4, host)
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		value, numeric := parseIPv4Part(part)
+		if !numeric {
+			return netip.Addr{}, false, fmt.Errorf("%w: %s", ErrInvalidIPv4, host)
+		}
+		values[i] = value
+	}
+	// Every part but the last is one byte; the last fills the rest.
+	var ip uint64
+	for _, value := range values[:len(values)-1] {
+		if value > 0xff {
+			return netip.Addr{}, false, fmt.Errorf("%w: %s", ErrInvalidIPv4, host)
+		}
+		ip = ip<<8 | value
+	}
+	last := values[len(values)-1]
+	rest := uint(8 * (5 - len(values)))
+	if last >= 1<<rest {
+		return netip.Addr{}, false, fmt.Errorf("%w: %s", ErrInvalidIPv4, host)
+	}
+	ip = ip<<rest | last
+
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true, nil
+}
+
+func endsInNumber(label string) bool {
+	if label != "" && strings.Trim(label, "0123456789") == "" {
+		return true
+	}
+	_, numeric := parseIPv4Part(label)
+	return numeric
+}
+
+// parseIPv4Part parses one part of an IPv4 address in decimal, octal with a
+// leading 0 or hexadecimal with a leading 0x.
+func parseIPv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		part, base = part[2:], 16
+		if part == "" {
+			return 0, true
+		}
+	case len(part) >= 2 && part[0] == '0':
+		part, base = part[1:], 8
+	}
+	if part == "" || strings.ContainsAny(part, "+-_") {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(part, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 1 << 32, true
+	}
+	return value, err == nil
+}
+
+type Config struct {
+	// Timeout bounds the whole request, body included.
+	Timeout      time.Duration
+	MaxRedirects int
+	// AllowPrivate turns the address check off, for tests against local
+	// servers.
+	AllowPrivate bool
+}
+
+// NewClient returns a client that refuses non-public addresses, follows a
+// bounded number of http and https redirects and ignores proxy settings,
+// which would otherwise dial on its behalf.
+func NewClient(cfg Config) *http.Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRedirects <= 0 {
+		cfg.MaxRedirects = DefaultMaxRedirects
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = control
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrUnsupportedURL
+			}
+			return nil
+		},
+	}
+}
+
+// control runs right before each connection is made, on the resolved
+// address.
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package netguard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"64:ff9b::a9fe:a9fe":   false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::ffff:93.184.216.34": true,
+	} {
+		if got := IsPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestClientBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(Config{}).Get(server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("expected %v, got %v", ErrBlockedAddress, err)
+	}
+
+	resp, err := NewClient(Config{AllowPrivate: true}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the request to succeed when private addresses are allowed: %v", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestClientLimitsRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/again", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(Config{AllowPrivate: true, MaxRedirects: 2}).Get(server.URL)
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("expected %v, got %v", ErrTooManyRedirects, err)
+	}
+}
+
+func TestHostAddr(t *testing.T) {
+	for host, want := range map[string]string{
+		"127.0.0.1":        "127.0.0.1",
+		"2130706433":       "127.0.0.1",
+		"0x7f.1":           "127.0.0.1",
+		"127.1":            "127.0.0.1",
+		"0177.0.0.01":      "127.0.0.1",
+		"0x7F000001":       "127.0.0.1",
+		"10.0x10203":       "10.1.2.3",
+		"169.254.43518":    "169.254.169.254",
+		"192.168.1.1.":     "192.168.1.1",
+		"::1":              "::1",
+		"[::ffff:7f00:1]":  "::ffff:127.0.0.1",
+		"0x":               "0.0.0.0",
+		"93.184.216.34":    "93.184.216.34",
+		"4294967295":       "255.255.255.255",
+		"example.com":      "",
+		"0x7f.example.com": "",
+		"localhost":        "",
+	} {
+		addr, ok, err := HostAddr(host)
+		if err != nil {
+			t.Errorf("HostAddr(%q): %v", host, err)
+			continue
+		}
+		if want == "" {
+			if ok {
+				t.Errorf("HostAddr(%q) = %s, want a host name", host, addr)
+			}
+			continue
+		}
+		if !ok || addr != netip.MustParseAddr(want) {
+			t.Errorf("HostAddr(%q) = %s, %v, want %s", host, addr, ok, want)
+		}
+	}
+
+	for _, host := range []string{"4294967296", "256.0.0.1", "1.2.3.4.5", "1.2.3.256", "example.123", "08", "1..2", "0x100.1"} {
+		if _, _, err := HostAddr(host); !errors.Is(err, ErrInvalidIPv4) {
+			t.Errorf("HostAddr(%q): expected %v, got %v", host, ErrInvalidIPv4, err)
+		}
+	}
+}
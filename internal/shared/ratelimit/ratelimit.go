@@ -0,0 +1,133 @@
+// Package ratelimit implements token buckets: each key may spend up to
+// Burst requests at once and regains them at a steady rate. Buckets live in
+// a Store, either in process memory or shared between instances.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit allows Requests per Period, all of which may be spent at once.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads a limit written as requests/period, such as "30/1m" or
+// "5/s". An empty string or zero requests means no limit and returns a
+// zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w %q: want requests/period", ErrInvalidLimit, s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("%w %q: bad request count", ErrInvalidLimit, s)
+	}
+	if period != "" && !strings.ContainsAny(period[:1], "0123456789.") {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("%w %q: bad period", ErrInvalidLimit, s)
+	}
+	if n == 0 {
+		return Limit{}, nil
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// rate is how many tokens come back per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// Result describes a bucket right after a request was counted against it.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a refused client has to wait for a token.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// NewResult describes a bucket holding tokens after the request. Stores
+// call it so that every store reports the same way.
+func NewResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     seconds((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// refill returns how many tokens a bucket that held tokens after elapsed
+// has now, capped at a full bucket.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * limit.rate()
+	}
+	return math.Min(tokens, float64(limit.Requests))
+}
+
+// Store keeps buckets by key and spends one token per Take.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Limiter applies one limit to the requests of a named group, such as link
+// creation, so groups sharing a store do not share buckets.
+type Limiter struct {
+	store Store
+	name  string
+	limit Limit
+}
+
+func New(store Store, name string, limit Limit) *Limiter {
+	return &Limiter{store: store, name: name, limit: limit}
+}
+
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow counts a request by key against its bucket.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.store.Take(ctx, l.name+":"+key, l.limit)
+}
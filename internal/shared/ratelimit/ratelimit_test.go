@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := map[string]Limit{
+		"30/1m":  {Requests: 30, Period: time.Minute},
+		"5/s":    {Requests: 5, Period: time.Second},
+		" 2/h ":  {Requests: 2, Period: time.Hour},
+		"":       {},
+		"0":      {},
+		"0/1m":   {},
+		"10/.5s": {Requests: 10, Period: 500 * time.Millisecond},
+	}
+	for s, want := range tests {
+		got, err := ParseLimit(s)
+		if err != nil || got != want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"30", "x/1m", "-1/1m", "30/forever", "30/0s"} {
+		if _, err := ParseLimit(s); err == nil {
+			t.Errorf("ParseLimit(%q): expected an error", s)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	limiter := New(store, "create", Limit{Requests: 3, Period: time.Minute})
+	ctx := context.Background()
+
+	for i := range 3 {
+		result, err := limiter.Allow(ctx, "203.0.113.7")
+		if err != nil || !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: unexpected result %+v, %v", i, result, err)
+		}
+	}
+
+	result, _ := limiter.Allow(ctx, "203.0.113.7")
+	if result.Allowed || result.RetryAfter != 20*time.Second || result.Reset != time.Minute {
+		t.Errorf("expected a refusal for 20s, got %+v", result)
+	}
+	if other, _ := limiter.Allow(ctx, "203.0.113.8"); !other.Allowed {
+		t.Error("expected other keys to have their own bucket")
+	}
+	if other, _ := New(store, "redirect", limiter.Limit()).Allow(ctx, "203.0.113.7"); !other.Allowed {
+		t.Error("expected other limiters to have their own bucket")
+	}
+
+	now = now.Add(20 * time.Second)
+	if result, _ := limiter.Allow(ctx, "203.0.113.7"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected one token back after 20s, got %+v", result)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := limiter.Allow(ctx, "203.0.113.9"); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.buckets) != 1 {
+		t.Errorf("expected full buckets to be swept, %d left", len(store.buckets))
+	}
+}
@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// Every runs job once right away and then on every interval tick until ctx
+// is cancelled. Jobs never overlap: a slow run delays the next tick.
+func Every(ctx context.Context, interval time.Duration, job func(ctx context.Context)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -1,15 +1,28 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	nethttp "net/http"
 	"os"
 	"time"
 
 	"app/config"
 	"app/internal/application/link"
+	domainLink "app/internal/domain/link"
+	"app/internal/infrastructure/healthcheck"
 	"app/internal/infrastructure/http"
+	"app/internal/infrastructure/metadata"
 	"app/internal/infrastructure/persistence/postgres"
+	"app/internal/shared/blocklist"
+	"app/internal/shared/ipprivacy"
+	"app/internal/shared/netguard"
+	"app/internal/shared/ratelimit"
+	"app/internal/shared/scheduler"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -32,9 +45,274 @@ func connectDB(databaseURL string) (*sql.DB, error) {
 	return db, nil
 }
 
-func createDependencies(db *sql.DB, baseURL string) *link.Service {
+func createDependencies(db *sql.DB, cfg *config.Config, anonymizer *ipprivacy.Anonymizer, blocked *blocklist.Blocklist) *link.Service {
 	repo := postgres.NewLinkRepository(db)
-	return link.NewService(repo, baseURL)
+	fetcher := metadata.NewFetcher(netguard.NewClient(netguard.Config{Timeout: cfg.MetadataFetchTimeout}), int64(cfg.MetadataMaxBytes))
+	checker := healthcheck.NewChecker(netguard.NewClient(netguard.Config{Timeout: cfg.HealthCheckTimeout}))
+	policy := domainLink.DestinationPolicy{
+		Schemes:        cfg.DestinationSchemes,
+		AllowedDomains: cfg.DestinationAllowedDomains,
+		DeniedDomains:  cfg.DestinationDeniedDomains,
+		OwnDomains:     cfg.OwnDomains,
+	}
+	var resolver link.Resolver
+	if cfg.BlockPrivateDestinations {
+		resolver = net.DefaultResolver
+	}
+	opts := []link.Option{
+		link.WithIPAnonymizer(anonymizer),
+		link.WithMetadataFetcher(fetcher, metadataQueueSize),
+		link.WithHealthChecker(checker, cfg.HealthCheckFailures),
+		link.WithDestinationPolicy(policy, resolver),
+		link.WithAbuseThreshold(cfg.AbuseReportThreshold),
+	}
+	if blocked != nil {
+		opts = append(opts, link.WithBlocklist(blocked))
+	}
+	return link.NewService(repo, cfg.BaseURL, opts...)
+}
+
+const (
+	purgeInterval            = time.Hour
+	visitMaintenanceInterval = time.Hour
+	reconcileInterval        = 24 * time.Hour
+	metadataBackfillInterval = 10 * time.Minute
+	metadataQueueSize        = 100
+	healthCheckRunInterval   = 15 * time.Minute
+	healthCheckBatchSize     = 200
+	healthPruneInterval      = 24 * time.Hour
+	blocklistTimeout         = 5 * time.Minute
+	rateLimitPruneInterval   = 10 * time.Minute
+)
+
+func startBackgroundJobs(ctx context.Context, service *link.Service, partitions *postgres.VisitPartitions, cfg *config.Config) {
+	scheduler.Every(ctx, purgeInterval, func(ctx context.Context) {
+		purged, err := service.PurgeDeletedLinks(ctx, cfg.DeletedLinksRetention)
+		if err != nil {
+			log.Printf("error: failed to purge deleted links: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("purged %d deleted links", purged)
+		}
+	})
+
+	scheduler.Every(ctx, visitMaintenanceInterval, func(ctx context.Context) {
+		maintainVisits(ctx, service, partitions, cfg.VisitRetention)
+	})
+
+	go service.RunMetadataFetcher(ctx, func(err error) {
+		log.Printf("warning: %v", err)
+	})
+
+	scheduler.Every(ctx, metadataBackfillInterval, func(ctx context.Context) {
+		if _, err := service.QueueMissingMetadata(ctx); err != nil {
+			log.Printf("error: failed to queue links for metadata: %v", err)
+		}
+	})
+
+	if cfg.HealthCheckInterval > 0 {
+		scheduler.Every(ctx, healthCheckRunInterval, func(ctx context.Context) {
+			checkLinksHealth(ctx, service, cfg.HealthCheckInterval)
+		})
+		scheduler.Every(ctx, healthPruneInterval, func(ctx context.Context) {
+			pruned, err := service.PruneHealthChecks(ctx, cfg.HealthCheckRetention)
+			if err != nil {
+				log.Printf("error: failed to prune health checks: %v", err)
+				return
+			}
+			if pruned > 0 {
+				log.Printf("pruned %d health checks", pruned)
+			}
+		})
+	}
+
+	scheduler.Every(ctx, reconcileInterval, func(ctx context.Context) {
+		fixed, err := service.ReconcileClickCounts(ctx)
+		if err != nil {
+			log.Printf("error: failed to reconcile click counts: %v", err)
+			return
+		}
+		if fixed > 0 {
+			log.Printf("reconciled click counts of %d links", fixed)
+		}
+	})
+}
+
+// loadBlocklist reads the configured blocklists, or returns nil when there
+// are none. A list that fails to load is reported and matching starts
+// empty, to be filled by the next refresh.
+func loadBlocklist(cfg *config.Config) (*blocklist.Blocklist, error) {
+	if len(cfg.BlocklistFiles) == 0 {
+		return nil, nil
+	}
+	sources := make([]blocklist.Source, len(cfg.BlocklistFiles))
+	for i, spec := range cfg.BlocklistFiles {
+		source, err := blocklist.ParseSource(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec, err)
+		}
+		sources[i] = source
+	}
+
+	blocked := blocklist.New(sources)
+	if err := blocked.Reload(); err != nil {
+		log.Printf("error: failed to load blocklists: %v", err)
+	} else {
+		log.Printf("loaded %d blocklist entries", blocked.Len())
+	}
+	return blocked, nil
+}
+
+func refreshBlocklist(ctx context.Context, blocked *blocklist.Blocklist, mirror string) {
+	client := &nethttp.Client{Timeout: blocklistTimeout}
+	if err := blocked.Refresh(ctx, client, mirror); err != nil {
+		log.Printf("error: failed to refresh blocklists: %v", err)
+		return
+	}
+	log.Printf("refreshed blocklists: %d entries", blocked.Len())
+}
+
+// rateLimiters are the limiters for link creation, batches and imports,
+// redirects and abuse reports. A limit that is turned off leaves its
+// limiter nil.
+type rateLimiters struct {
+	create   *ratelimit.Limiter
+	bulk     *ratelimit.Limiter
+	redirect *ratelimit.Limiter
+	report   *ratelimit.Limiter
+	// shared is set when buckets live in Postgres and need pruning.
+	shared *postgres.RateLimitStore
+	idle   time.Duration
+}
+
+// checkClientIP refuses to key rate limits or abuse reporters by client
+// address while no proxy is trusted to tell it: behind a reverse proxy,
+// every client would then share the proxy's address.
+func checkClientIP(cfg *config.Config, limiters rateLimiters) error {
+	if len(cfg.TrustedProxies) > 0 || cfg.TrustedPlatform != "" {
+		return nil
+	}
+	if limiters.create != nil || limiters.bulk != nil || limiters.redirect != nil || limiters.report != nil || cfg.AbuseReportThreshold > 0 {
+		return errors.New("TRUSTED_PROXIES is empty but rate limits or abuse reports rely on client addresses: list the reverse proxy, set TRUSTED_PLATFORM, or turn those off")
+	}
+	return nil
+}
+
+// newRateLimiters builds the configured limiters. Without a database the
+// Postgres store falls back to memory.
+func newRateLimiters(cfg *config.Config, db *sql.DB) (rateLimiters, error) {
+	var limiters rateLimiters
+	create, err := ratelimit.ParseLimit(cfg.CreateRateLimit)
+	if err != nil {
+		return limiters, fmt.Errorf("RATE_LIMIT_CREATE: %w", err)
+	}
+	bulk, err := ratelimit.ParseLimit(cfg.BulkRateLimit)
+	if err != nil {
+		return limiters, fmt.Errorf("RATE_LIMIT_BULK: %w", err)
+	}
+	redirect, err := ratelimit.ParseLimit(cfg.RedirectRateLimit)
+	if err != nil {
+		return limiters, fmt.Errorf("RATE_LIMIT_REDIRECT: %w", err)
+	}
+	report, err := ratelimit.ParseLimit(cfg.ReportRateLimit)
+	if err != nil {
+		return limiters, fmt.Errorf("RATE_LIMIT_REPORT: %w", err)
+	}
+
+	var store ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "", "memory":
+		store = ratelimit.NewMemoryStore()
+	case "postgres":
+		if db == nil {
+			log.Printf("warning: no database for shared rate limits, limiting per instance")
+			store = ratelimit.NewMemoryStore()
+			break
+		}
+		limiters.shared = postgres.NewRateLimitStore(db)
+		limiters.idle = max(create.Period, bulk.Period, redirect.Period, report.Period)
+		store = limiters.shared
+	default:
+		return limiters, fmt.Errorf("RATE_LIMIT_STORE: unknown store %q", cfg.RateLimitStore)
+	}
+
+	if !create.IsZero() {
+		limiters.create = ratelimit.New(store, "create", create)
+	}
+	if !bulk.IsZero() {
+		limiters.bulk = ratelimit.New(store, "bulk", bulk)
+	}
+	if !redirect.IsZero() {
+		limiters.redirect = ratelimit.New(store, "redirect", redirect)
+	}
+	if !report.IsZero() {
+		limiters.report = ratelimit.New(store, "report", report)
+	}
+	return limiters, nil
+}
+
+func pruneRateLimits(ctx context.Context, store *postgres.RateLimitStore, idle time.Duration) {
+	pruned, err := store.Prune(ctx, idle)
+	if err != nil {
+		log.Printf("error: failed to prune rate limits: %v", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("pruned %d idle rate limit buckets", pruned)
+	}
+}
+
+// checkLinksHealth checks the links that are due and alerts on those that
+// broke or recovered in this round.
+func checkLinksHealth(ctx context.Context, service *link.Service, interval time.Duration) {
+	report, err := service.CheckLinksHealth(ctx, interval, healthCheckBatchSize)
+	if err != nil {
+		log.Printf("error: failed to check link health: %v", err)
+	}
+	for _, l := range report.Broken {
+		log.Printf("warning: link %d (%s) is broken: %s", l.ID, l.ShortName, l.OriginalURL)
+		rollbar.Warning("broken link", map[string]interface{}{
+			"link_id":              l.ID,
+			"short_name":           l.ShortName,
+			"original_url":         l.OriginalURL,
+			"consecutive_failures": l.Health.ConsecutiveFailures,
+		})
+	}
+	for _, l := range report.Recovered {
+		log.Printf("link %d (%s) recovered: %s", l.ID, l.ShortName, l.OriginalURL)
+	}
+}
+
+// maintainVisits keeps the visit partitions in shape and then rolls up the
+// visits past retention that a dropped partition did not already take care of.
+func maintainVisits(ctx context.Context, service *link.Service, partitions *postgres.VisitPartitions, retention time.Duration) {
+	now := time.Now()
+	var expireBefore time.Time
+	if retention > 0 {
+		expireBefore = now.Add(-retention)
+	}
+
+	report, err := partitions.Maintain(ctx, now, expireBefore)
+	if err != nil {
+		log.Printf("error: failed to maintain visit partitions: %v", err)
+	}
+	if len(report.Created) > 0 || len(report.Dropped) > 0 || report.Moved > 0 {
+		log.Printf("visit partitions: created %v, dropped %v, moved %d rows out of the default partition",
+			report.Created, report.Dropped, report.Moved)
+	}
+
+	if retention <= 0 {
+		return
+	}
+	rolled, err := service.RollupVisits(ctx, retention)
+	if err != nil {
+		log.Printf("error: failed to roll up visits: %v", err)
+		return
+	}
+	if rolled > 0 {
+		log.Printf("rolled up %d visits into daily stats", rolled)
+	}
 }
 
 func initRollbar(token string) {
@@ -42,8 +320,16 @@ func initRollbar(token string) {
 	rollbar.SetEnvironment("production")
 }
 
-func registerRoutes(r *gin.Engine, service *link.Service) {
-	handler := http.NewHandler(service)
+func registerRoutes(r *gin.Engine, service *link.Service, cfg *config.Config, limiters rateLimiters) {
+	handler := http.NewHandler(service, http.HandlerConfig{
+		DisabledStatus:     cfg.DisabledLinkStatus,
+		BannedStatus:       cfg.BannedLinkStatus,
+		BatchMaxOperations: cfg.BatchMaxOperations,
+		CreateLimiter:      limiters.create,
+		BulkLimiter:        limiters.bulk,
+		RedirectLimiter:    limiters.redirect,
+		ReportLimiter:      limiters.report,
+	})
 	handler.RegisterRoutes(r)
 
 	r.GET("/ping", func(c *gin.Context) {
@@ -51,24 +337,50 @@ func registerRoutes(r *gin.Engine, service *link.Service) {
 	})
 }
 
-func router(cfg *config.Config) *gin.Engine {
+// exposedHeaders are the response headers the UI may read across origins.
+var exposedHeaders = []string{
+	"ETag", "Content-Range", "Link", "X-Next-Cursor", "X-Prev-Cursor", "X-Total-Count",
+	"Retry-After", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+}
+
+func router(cfg *config.Config) (*gin.Engine, error) {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Logger(), gin.Recovery())
-	r.TrustedPlatform = gin.PlatformCloudflare
+
+	// Client addresses key rate limits and count abuse reporters, so the
+	// headers carrying them are only believed from known proxies.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	if len(cfg.ClientIPHeaders) > 0 {
+		r.RemoteIPHeaders = cfg.ClientIPHeaders
+	}
+	switch cfg.TrustedPlatform {
+	case "":
+	case "cloudflare":
+		r.TrustedPlatform = gin.PlatformCloudflare
+	default:
+		return nil, fmt.Errorf("TRUSTED_PLATFORM: unknown platform %q", cfg.TrustedPlatform)
+	}
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{cfg.UIURL},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "If-Match"},
+		ExposeHeaders:    exposedHeaders,
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	return r
+	return r, nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	cfg := config.Load()
 
 	initRollbar(cfg.RollbarToken)
@@ -76,6 +388,30 @@ func main() {
 
 	rollbar.Info("Application starting")
 
+	anonymizer, err := ipprivacy.New(cfg.IPPrivacyMode, cfg.IPHashSalt)
+	if err != nil {
+		log.Printf("error: invalid IP privacy settings: %v", err)
+		os.Exit(1)
+	}
+	if cfg.AbuseReportThreshold > 0 && !anonymizer.KeysReporters() {
+		log.Printf("warning: IP_HASH_SALT is needed to tell abuse reporters apart, links will not be disabled automatically")
+	}
+
+	blocked, err := loadBlocklist(cfg)
+	if err != nil {
+		log.Printf("error: invalid blocklist settings: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if blocked != nil && cfg.BlocklistMirrorURL != "" {
+		scheduler.Every(ctx, cfg.BlocklistRefreshInterval, func(ctx context.Context) {
+			refreshBlocklist(ctx, blocked, cfg.BlocklistMirrorURL)
+		})
+	}
+
 	var service *link.Service
 
 	db, err := connectDB(cfg.DatabaseURL)
@@ -88,11 +424,31 @@ func main() {
 				log.Printf("error: failed to close database: %v", err)
 			}
 		}()
-		service = createDependencies(db, cfg.BaseURL)
+		service = createDependencies(db, cfg, anonymizer, blocked)
+		startBackgroundJobs(ctx, service, postgres.NewVisitPartitions(db), cfg)
 	}
 
-	r := router(cfg)
-	registerRoutes(r, service)
+	limiters, err := newRateLimiters(cfg, db)
+	if err != nil {
+		log.Printf("error: invalid rate limit settings: %v", err)
+		os.Exit(1)
+	}
+	if limiters.shared != nil {
+		scheduler.Every(ctx, rateLimitPruneInterval, func(ctx context.Context) {
+			pruneRateLimits(ctx, limiters.shared, limiters.idle)
+		})
+	}
+
+	if err := checkClientIP(cfg, limiters); err != nil {
+		log.Printf("error: %v", err)
+		os.Exit(1)
+	}
+	r, err := router(cfg)
+	if err != nil {
+		log.Printf("error: invalid proxy settings: %v", err)
+		os.Exit(1)
+	}
+	registerRoutes(r, service, cfg, limiters)
 
 	if err := r.Run(":" + cfg.Port); err != nil {
 		log.Printf("error: failed to start server: %v", err)
@@ -2,15 +2,33 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"app/config"
 	"app/internal/application/link"
-	linkhttp "app/internal/infrastructure/http"
 	domainLink "app/internal/domain/link"
+	"app/internal/infrastructure/healthcheck"
+	linkhttp "app/internal/infrastructure/http"
+	"app/internal/infrastructure/metadata"
+	"app/internal/shared/blocklist"
+	"app/internal/shared/hll"
+	"app/internal/shared/ipprivacy"
+	"app/internal/shared/netguard"
+	"app/internal/shared/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
@@ -46,7 +64,7 @@ func TestAPIEndpoints(t *testing.T) {
 		nextID:          1,
 	}
 	service := link.NewService(repo, "https://short.io")
-	handler := linkhttp.NewHandler(service)
+	handler := linkhttp.NewHandler(service, linkhttp.HandlerConfig{})
 	handler.RegisterRoutes(router)
 
 	t.Run("GET /api/links returns empty list", func(t *testing.T) {
@@ -126,85 +144,2313 @@ func TestAPIEndpoints(t *testing.T) {
 	})
 }
 
-type mockRepository struct {
-	links           map[int64]*domainLink.Link
-	shortNameExists map[string]bool
-	nextID          int64
-}
+func newTestRouter() (*gin.Engine, *mockRepository) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
 
-func (m *mockRepository) Create(ctx context.Context, link *domainLink.Link) error {
-	link.ID = m.nextID
-	m.nextID++
-	m.links[link.ID] = link
-	m.shortNameExists[link.ShortName] = true
-	return nil
+	repo := &mockRepository{
+		links:           make(map[int64]*domainLink.Link),
+		shortNameExists: make(map[string]bool),
+		nextID:          1,
+	}
+	service := link.NewService(repo, "https://short.io")
+	handler := linkhttp.NewHandler(service, linkhttp.HandlerConfig{})
+	handler.RegisterRoutes(router)
+
+	return router, repo
 }
 
-func (m *mockRepository) GetByID(ctx context.Context, id int64) (*domainLink.Link, error) {
-	link, ok := m.links[id]
-	if !ok {
-		return nil, errors.New("link not found")
+const browserUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+func serve(router *gin.Engine, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
 	}
-	return link, nil
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
 }
 
-func (m *mockRepository) GetByShortName(ctx context.Context, shortName string) (*domainLink.Link, error) {
-	for _, link := range m.links {
-		if link.ShortName == shortName {
-			return link, nil
-		}
+func TestSoftDelete(t *testing.T) {
+	router, repo := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "trash"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
 	}
-	return nil, errors.New("link not found")
+
+	t.Run("DELETE /api/links/:id moves link to trash", func(t *testing.T) {
+		w := serve(router, http.MethodDelete, "/api/links/1", "")
+		if w.Code != http.StatusNoContent {
+			t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+		}
+		if _, ok := repo.links[1]; !ok {
+			t.Errorf("expected link to be kept in the repository")
+		}
+	})
+
+	t.Run("deleted link no longer redirects", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/r/trash", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("GET /api/links?deleted=true lists trash", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/links?deleted=true", "")
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if got := w.Header().Get("Content-Range"); got != "links 0-0/1" {
+			t.Errorf("expected Content-Range %q, got %q", "links 0-0/1", got)
+		}
+		if !strings.Contains(w.Body.String(), `"deleted_at"`) {
+			t.Errorf("expected deleted_at in body, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("POST /api/links/:id/restore brings link back", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/links/1/restore", "")
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		w = serve(router, http.MethodGet, "/r/trash", "")
+		if w.Code != http.StatusFound {
+			t.Errorf("expected status %d, got %d", http.StatusFound, w.Code)
+		}
+	})
+
+	t.Run("restoring a live link returns 404", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/links/1/restore", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
 }
 
-func (m *mockRepository) GetAll(ctx context.Context, offset, limit int) ([]*domainLink.Link, int, error) {
-	all := make([]*domainLink.Link, 0, len(m.links))
-	for _, l := range m.links {
-		all = append(all, l)
-	}
+func TestLinkStatus(t *testing.T) {
+	router, _ := newTestRouter()
 
-	total := len(all)
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "status"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
 
-	end := offset + limit
-	if end > total {
-		end = total
+	tests := []struct {
+		name         string
+		action       string
+		body         string
+		wantRedirect int
+		wantStatus   string
+	}{
+		{"disable", "disable", `{"reason": "under review"}`, http.StatusForbidden, "disabled"},
+		{"ban", "ban", `{"reason": "phishing"}`, http.StatusGone, "banned"},
+		{"activate", "activate", "", http.StatusFound, "active"},
 	}
 
-	if offset >= total {
-		return []*domainLink.Link{}, total, nil
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, "/api/links/1/"+tt.action, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), `"status":"`+tt.wantStatus+`"`) {
+				t.Errorf("expected status %q in body, got %s", tt.wantStatus, w.Body.String())
+			}
+
+			w = serve(router, http.MethodGet, "/r/status", "")
+			if w.Code != tt.wantRedirect {
+				t.Errorf("expected redirect status %d, got %d", tt.wantRedirect, w.Code)
+			}
+		})
 	}
 
-	return all[offset:end], total, nil
+	t.Run("unknown link returns 404", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/links/42/ban", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
 }
 
-func (m *mockRepository) Update(ctx context.Context, link *domainLink.Link) error {
-	if _, ok := m.links[link.ID]; !ok {
-		return errors.New("link not found")
+func TestOptimisticConcurrency(t *testing.T) {
+	router, _ := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "etag"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
 	}
-	m.links[link.ID] = link
-	return nil
+
+	body := `{"original_url": "https://example.org", "short_name": "etag"}`
+
+	t.Run("GET /api/links/:id returns ETag", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/links/1", "")
+		if got := w.Header().Get("ETag"); got != `"1"` {
+			t.Errorf("expected ETag %q, got %q", `"1"`, got)
+		}
+	})
+
+	t.Run("PUT without If-Match returns 428", func(t *testing.T) {
+		w := serve(router, http.MethodPut, "/api/links/1", body)
+		if w.Code != http.StatusPreconditionRequired {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionRequired, w.Code)
+		}
+	})
+
+	t.Run("PUT with matching If-Match updates link", func(t *testing.T) {
+		w := serve(router, http.MethodPut, "/api/links/1", body, "If-Match", `"1"`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if got := w.Header().Get("ETag"); got != `"2"` {
+			t.Errorf("expected ETag %q, got %q", `"2"`, got)
+		}
+	})
+
+	t.Run("PUT with stale If-Match returns 412", func(t *testing.T) {
+		w := serve(router, http.MethodPut, "/api/links/1", body, "If-Match", `"1"`)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+		}
+	})
+
+	t.Run("PUT with a weak If-Match returns 412", func(t *testing.T) {
+		w := serve(router, http.MethodPut, "/api/links/1", body, "If-Match", `W/"2"`)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+		}
+	})
+
+	t.Run("PUT with an If-Match list matches any listed tag", func(t *testing.T) {
+		w := serve(router, http.MethodPut, "/api/links/1", body, "If-Match", `"1", W/"2", "2"`)
+		if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+			t.Fatalf("expected the update, got %d %s", w.Code, w.Body.String())
+		}
+		w = serve(router, http.MethodPut, "/api/links/1", body, "If-Match", `"1", "2"`)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+		}
+		w = serve(router, http.MethodPut, "/api/links/1", body, "If-Match", `"1", etag`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
 }
 
-func (m *mockRepository) Delete(ctx context.Context, id int64) error {
-	if _, ok := m.links[id]; !ok {
-		return errors.New("link not found")
+func TestMergePatch(t *testing.T) {
+	router, repo := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "patch"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
 	}
-	delete(m.links, id)
-	return nil
+
+	const mergePatch = "application/merge-patch+json"
+
+	t.Run("PATCH updates only provided fields", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/1", `{"short_name": "patched"}`, "Content-Type", mergePatch, "If-Match", `"1"`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if got := repo.links[1]; got.ShortName != "patched" || got.OriginalURL != "https://example.com" {
+			t.Errorf("unexpected link after patch: %+v", got)
+		}
+	})
+
+	t.Run("PATCH with null required field returns 422", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/1", `{"original_url": null}`, "Content-Type", mergePatch, "If-Match", "*")
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	})
+
+	t.Run("PATCH with invalid field returns 422", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/1", `{"short_name": "ab"}`, "Content-Type", mergePatch, "If-Match", "*")
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	})
+
+	t.Run("PATCH with unsupported content type returns 415", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/1", `{"short_name": "other"}`, "Content-Type", "text/plain", "If-Match", "*")
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, w.Code)
+		}
+	})
+
+	t.Run("PATCH without If-Match returns 428", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/1", `{"short_name": "other"}`, "Content-Type", mergePatch)
+		if w.Code != http.StatusPreconditionRequired {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionRequired, w.Code)
+		}
+		if got := repo.links[1]; got.ShortName != "patched" {
+			t.Errorf("expected the link unchanged, got %+v", got)
+		}
+	})
+
+	t.Run("PATCH with stale If-Match returns 412", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/1", `{"short_name": "other"}`, "Content-Type", mergePatch, "If-Match", `"1"`)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+		}
+	})
 }
 
-func (m *mockRepository) ExistsByShortName(ctx context.Context, shortName string) (bool, error) {
-	return m.shortNameExists[shortName], nil
+func TestBatch(t *testing.T) {
+	t.Run("non-atomic batch reports each result", func(t *testing.T) {
+		router, repo := newTestRouter()
+
+		body := `{"operations": [
+			{"op": "create", "original_url": "https://example.com/a", "short_name": "batch-a"},
+			{"op": "create", "original_url": "not-a-url"},
+			{"op": "create", "original_url": "https://example.com/a", "short_name": "batch-a"},
+			{"op": "delete", "id": 1}
+		]}`
+		w := serve(router, http.MethodPost, "/api/links/batch", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		for _, want := range []string{`"status":201`, `"original_url":"must be a valid URL"`, `"short_name":"short name already in use"`, `"status":204`} {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("expected %s in body, got %s", want, w.Body.String())
+			}
+		}
+		if !repo.links[1].IsDeleted() {
+			t.Errorf("expected link 1 to be deleted")
+		}
+	})
+
+	t.Run("atomic batch rolls back on failure", func(t *testing.T) {
+		router, repo := newTestRouter()
+
+		body := `{"atomic": true, "operations": [
+			{"op": "create", "original_url": "https://example.com/a", "short_name": "batch-a"},
+			{"op": "update", "id": 42, "short_name": "batch-b"}
+		]}`
+		w := serve(router, http.MethodPost, "/api/links/batch", body)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `"status":424`) || !strings.Contains(w.Body.String(), `"status":404`) {
+			t.Errorf("unexpected body %s", w.Body.String())
+		}
+		if len(repo.links) != 0 {
+			t.Errorf("expected no links after rollback, got %d", len(repo.links))
+		}
+	})
+
+	t.Run("batch over the limit returns 422", func(t *testing.T) {
+		router, _ := newTestRouter()
+
+		ops := make([]string, 101)
+		for i := range ops {
+			ops[i] = `{"op": "delete", "id": 1}`
+		}
+		w := serve(router, http.MethodPost, "/api/links/batch", `{"operations": [`+strings.Join(ops, ",")+`]}`)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	})
+
+	t.Run("atomic batch queues metadata only after commit", func(t *testing.T) {
+		repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+		fetcher := &recordingFetcher{fetched: make(chan string, 10)}
+		service := link.NewService(repo, "https://short.io", link.WithMetadataFetcher(fetcher, 10))
+		ctx := context.Background()
+
+		if _, err := service.ApplyBatch(ctx, []link.BatchOperation{
+			{Op: link.BatchCreate, OriginalURL: "https://example.com/rolled-back"},
+			{Op: link.BatchDelete, ID: 42},
+		}, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.ApplyBatch(ctx, []link.BatchOperation{
+			{Op: link.BatchCreate, OriginalURL: "https://example.com/committed"},
+		}, true); err != nil {
+			t.Fatal(err)
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go service.RunMetadataFetcher(runCtx, func(error) {})
+
+		select {
+		case url := <-fetcher.fetched:
+			if url != "https://example.com/committed" {
+				t.Errorf("expected only the committed link to be fetched, got %s", url)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the metadata fetcher")
+		}
+	})
 }
 
-func (m *mockRepository) CreateVisit(ctx context.Context, visit *domainLink.LinkVisit) error {
-	return nil
+func TestImport(t *testing.T) {
+	waitForImport := func(t *testing.T, router *gin.Engine, location string) map[string]any {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			w := serve(router, http.MethodGet, location, "")
+			var job map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+				t.Fatalf("invalid job response: %v", err)
+			}
+			if job["status"] == "completed" {
+				return job
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("import did not complete")
+		return nil
+	}
+
+	t.Run("Bitly CSV export", func(t *testing.T) {
+		router, repo := newTestRouter()
+
+		body := "created_at,title,link,custom_bitlinks,long_url,tags\n" +
+			"2024-01-01,Home,https://bit.ly/3abcdef,,https://example.com,\"spring,promo\"\n" +
+			"2024-01-02,Docs,https://bit.ly/3ghijkl,https://bit.ly/docs,https://example.com/docs,\n" +
+			"2024-01-03,Broken,https://bit.ly/3mnopqr,,javascript-not-a-url,\n" +
+			"2024-01-04,No code,bit.ly/,,https://example.com/none,\n"
+		w := serve(router, http.MethodPost, "/api/links/import", body, "Content-Type", "text/csv")
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+		}
+
+		job := waitForImport(t, router, w.Header().Get("Location"))
+		if job["imported"] != float64(2) || job["failed"] != float64(2) {
+			t.Errorf("unexpected job %v", job)
+		}
+		if errs, _ := json.Marshal(job["errors"]); !strings.Contains(string(errs), `{"errors":{"short_name":"short URL has no short name: \"https://bit.ly/\""},"row":5}`) {
+			t.Errorf("expected the row without a code to fail, got %s", errs)
+		}
+
+		names := map[string][]string{}
+		for _, l := range repo.links {
+			names[l.ShortName] = l.Tags
+		}
+		if tags, ok := names["3abcdef"]; !ok || len(tags) != 2 {
+			t.Errorf("expected 3abcdef with two tags, got %v", names)
+		}
+		if _, ok := names["docs"]; !ok {
+			t.Errorf("expected custom bitlink to be used, got %v", names)
+		}
+	})
+
+	t.Run("YOURLS JSON dry run", func(t *testing.T) {
+		router, repo := newTestRouter()
+
+		body := `{"links": {"link_1": {"shorturl": "https://sho.rt/abc", "url": "https://example.com"}, "link_2": {"shorturl": "https://sho.rt/abc", "url": "https://example.org"}}}`
+		w := serve(router, http.MethodPost, "/api/links/import?dry_run=true", body)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+		}
+
+		job := waitForImport(t, router, w.Header().Get("Location"))
+		if job["imported"] != float64(1) || job["failed"] != float64(1) {
+			t.Errorf("unexpected job %v", job)
+		}
+		if len(repo.links) != 0 {
+			t.Errorf("expected dry run to store nothing, got %d links", len(repo.links))
+		}
+	})
+
+	t.Run("file without URL column returns 422", func(t *testing.T) {
+		router, _ := newTestRouter()
+
+		w := serve(router, http.MethodPost, "/api/links/import?format=csv", "name,code\nfoo,bar\n")
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	})
+
+	t.Run("oversized upload returns 413", func(t *testing.T) {
+		router, _ := newTestRouter()
+
+		body := "--import\r\n" +
+			"Content-Disposition: form-data; name=\"file\"; filename=\"links.csv\"\r\n" +
+			"Content-Type: text/csv\r\n\r\n" +
+			"url\n" + strings.Repeat("https://example.com/\n", 600_000) +
+			"\r\n--import--\r\n"
+		w := serve(router, http.MethodPost, "/api/links/import", body, "Content-Type", "multipart/form-data; boundary=import")
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("unknown job returns 404", func(t *testing.T) {
+		router, _ := newTestRouter()
+
+		w := serve(router, http.MethodGet, "/api/links/import/missing", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
 }
 
-func (m *mockRepository) GetVisits(ctx context.Context, offset, limit int) ([]*domainLink.LinkVisit, int, error) {
-	return []*domainLink.LinkVisit{}, 0, nil
+func TestExport(t *testing.T) {
+	router, _ := newTestRouter()
+
+	for _, name := range []string{"export-a", "export-b"} {
+		if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com/`+name+`", "short_name": "`+name+`", "tags": ["x", "y"]}`); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+	serve(router, http.MethodGet, "/r/export-b", "")
+
+	t.Run("links as CSV", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/links/export?format=csv", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected header and 2 rows, got %q", w.Body.String())
+		}
+		if !strings.HasPrefix(lines[0], "id,original_url,short_name") {
+			t.Errorf("unexpected header %q", lines[0])
+		}
+		if !strings.Contains(lines[1], "export-a") || !strings.Contains(lines[1], "x;y") {
+			t.Errorf("unexpected row %q", lines[1])
+		}
+	})
+
+	t.Run("visits as NDJSON via Accept", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/link_visits/export?link_id=2", "", "Accept", "application/x-ndjson")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+
+		var visit map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &visit); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", w.Body.String(), err)
+		}
+		if visit["link_id"] != float64(2) {
+			t.Errorf("unexpected visit %v", visit)
+		}
+	})
+
+	t.Run("CSV cells that look like formulas are quoted", func(t *testing.T) {
+		serve(router, http.MethodGet, "/r/export-a", "", "User-Agent", `=HYPERLINK("https://evil.example")`, "Referer", "@SUM(A1)")
+
+		w := serve(router, http.MethodGet, "/api/link_visits/export?link_id=1&format=csv", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if body := w.Body.String(); !strings.Contains(body, `"'=HYPERLINK(""https://evil.example"")"`) || !strings.Contains(body, ",'@SUM(A1),") {
+			t.Errorf("expected formulas to be quoted, got %q", body)
+		}
+	})
+
+	t.Run("unknown format returns 400", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/links/export?format=xml", "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
 }
 
-func (m *mockRepository) DeleteVisit(ctx context.Context, id int64) error {
-	return nil
+func TestListFilterAndSort(t *testing.T) {
+	router, _ := newTestRouter()
+
+	links := []string{
+		`{"original_url": "https://example.com/spring", "short_name": "spring", "tags": ["promo"]}`,
+		`{"original_url": "https://example.com/summer", "short_name": "summer", "tags": ["promo", "2024"]}`,
+		`{"original_url": "https://example.org/docs", "short_name": "docs"}`,
+	}
+	for _, body := range links {
+		if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"search", `filter={"q":"example.com"}`, []string{"spring", "summer"}},
+		{"tags", `filter={"tags":["promo","2024"]}`, []string{"summer"}},
+		{"sort desc", `sort=["short_name","DESC"]`, []string{"summer", "spring", "docs"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/api/links?"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			var got []linkhttp.LinkResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			names := make([]string, len(got))
+			for i, l := range got {
+				names[i] = l.ShortName
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, names)
+			}
+		})
+	}
+
+	for _, query := range []string{`filter={"unknown":1}`, `filter=not-json`, `sort=["password","ASC"]`, `sort=["id","SIDEWAYS"]`} {
+		t.Run("rejects "+query, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/api/links?"+query, "")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	router, _ := newTestRouter()
+
+	for _, name := range []string{"page-a", "page-b", "page-c", "page-d", "page-e"} {
+		body := `{"original_url": "https://example.com/` + name + `", "short_name": "` + name + `"}`
+		if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	page := func(query string) ([]string, *httptest.ResponseRecorder) {
+		t.Helper()
+		w := serve(router, http.MethodGet, "/api/links?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var got []linkhttp.LinkResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		names := make([]string, len(got))
+		for i, l := range got {
+			names[i] = l.ShortName
+		}
+		return names, w
+	}
+
+	names, w := page("cursor=&limit=2&count=exact")
+	if strings.Join(names, ",") != "page-e,page-d" {
+		t.Fatalf("unexpected first page %v", names)
+	}
+	if w.Header().Get("X-Prev-Cursor") != "" {
+		t.Error("expected no previous cursor on the first page")
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "5" {
+		t.Errorf("expected total 5, got %q", total)
+	}
+	if !strings.Contains(w.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("expected a next link, got %q", w.Header().Get("Link"))
+	}
+
+	names, w = page("cursor=" + w.Header().Get("X-Next-Cursor") + "&limit=2")
+	if strings.Join(names, ",") != "page-c,page-b" {
+		t.Fatalf("unexpected second page %v", names)
+	}
+	if w.Header().Get("X-Total-Count") != "" {
+		t.Error("expected no total without count")
+	}
+	next := w.Header().Get("X-Next-Cursor")
+
+	names, _ = page("cursor=" + w.Header().Get("X-Prev-Cursor") + "&limit=2")
+	if strings.Join(names, ",") != "page-e,page-d" {
+		t.Errorf("unexpected previous page %v", names)
+	}
+
+	names, w = page("cursor=" + next + "&limit=2")
+	if strings.Join(names, ",") != "page-a" || w.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("unexpected last page %v", names)
+	}
+
+	if w := serve(router, http.MethodGet, "/api/links?range=[0,2]&count=none", ""); w.Header().Get("Content-Range") != "links 0-1/*" {
+		t.Errorf("unexpected Content-Range %q", w.Header().Get("Content-Range"))
+	}
+
+	for _, query := range []string{"cursor=garbage", "cursor=&count=maybe", `cursor=&sort=["id","ASC"]`} {
+		t.Run("rejects "+query, func(t *testing.T) {
+			if w := serve(router, http.MethodGet, "/api/links?"+query, ""); w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestVisitFilters(t *testing.T) {
+	router, repo := newTestRouter()
+
+	for _, name := range []string{"first", "second"} {
+		body := `{"original_url": "https://example.com/` + name + `", "short_name": "` + name + `"}`
+		if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+	now := time.Now()
+	repo.visits = []*domainLink.LinkVisit{
+		{ID: 1, LinkID: 1, IP: "10.0.0.1", Referer: "https://news.example/a", Status: 302, CreatedAt: now.Add(-48 * time.Hour)},
+		{ID: 2, LinkID: 1, IP: "10.0.0.2", Referer: "https://chat.example", Status: 302, CreatedAt: now},
+		{ID: 3, LinkID: 2, IP: "10.0.0.1", Status: 410, CreatedAt: now},
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []int64
+	}{
+		{"all", "/api/link_visits", []int64{3, 2, 1}},
+		{"link", "/api/link_visits?link_id=1", []int64{2, 1}},
+		{"nested", "/api/links/2/visits", []int64{3}},
+		{"ip", "/api/link_visits?ip=10.0.0.1", []int64{3, 1}},
+		{"status", "/api/link_visits?status=410", []int64{3}},
+		{"referer", "/api/links/1/visits?referer=news", []int64{1}},
+		{"from", "/api/link_visits?from=" + now.Add(-time.Hour).UTC().Format(time.RFC3339), []int64{3, 2}},
+		{"filter json", `/api/link_visits?filter={"link_id":1,"ip":"10.0.0.2"}`, []int64{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			var got []linkhttp.VisitResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			ids := make([]int64, len(got))
+			for i, v := range got {
+				ids[i] = v.ID
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, ids)
+			}
+		})
+	}
+
+	if w := serve(router, http.MethodGet, "/api/links/99/visits", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	for _, query := range []string{"status=abc", `filter={"password":1}`, "from=yesterday"} {
+		if w := serve(router, http.MethodGet, "/api/link_visits?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestVisitErasure(t *testing.T) {
+	router, repo := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "gdpr"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo.visits = []*domainLink.LinkVisit{
+		{ID: 1, LinkID: 1, IP: "203.0.113.7", Status: 302, CreatedAt: day},
+		{ID: 2, LinkID: 1, IP: "203.0.113.7", Status: 302, CreatedAt: day.AddDate(0, 1, 0)},
+		{ID: 3, LinkID: 1, IP: "198.51.100.1", Status: 302, CreatedAt: day},
+	}
+	repo.links[1].ClickCount = 3
+
+	if w := serve(router, http.MethodDelete, "/api/link_visits", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without criteria, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := serve(router, http.MethodGet, "/api/link_visits/subject?ip=203.0.113.7&format=ndjson", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if lines := strings.Count(w.Body.String(), "\n"); lines != 2 {
+		t.Errorf("expected 2 exported visits, got %d", lines)
+	}
+
+	w = serve(router, http.MethodDelete, "/api/link_visits?ip=203.0.113.7&before=2024-04-01", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp linkhttp.DeleteVisitsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp.Deleted != 1 || len(repo.visits) != 2 {
+		t.Errorf("expected 1 visit deleted and 2 left, got %d and %d", resp.Deleted, len(repo.visits))
+	}
+
+	if len(repo.audits) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(repo.audits))
+	}
+	if repo.audits[0].Action != domainLink.AuditVisitsSubjectExport || repo.audits[0].Affected != 2 {
+		t.Errorf("unexpected export audit %+v", repo.audits[0])
+	}
+	if repo.audits[1].Action != domainLink.AuditVisitsDeleted || repo.audits[1].Affected != 1 {
+		t.Errorf("unexpected delete audit %+v", repo.audits[1])
+	}
+	for _, audit := range repo.audits {
+		if criteria, _ := json.Marshal(audit.Criteria); strings.Contains(string(criteria), "203.0.113.7") {
+			t.Errorf("expected no raw address in the audit log, got %s", criteria)
+		}
+	}
+	if repo.links[1].ClickCount != 2 {
+		t.Errorf("expected the erased visit taken out of the click count, got %d", repo.links[1].ClickCount)
+	}
+}
+
+func TestIPPrivacy(t *testing.T) {
+	for _, mode := range []string{"truncate", "hash"} {
+		t.Run(mode, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			repo := &mockRepository{
+				links:           make(map[int64]*domainLink.Link),
+				shortNameExists: make(map[string]bool),
+				nextID:          1,
+			}
+			anonymizer, err := ipprivacy.New(mode, "pepper")
+			if err != nil {
+				t.Fatal(err)
+			}
+			service := link.NewService(repo, "https://short.io", link.WithIPAnonymizer(anonymizer))
+			linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+
+			if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "private"}`); w.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+			}
+			for _, ip := range []string{"203.0.113.77", "203.0.113.77", "198.51.100.1"} {
+				req := httptest.NewRequest(http.MethodGet, "/r/private", nil)
+				req.RemoteAddr = ip + ":4321"
+				router.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			if len(repo.visits) != 3 {
+				t.Fatalf("expected 3 visits, got %d", len(repo.visits))
+			}
+			for _, v := range repo.visits {
+				if v.IP == "203.0.113.77" || v.IP == "198.51.100.1" {
+					t.Fatalf("raw IP %q was stored", v.IP)
+				}
+			}
+			if repo.visits[0].IP != repo.visits[1].IP {
+				t.Errorf("expected the same visitor to be stored alike, got %q and %q", repo.visits[0].IP, repo.visits[1].IP)
+			}
+
+			w := serve(router, http.MethodDelete, "/api/link_visits?ip=203.0.113.77", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if len(repo.visits) != 1 {
+				t.Errorf("expected the raw IP to match its stored visits, %d left", len(repo.visits))
+			}
+		})
+	}
+}
+
+func TestLinkStats(t *testing.T) {
+	router, repo := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "stats"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour).Add(time.Hour)
+	repo.visits = []*domainLink.LinkVisit{
+		{ID: 1, LinkID: 1, IP: "10.0.0.1", Referer: "https://news.example", Status: http.StatusFound, CreatedAt: today.AddDate(0, 0, -40)},
+		{ID: 2, LinkID: 1, IP: "10.0.0.2", Status: http.StatusFound, CreatedAt: today.AddDate(0, 0, -40)},
+		{ID: 3, LinkID: 1, IP: "10.0.0.1", Referer: "https://news.example", Status: http.StatusFound, CreatedAt: today},
+	}
+
+	service := link.NewService(repo, "https://short.io")
+	rolled, err := service.RollupVisits(context.Background(), 30*24*time.Hour)
+	if err != nil || rolled != 2 {
+		t.Fatalf("expected 2 visits rolled up, got %d (%v)", rolled, err)
+	}
+	if len(repo.visits) != 1 {
+		t.Fatalf("expected 1 raw visit left, got %d", len(repo.visits))
+	}
+
+	w := serve(router, http.MethodGet, "/api/links/1/stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var stats linkhttp.StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if stats.Clicks != 3 || len(stats.Days) != 2 {
+		t.Errorf("expected 3 clicks over 2 days, got %d over %d", stats.Clicks, len(stats.Days))
+	}
+	if len(stats.TopReferrers) == 0 || stats.TopReferrers[0].Referer != "https://news.example" || stats.TopReferrers[0].Clicks != 2 {
+		t.Errorf("unexpected top referrers %+v", stats.TopReferrers)
+	}
+
+	w = serve(router, http.MethodGet, "/api/links/1/stats?from="+today.Format("2006-01-02"), "")
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || stats.Clicks != 1 {
+		t.Errorf("expected 1 click since today, got %d (%v)", stats.Clicks, err)
+	}
+
+	if w := serve(router, http.MethodGet, "/api/links/99/stats", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	for _, query := range []string{"status=302", "ip=203.0.113.1", "referer=example"} {
+		if w := serve(router, http.MethodGet, "/api/links/1/stats?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	t.Run("clicks agree with the click count", func(t *testing.T) {
+		if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com/notice", "short_name": "notice"}`); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+		serve(router, http.MethodGet, "/r/notice", "", "User-Agent", browserUserAgent)
+		serve(router, http.MethodPost, "/api/links/2/disable", `{"reason": "under review"}`)
+		if w := serve(router, http.MethodGet, "/r/notice", "", "User-Agent", browserUserAgent); w.Code != http.StatusForbidden {
+			t.Fatalf("expected the notice page, got %d", w.Code)
+		}
+
+		var stats linkhttp.StatsResponse
+		w := serve(router, http.MethodGet, "/api/links/2/stats", "")
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		if stats.Clicks != repo.links[2].ClickCount || stats.Clicks != 1 || stats.Visits != 2 {
+			t.Errorf("expected 1 click as counted and 2 visits, got %d clicks, %d visits, click count %d",
+				stats.Clicks, stats.Visits, repo.links[2].ClickCount)
+		}
+	})
+}
+
+func TestUniqueVisitors(t *testing.T) {
+	router, repo := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "uniques"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour).Add(time.Hour)
+	repo.visits = []*domainLink.LinkVisit{
+		{ID: 1, LinkID: 1, IP: "10.0.0.1", Status: http.StatusFound, CreatedAt: today.AddDate(0, 0, -1)},
+		{ID: 2, LinkID: 1, IP: "10.0.0.1", Status: http.StatusFound, CreatedAt: today},
+		{ID: 3, LinkID: 1, IP: "10.0.0.2", Status: http.StatusFound, CreatedAt: today},
+		{ID: 4, LinkID: 1, IP: "10.0.0.2", Status: http.StatusFound, CreatedAt: today},
+	}
+
+	var stats linkhttp.StatsResponse
+	w := serve(router, http.MethodGet, "/api/links/1/stats", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if stats.Clicks != 4 || stats.Uniques != 2 {
+		t.Errorf("expected 4 clicks from 2 visitors, got %d from %d", stats.Clicks, stats.Uniques)
+	}
+	if len(stats.Days) != 2 || stats.Days[0].Uniques != 1 || stats.Days[1].Uniques != 2 {
+		t.Errorf("unexpected daily uniques %+v", stats.Days)
+	}
+
+	w = serve(router, http.MethodGet, "/api/links/1/stats?from="+today.Format("2006-01-02"), "")
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || stats.Uniques != 2 {
+		t.Errorf("expected 2 visitors since today, got %d (%v)", stats.Uniques, err)
+	}
+}
+
+func TestVisitClassification(t *testing.T) {
+	router, repo := newTestRouter()
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "paste"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	requests := []struct {
+		headers []string
+		want    domainLink.VisitClass
+	}{
+		{[]string{"User-Agent", browserUserAgent}, domainLink.VisitHuman},
+		{[]string{"User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"}, domainLink.VisitPreview},
+		{[]string{"User-Agent", "facebookexternalhit/1.1"}, domainLink.VisitPreview},
+		{[]string{"User-Agent", "curl/8.5.0"}, domainLink.VisitBot},
+		{[]string{"User-Agent", browserUserAgent, "Sec-Purpose", "prefetch;prerender"}, domainLink.VisitPrefetch},
+		{[]string{"User-Agent", browserUserAgent, "Purpose", "prefetch"}, domainLink.VisitPrefetch},
+		{nil, domainLink.VisitBot},
+	}
+	for i, r := range requests {
+		if w := serve(router, http.MethodGet, "/r/paste", "", r.headers...); w.Code != http.StatusFound {
+			t.Fatalf("expected status %d, got %d", http.StatusFound, w.Code)
+		}
+		if got := repo.visits[i].Class; got != r.want {
+			t.Errorf("request %d: expected class %q, got %q", i, r.want, got)
+		}
+	}
+
+	if repo.links[1].ClickCount != 1 {
+		t.Errorf("expected only the human visit counted, got %d", repo.links[1].ClickCount)
+	}
+
+	for target, want := range map[string]int64{
+		"/api/links/1/stats":               1,
+		"/api/links/1/stats?class=all":     7,
+		"/api/links/1/stats?class=preview": 2,
+	} {
+		var stats linkhttp.StatsResponse
+		w := serve(router, http.MethodGet, target, "")
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || stats.Clicks != want {
+			t.Errorf("%s: expected %d clicks, got %d (%v)", target, want, stats.Clicks, err)
+		}
+	}
+	if w := serve(router, http.MethodGet, "/api/links/1/stats?class=robot", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := serve(router, http.MethodGet, `/api/link_visits?filter={"class":"bot"}`, "")
+	var visits []linkhttp.VisitResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &visits); err != nil || len(visits) != 2 {
+		t.Errorf("expected 2 bot visits, got %d (%v)", len(visits), err)
+	}
+}
+
+func TestLinkPreview(t *testing.T) {
+	router, _ := newTestRouter()
+
+	body := `{"original_url": "https://example.com/launch", "short_name": "launch",
+		"og_title": "Launch <day>", "og_description": "Everything new", "og_image": "https://cdn.example.com/card.png"}`
+	w := serve(router, http.MethodPost, "/api/links", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created linkhttp.LinkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.OGTitle != "Launch <day>" || created.OGImage != "https://cdn.example.com/card.png" {
+		t.Fatalf("unexpected link %+v (%v)", created, err)
+	}
+
+	w = serve(router, http.MethodGet, "/r/launch", "", "User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected crawlers to get status %d, got %d", http.StatusOK, w.Code)
+	}
+	for _, want := range []string{
+		`<meta property="og:title" content="Launch &lt;day&gt;">`,
+		`<meta property="og:description" content="Everything new">`,
+		`<meta property="og:image" content="https://cdn.example.com/card.png">`,
+		`<meta property="og:url" content="https://short.io/r/launch">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected page to contain %s, got:\n%s", want, w.Body.String())
+		}
+	}
+
+	if w := serve(router, http.MethodGet, "/r/launch", "", "User-Agent", browserUserAgent); w.Code != http.StatusFound {
+		t.Errorf("expected humans to be redirected, got %d", w.Code)
+	}
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "og_image": "ftp://example.com/card.png"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d for a non-http image, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	patch := `{"og_title": null, "og_description": null, "og_image": null}`
+	if w := serve(router, http.MethodPatch, "/api/links/1", patch, "Content-Type", "application/merge-patch+json", "If-Match", "*"); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := serve(router, http.MethodGet, "/r/launch", "", "User-Agent", "Twitterbot/1.0"); w.Code != http.StatusFound {
+		t.Errorf("expected crawlers to be redirected once the preview is cleared, got %d", w.Code)
+	}
+}
+
+func TestLinkMetadata(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = io.WriteString(w, `<!DOCTYPE html><html><head>
+				<title>
+					Ten things about   links
+				</title>
+				<meta name="description" content="A long read.">
+				<link rel="shortcut icon" href="/static/icon.png">
+				</head><body><title>not this one</title></body></html>`)
+		default:
+			http.Error(w, "gone", http.StatusInternalServerError)
+		}
+	}))
+	defer destination.Close()
+
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+	fetcher := metadata.NewFetcher(netguard.NewClient(netguard.Config{AllowPrivate: true}), 0)
+	service := link.NewService(repo, "https://short.io", link.WithMetadataFetcher(fetcher, 10))
+	router := gin.New()
+	linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+
+	body := `{"original_url": "` + destination.URL + `/article", "short_name": "article"}`
+	if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	repo.links[2] = &domainLink.Link{ID: 2, OriginalURL: destination.URL + "/broken", ShortName: "broken", Status: domainLink.StatusActive}
+	if queued, err := service.QueueMissingMetadata(context.Background()); err != nil || queued != 2 {
+		t.Fatalf("expected 2 links queued, got %d (%v)", queued, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 10)
+	done := make(chan struct{})
+	go func() {
+		service.RunMetadataFetcher(ctx, func(err error) { errs <- err })
+		close(done)
+	}()
+
+	// Jobs run in order, so the broken link failing means the rest is done.
+	select {
+	case err := <-errs:
+		if !errors.Is(err, metadata.ErrUnexpectedStatus) {
+			t.Errorf("expected %v, got %v", metadata.ErrUnexpectedStatus, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the metadata fetcher")
+	}
+	cancel()
+	<-done
+
+	var got linkhttp.LinkResponse
+	w := serve(router, http.MethodGet, "/api/links/1", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if got.Title != "Ten things about links" || got.Description != "A long read." || got.FaviconURL != destination.URL+"/static/icon.png" {
+		t.Errorf("unexpected metadata %q, %q, %q", got.Title, got.Description, got.FaviconURL)
+	}
+	if repo.links[2].Metadata.FetchedAt == nil {
+		t.Error("expected the failed fetch to be recorded")
+	}
+
+	blocked, err := metadata.NewFetcher(netguard.NewClient(netguard.Config{}), 0).Fetch(context.Background(), destination.URL+"/article")
+	if !errors.Is(err, netguard.ErrBlockedAddress) || blocked.Title != "" {
+		t.Errorf("expected the local server to be refused, got %+v (%v)", blocked, err)
+	}
+}
+
+func TestLinkHealth(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+		case "/final":
+			w.WriteHeader(http.StatusOK)
+		case "/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer destination.Close()
+
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+	checker := healthcheck.NewChecker(netguard.NewClient(netguard.Config{AllowPrivate: true}))
+	service := link.NewService(repo, "https://short.io", link.WithHealthChecker(checker, 2))
+	router := gin.New()
+	linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+
+	for _, name := range []string{"moved", "get-only", "down"} {
+		body := `{"original_url": "` + destination.URL + `/` + name + `", "short_name": "` + name + `"}`
+		if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	for round, wantBroken := range []int{0, 1} {
+		report, err := service.CheckLinksHealth(context.Background(), 0, 10)
+		if err != nil || report.Checked != 3 || len(report.Broken) != wantBroken {
+			t.Fatalf("round %d: unexpected report %+v (%v)", round+1, report, err)
+		}
+	}
+
+	var health linkhttp.HealthResponse
+	w := serve(router, http.MethodGet, "/api/links/3/health", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if !health.Broken || health.ConsecutiveFailures != 2 || len(health.Checks) != 2 || health.Checks[0].StatusCode != http.StatusServiceUnavailable || health.Checks[0].OK {
+		t.Errorf("unexpected health %+v", health)
+	}
+
+	w = serve(router, http.MethodGet, "/api/links/1/health", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if health.Broken || !health.Checks[0].OK || len(health.Checks[0].RedirectChain) != 1 || health.Checks[0].RedirectChain[0] != destination.URL+"/final" {
+		t.Errorf("unexpected health %+v", health)
+	}
+	if repo.links[2].Health.ConsecutiveFailures != 0 {
+		t.Error("expected a refused HEAD to fall back to GET")
+	}
+
+	var got []linkhttp.LinkResponse
+	w = serve(router, http.MethodGet, "/api/links?broken=true", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(got) != 1 || got[0].ShortName != "down" || !got[0].Broken {
+		t.Errorf("unexpected broken links %+v", got)
+	}
+
+	repo.links[3].OriginalURL = destination.URL + "/final"
+	report, err := service.CheckLinksHealth(context.Background(), 0, 10)
+	if err != nil || len(report.Recovered) != 1 || report.Recovered[0].ID != 3 {
+		t.Errorf("expected link 3 to recover, got %+v (%v)", report, err)
+	}
+
+	if w := serve(router, http.MethodGet, "/api/links/99/health", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if pruned, err := service.PruneHealthChecks(context.Background(), -time.Hour); err != nil || pruned != 9 {
+		t.Errorf("expected 9 checks pruned, got %d (%v)", pruned, err)
+	}
+
+	repo.links[3].Health = domainLink.HealthStatus{Broken: true, ConsecutiveFailures: 2, CheckedAt: &repo.links[3].CreatedAt}
+	w = serve(router, http.MethodPatch, "/api/links/3", `{"original_url": "`+destination.URL+`/elsewhere"}`, "If-Match", "*")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"broken":true`) {
+		t.Fatalf("expected the new URL to start out healthy, got %d %s", w.Code, w.Body.String())
+	}
+	if h := repo.links[3].Health; h.ConsecutiveFailures != 0 || h.CheckedAt != nil {
+		t.Errorf("expected the health reset, got %+v", h)
+	}
+}
+
+type fakeResolver map[string][]netip.Addr
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestDestinationPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+	policy := domainLink.DestinationPolicy{
+		AllowedDomains: []string{"example.com", "evil.example"},
+		DeniedDomains:  []string{"evil.example"},
+	}
+	resolver := fakeResolver{
+		"example.com":          {netip.MustParseAddr("93.184.215.14")},
+		"intranet.example.com": {netip.MustParseAddr("10.0.0.5")},
+	}
+	service := link.NewService(repo, "https://short.io", link.WithDestinationPolicy(policy, resolver))
+	router := gin.New()
+	linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+
+	refused := map[string]string{
+		"javascript://example.com/%0aalert(1)": domainLink.ErrSchemeNotAllowed.Error(),
+		"ftp://example.com/file":               domainLink.ErrSchemeNotAllowed.Error(),
+		"https://short.io/r/abc":               domainLink.ErrRedirectLoop.Error(),
+		"https://WWW.Short.io./r/abc":          domainLink.ErrRedirectLoop.Error(),
+		"https://a.evil.example/":              domainLink.ErrDomainDenied.Error(),
+		"https://other.org/":                   domainLink.ErrDomainNotAllowed.Error(),
+		"http://127.0.0.1:8080/admin":          domainLink.ErrDomainNotAllowed.Error(),
+		"http://intranet.example.com/":         domainLink.ErrPrivateDestination.Error(),
+		"https://typo.example.com/":            domainLink.ErrUnresolvableDestination.Error(),
+	}
+	for destination, want := range refused {
+		w := serve(router, http.MethodPost, "/api/links", `{"original_url": "`+destination+`"}`)
+		var got linkhttp.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: invalid response: %v", destination, err)
+		}
+		if w.Code != http.StatusUnprocessableEntity || got.Errors["original_url"] != want {
+			t.Errorf("%s: expected %q, got %d %s", destination, want, w.Code, w.Body.String())
+		}
+	}
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com/ok", "short_name": "fine"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	w := serve(router, http.MethodPatch, "/api/links/1", `{"original_url": "https://short.io/r/fine"}`, "If-Match", "*")
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "original_url") {
+		t.Errorf("expected the patch to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	w = serve(router, http.MethodPut, "/api/links/1", `{"original_url": "http://intranet.example.com/"}`, "If-Match", `"1"`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "original_url") {
+		t.Errorf("expected the update to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Numeric shorthands for an address are checked as that address.
+	denyOnly := link.NewService(repo, "https://short.io", link.WithDestinationPolicy(domainLink.DestinationPolicy{}, fakeResolver{}))
+	numeric := gin.New()
+	linkhttp.NewHandler(denyOnly, linkhttp.HandlerConfig{}).RegisterRoutes(numeric)
+	for destination, want := range map[string]string{
+		"http://2130706433/":      domainLink.ErrPrivateDestination.Error(),
+		"http://0x7f.1/":          domainLink.ErrPrivateDestination.Error(),
+		"http://127.1:8080/admin": domainLink.ErrPrivateDestination.Error(),
+		"http://0251.0376.43518/": domainLink.ErrPrivateDestination.Error(),
+		"http://256.1.1.1/":       domainLink.ErrInvalidURL.Error(),
+	} {
+		w := serve(numeric, http.MethodPost, "/api/links", `{"original_url": "`+destination+`"}`)
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: expected %q, got %d %s", destination, want, w.Code, w.Body.String())
+		}
+	}
+
+	// Without a policy only the schemes and the base URL are restricted.
+	plain, _ := newTestRouter()
+	if w := serve(plain, http.MethodPost, "/api/links", `{"original_url": "http://10.0.0.1/"}`); w.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w := serve(plain, http.MethodPost, "/api/links", `{"original_url": "https://short.io/r/abc"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("phish.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blocked := blocklist.New([]blocklist.Source{{Name: "domains.txt", Format: blocklist.FormatDomains, Path: path}})
+	if err := blocked.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+	service := link.NewService(repo, "https://short.io", link.WithBlocklist(blocked))
+	router := gin.New()
+	linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+
+	w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://login.phish.example/account"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "blocklist") {
+		t.Errorf("expected the destination to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://later.example/x", "short_name": "later"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if err := os.WriteFile(path, []byte("phish.example\nlater.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := blocked.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		w = serve(router, http.MethodGet, "/r/later", "", "User-Agent", browserUserAgent)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "phishing") {
+			t.Errorf("expected the warning page, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	if l := repo.links[1]; l.Status != domainLink.StatusDisabled || l.StatusReason != "blocklist: domains.txt" {
+		t.Errorf("expected the link to be disabled, got %s %q", l.Status, l.StatusReason)
+	}
+
+	// The warning follows from why the service disabled the link, not from
+	// what a moderator typed as the reason.
+	if w := serve(router, http.MethodPost, "/api/links/1/disable", `{"reason": "blocklist: checked by hand"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = serve(router, http.MethodGet, "/r/later", "", "User-Agent", browserUserAgent)
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "phishing") {
+		t.Errorf("expected the plain disabled page, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAbuseReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+	service := link.NewService(repo, "https://short.io", link.WithAbuseThreshold(2))
+	router := gin.New()
+	linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+
+	for _, body := range []string{
+		`{"original_url": "https://example.com/prize", "short_name": "prize"}`,
+		`{"original_url": "https://example.com/other", "short_name": "other"}`,
+	} {
+		if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	report := `{"reason": "phishing", "details": "asks for my bank password"}`
+	t.Run("POST /r/:code/report queues a report", func(t *testing.T) {
+		for range 2 {
+			w := serve(router, http.MethodPost, "/r/prize/report", report, "X-Forwarded-For", "198.51.100.1")
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+			}
+		}
+		// The same reporter twice does not reach a threshold of two.
+		if !repo.links[1].IsActive() {
+			t.Error("expected the link to stay active")
+		}
+	})
+
+	t.Run("POST /r/:code/report validates the report", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/r/prize/report", `{"reason": "boring"}`)
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"reason"`) {
+			t.Errorf("expected a reason error, got %d %s", w.Code, w.Body.String())
+		}
+		if w := serve(router, http.MethodPost, "/r/missing/report", report); w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("reaching the threshold disables the link", func(t *testing.T) {
+		if w := serve(router, http.MethodPost, "/r/prize/report", report, "X-Forwarded-For", "198.51.100.2"); w.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+		}
+		w := serve(router, http.MethodGet, "/r/prize", "")
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "reported for abuse") {
+			t.Errorf("expected the abuse notice, got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("the abuse page posts reports", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/abuse?link=other", "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="other"`) {
+			t.Errorf("expected the form filled in, got %d %s", w.Code, w.Body.String())
+		}
+
+		w = serve(router, http.MethodPost, "/abuse", "link=https%3A%2F%2Fshort.io%2Fr%2Fother&reason=spam",
+			"Content-Type", "application/x-www-form-urlencoded")
+		if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), "Thank you") {
+			t.Errorf("expected the thank-you page, got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("GET /api/abuse_reports lists the queue", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/abuse_reports?status=open&link_id=1", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var reports []linkhttp.AbuseReportResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &reports); err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) != 3 || reports[0].Reason != "phishing" || reports[0].ReporterIP != "198.51.100.1" {
+			t.Errorf("unexpected reports: %+v", reports)
+		}
+		if got := w.Header().Get("Content-Range"); !strings.HasSuffix(got, "/3") {
+			t.Errorf("unexpected Content-Range %q", got)
+		}
+		if w := serve(router, http.MethodGet, "/api/abuse_reports?status=pending", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("POST /api/abuse_reports/:id/dismiss closes a report", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/abuse_reports/4/dismiss", "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"dismissed"`) {
+			t.Errorf("expected the report dismissed, got %d %s", w.Code, w.Body.String())
+		}
+		if w := serve(router, http.MethodPost, "/api/abuse_reports/4/dismiss", ""); w.Code != http.StatusConflict {
+			t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+		}
+		if w := serve(router, http.MethodPost, "/api/abuse_reports/99/dismiss", ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+		if !repo.links[2].IsActive() {
+			t.Error("expected dismissing to leave the link alone")
+		}
+	})
+
+	t.Run("POST /api/abuse_reports/:id/disable actions every open report", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/abuse_reports/1/disable", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp linkhttp.AbuseActionResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Report.Status != "actioned" || resp.Link.Status != "disabled" || resp.Link.StatusReason != "abuse: phishing" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+		if n, _ := repo.CountAbuseReports(context.Background(), domainLink.AbuseReportFilter{LinkID: 1, Status: domainLink.AbuseReportOpen}); n != 0 {
+			t.Errorf("expected no open reports left, got %d", n)
+		}
+		if len(repo.audits) != 2 || repo.audits[1].Action != domainLink.AuditAbuseDisabled || repo.audits[1].Affected != 3 {
+			t.Errorf("unexpected audit log: %+v", repo.audits)
+		}
+	})
+
+	t.Run("PATCH /api/links/:id sets the link's threshold", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/links/2", `{"abuse_threshold": 1}`, "If-Match", "*")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"abuse_threshold":1`) {
+			t.Fatalf("expected the threshold set, got %d %s", w.Code, w.Body.String())
+		}
+		if w := serve(router, http.MethodPatch, "/api/links/2", `{"abuse_threshold": -1}`, "If-Match", "*"); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+		if w := serve(router, http.MethodPost, "/r/other/report", `{"reason": "spam"}`); w.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+		}
+		if repo.links[2].IsActive() {
+			t.Error("expected a single report to disable the link")
+		}
+	})
+
+	t.Run("reporters are counted by a key that neither rotates nor merges", func(t *testing.T) {
+		for salt, wantActive := range map[string]bool{"pepper": false, "": true} {
+			anonymizer, err := ipprivacy.New("truncate", salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+			service := link.NewService(repo, "https://short.io", link.WithAbuseThreshold(2), link.WithIPAnonymizer(anonymizer))
+			router := gin.New()
+			linkhttp.NewHandler(service, linkhttp.HandlerConfig{}).RegisterRoutes(router)
+			if w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "shared"}`); w.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+			}
+
+			// Both addresses truncate to the same network.
+			for _, ip := range []string{"198.51.100.1", "198.51.100.1", "198.51.100.2"} {
+				if w := serve(router, http.MethodPost, "/r/shared/report", report, "X-Forwarded-For", ip); w.Code != http.StatusAccepted {
+					t.Fatalf("expected status %d, got %d", http.StatusAccepted, w.Code)
+				}
+			}
+			if got := repo.links[1].IsActive(); got != wantActive {
+				t.Errorf("salt %q: expected active %v, got %v", salt, wantActive, got)
+			}
+			if len(repo.abuseReports) != 3 {
+				t.Errorf("salt %q: expected every report queued, got %d", salt, len(repo.abuseReports))
+			}
+		}
+	})
+}
+
+func TestClickCounters(t *testing.T) {
+	router, repo := newTestRouter()
+
+	for _, name := range []string{"quiet", "busy"} {
+		body := `{"original_url": "https://example.com/` + name + `", "short_name": "` + name + `"}`
+		if w := serve(router, http.MethodPost, "/api/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+	serve(router, http.MethodGet, "/r/busy", "", "User-Agent", browserUserAgent)
+	serve(router, http.MethodGet, "/r/busy", "", "User-Agent", browserUserAgent)
+	serve(router, http.MethodGet, "/r/quiet", "", "User-Agent", browserUserAgent)
+
+	// A visit answered with a notice page is recorded but not counted.
+	repo.links[1].Status = domainLink.StatusDisabled
+	if w := serve(router, http.MethodGet, "/r/quiet", "", "User-Agent", browserUserAgent); w.Code == http.StatusFound {
+		t.Fatal("expected the disabled link not to redirect")
+	}
+	repo.links[1].Status = domainLink.StatusActive
+
+	w := serve(router, http.MethodGet, `/api/links?sort=["click_count","DESC"]`, "")
+	var got []linkhttp.LinkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(got) != 2 || got[0].ShortName != "busy" || got[0].ClickCount != 2 || got[1].ClickCount != 1 {
+		t.Fatalf("unexpected links %+v", got)
+	}
+	if got[0].LastVisitedAt == nil {
+		t.Error("expected last_visited_at to be set")
+	}
+
+	if len(repo.visits) != 4 {
+		t.Fatalf("expected 4 recorded visits, got %d", len(repo.visits))
+	}
+	repo.visits = append(repo.visits[:1], repo.visits[3])
+	service := link.NewService(repo, "https://short.io")
+	if fixed, err := service.ReconcileClickCounts(context.Background()); err != nil || fixed != 2 {
+		t.Errorf("expected 2 links reconciled, got %d (%v)", fixed, err)
+	}
+	if repo.links[1].ClickCount != 0 || repo.links[2].ClickCount != 1 {
+		t.Errorf("unexpected counts after reconciling: %d and %d", repo.links[1].ClickCount, repo.links[2].ClickCount)
+	}
+}
+
+type recordingFetcher struct {
+	fetched chan string
+}
+
+func (f *recordingFetcher) Fetch(ctx context.Context, rawURL string) (domainLink.Metadata, error) {
+	f.fetched <- rawURL
+	return domainLink.Metadata{}, nil
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &mockRepository{links: make(map[int64]*domainLink.Link), shortNameExists: make(map[string]bool), nextID: 1}
+	service := link.NewService(repo, "https://short.io")
+	store := ratelimit.NewMemoryStore()
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if key := c.GetHeader("X-Test-Key"); key != "" {
+			c.Set(linkhttp.APIKeyContextKey, key)
+		}
+	})
+	linkhttp.NewHandler(service, linkhttp.HandlerConfig{
+		CreateLimiter:   ratelimit.New(store, "create", ratelimit.Limit{Requests: 2, Period: time.Minute}),
+		BulkLimiter:     ratelimit.New(store, "bulk", ratelimit.Limit{Requests: 1, Period: time.Hour}),
+		RedirectLimiter: ratelimit.New(store, "redirect", ratelimit.Limit{Requests: 1, Period: time.Minute}),
+		ReportLimiter:   ratelimit.New(store, "report", ratelimit.Limit{Requests: 1, Period: time.Hour}),
+	}).RegisterRoutes(router)
+
+	t.Run("POST /api/links is limited per client", func(t *testing.T) {
+		for i, name := range []string{"first", "second"} {
+			w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "`+name+`"}`)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+			}
+			if got := w.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(1-i) {
+				t.Errorf("expected %d requests remaining, got %q", 1-i, got)
+			}
+		}
+
+		w := serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "third"}`)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+		}
+		if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Limit") != "2" ||
+			w.Header().Get("RateLimit-Reset") != "60" || w.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Errorf("unexpected headers %v", w.Header())
+		}
+		if _, ok := repo.shortNameExists["third"]; ok {
+			t.Error("expected the refused request not to create a link")
+		}
+
+		w = serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "third"}`, "X-Forwarded-For", "198.51.100.7")
+		if w.Code != http.StatusCreated {
+			t.Errorf("expected another address to have its own bucket, got %d", w.Code)
+		}
+		w = serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "fourth"}`, "X-Api-Key", "secret")
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("expected request headers not to open a new bucket, got %d", w.Code)
+		}
+		w = serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "fourth"}`, "X-Test-Key", "secret")
+		if w.Code != http.StatusCreated {
+			t.Errorf("expected an authenticated API key to have its own bucket, got %d", w.Code)
+		}
+
+		for i, ip := range []string{"2001:db8:1:2::1", "2001:db8:1:2::2", "2001:db8:1:2:ffff::3"} {
+			w = serve(router, http.MethodPost, "/api/links", `{"original_url": "https://example.com", "short_name": "v6-`+strconv.Itoa(i)+`"}`, "X-Forwarded-For", ip)
+			want := http.StatusCreated
+			if i == 2 {
+				want = http.StatusTooManyRequests
+			}
+			if w.Code != want {
+				t.Errorf("%s: expected IPv6 clients limited per /64, got %d", ip, w.Code)
+			}
+		}
+	})
+
+	t.Run("batches and imports have their own limit", func(t *testing.T) {
+		batch := `{"operations": [{"op": "create", "original_url": "https://example.com", "short_name": "bulk"}]}`
+		w := serve(router, http.MethodPost, "/api/links/batch", batch)
+		if w.Code == http.StatusTooManyRequests || w.Header().Get("RateLimit-Limit") != "1" {
+			t.Fatalf("expected the bulk limit, got %d %v", w.Code, w.Header())
+		}
+		if w := serve(router, http.MethodPost, "/api/links/import", "original_url\nhttps://example.com\n"); w.Code != http.StatusTooManyRequests {
+			t.Errorf("expected imports to share the batch bucket, got %d", w.Code)
+		}
+	})
+
+	t.Run("GET /r/:code has its own limit", func(t *testing.T) {
+		if w := serve(router, http.MethodGet, "/r/first", ""); w.Code != http.StatusFound {
+			t.Fatalf("expected status %d, got %d", http.StatusFound, w.Code)
+		}
+		w := serve(router, http.MethodGet, "/r/first", "")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected a refusal for 60s, got %d %v", w.Code, w.Header())
+		}
+		if w := serve(router, http.MethodGet, "/api/links/1", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("expected other routes to be unlimited, got %d %v", w.Code, w.Header())
+		}
+	})
+
+	t.Run("both ways of reporting abuse share a limit", func(t *testing.T) {
+		if w := serve(router, http.MethodPost, "/r/first/report", `{"reason": "spam"}`); w.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+		}
+		for _, target := range []string{"/r/first/report", "/abuse"} {
+			if w := serve(router, http.MethodPost, target, `{"reason": "spam"}`); w.Code != http.StatusTooManyRequests {
+				t.Errorf("%s: expected status %d, got %d", target, http.StatusTooManyRequests, w.Code)
+			}
+		}
+	})
+
+	t.Run("a failing store lets requests through", func(t *testing.T) {
+		router := gin.New()
+		linkhttp.NewHandler(service, linkhttp.HandlerConfig{
+			RedirectLimiter: ratelimit.New(failingStore{}, "redirect", ratelimit.Limit{Requests: 1, Period: time.Minute}),
+		}).RegisterRoutes(router)
+		for range 2 {
+			if w := serve(router, http.MethodGet, "/r/first", ""); w.Code != http.StatusFound {
+				t.Errorf("expected status %d, got %d", http.StatusFound, w.Code)
+			}
+		}
+	})
+}
+
+func TestTrustedProxies(t *testing.T) {
+	clientIP := func(cfg *config.Config, headers ...string) string {
+		cfg.UIURL = "https://ui.example.com"
+		r, err := router(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/ip", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+		return serve(r, http.MethodGet, "/ip", "", headers...).Body.String()
+	}
+
+	// httptest requests come from 192.0.2.1.
+	if got := clientIP(&config.Config{}, "X-Forwarded-For", "198.51.100.7", "CF-Connecting-IP", "198.51.100.8"); got != "192.0.2.1" {
+		t.Errorf("expected forwarding headers to be ignored without trusted proxies, got %s", got)
+	}
+	if got := clientIP(&config.Config{TrustedProxies: []string{"192.0.2.1"}}, "X-Forwarded-For", "198.51.100.7"); got != "198.51.100.7" {
+		t.Errorf("expected X-Forwarded-For from a trusted proxy, got %s", got)
+	}
+	if got := clientIP(&config.Config{TrustedProxies: []string{"10.0.0.0/8"}}, "X-Forwarded-For", "198.51.100.7"); got != "192.0.2.1" {
+		t.Errorf("expected X-Forwarded-For from an untrusted peer to be ignored, got %s", got)
+	}
+	cloudflare := &config.Config{TrustedProxies: []string{"192.0.2.0/24"}, ClientIPHeaders: []string{"CF-Connecting-IP"}}
+	if got := clientIP(cloudflare, "X-Forwarded-For", "198.51.100.7", "CF-Connecting-IP", "198.51.100.8"); got != "198.51.100.8" {
+		t.Errorf("expected CF-Connecting-IP from a trusted proxy, got %s", got)
+	}
+	if got := clientIP(&config.Config{TrustedPlatform: "cloudflare"}, "X-Forwarded-For", "198.51.100.7", "CF-Connecting-IP", "198.51.100.8"); got != "198.51.100.8" {
+		t.Errorf("expected CF-Connecting-IP on the Cloudflare platform, got %s", got)
+	}
+	if _, err := router(&config.Config{UIURL: "https://ui.example.com", TrustedProxies: []string{"not an address"}}); err == nil {
+		t.Error("expected an invalid proxy to be refused")
+	}
+	if _, err := router(&config.Config{UIURL: "https://ui.example.com", TrustedPlatform: "fastly"}); err == nil {
+		t.Error("expected an unknown platform to be refused")
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "")
+	os.Unsetenv("TRUSTED_PROXIES")
+	if cfg := config.Load(); !slices.Equal(cfg.TrustedProxies, []string{"127.0.0.1", "::1"}) {
+		t.Errorf("expected localhost trusted by default, got %v", cfg.TrustedProxies)
+	}
+
+	limiters := rateLimiters{report: ratelimit.New(ratelimit.NewMemoryStore(), "report", ratelimit.Limit{Requests: 1, Period: time.Minute})}
+	if err := checkClientIP(&config.Config{}, limiters); err == nil {
+		t.Error("expected rate limits without trusted proxies to be refused")
+	}
+	if err := checkClientIP(&config.Config{AbuseReportThreshold: 5}, rateLimiters{}); err == nil {
+		t.Error("expected abuse reports without trusted proxies to be refused")
+	}
+	if err := checkClientIP(&config.Config{TrustedProxies: []string{"127.0.0.1"}}, limiters); err != nil {
+		t.Errorf("expected a trusted proxy to be enough, got %v", err)
+	}
+	if err := checkClientIP(&config.Config{}, rateLimiters{}); err != nil {
+		t.Errorf("expected no client address features to need no proxy, got %v", err)
+	}
+}
+
+type mockRepository struct {
+	links           map[int64]*domainLink.Link
+	shortNameExists map[string]bool
+	nextID          int64
+	visits          []*domainLink.LinkVisit
+	audits          []*domainLink.AuditEntry
+	dailyStats      []*domainLink.DailyStats
+	healthChecks    []*domainLink.HealthCheck
+	abuseReports    []*domainLink.AbuseReport
+}
+
+func (m *mockRepository) Create(ctx context.Context, link *domainLink.Link) error {
+	link.ID = m.nextID
+	m.nextID++
+	m.links[link.ID] = link
+	m.shortNameExists[link.ShortName] = true
+	return nil
+}
+
+func (m *mockRepository) GetByID(ctx context.Context, id int64) (*domainLink.Link, error) {
+	link, ok := m.links[id]
+	if !ok || link.IsDeleted() {
+		return nil, domainLink.ErrLinkNotFound
+	}
+	return link, nil
+}
+
+func (m *mockRepository) GetByShortName(ctx context.Context, shortName string) (*domainLink.Link, error) {
+	for _, link := range m.links {
+		if link.ShortName == shortName && !link.IsDeleted() {
+			return link, nil
+		}
+	}
+	return nil, domainLink.ErrLinkNotFound
+}
+
+func (m *mockRepository) GetAll(ctx context.Context, filter domainLink.LinkFilter, order domainLink.Sort, offset, limit int) ([]*domainLink.Link, error) {
+	all := make([]*domainLink.Link, 0, len(m.links))
+	for _, l := range m.links {
+		if matchesFilter(l, filter) {
+			all = append(all, l)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		less := all[i].ID < all[j].ID
+		switch order.Field {
+		case domainLink.SortByShortName:
+			less = all[i].ShortName < all[j].ShortName
+		case domainLink.SortByClickCount:
+			less = all[i].ClickCount < all[j].ClickCount
+		}
+		if order.Desc {
+			return !less
+		}
+		return less
+	})
+
+	if offset >= len(all) {
+		return []*domainLink.Link{}, nil
+	}
+	return all[offset:min(offset+limit, len(all))], nil
+}
+
+func (m *mockRepository) GetLinksPage(ctx context.Context, filter domainLink.LinkFilter, page domainLink.KeysetPage) ([]*domainLink.Link, error) {
+	all := make([]*domainLink.Link, 0, len(m.links))
+	for _, l := range m.links {
+		if matchesFilter(l, filter) {
+			all = append(all, l)
+		}
+	}
+	return mockKeyset(all, page, func(l *domainLink.Link) domainLink.Cursor {
+		return domainLink.Cursor{CreatedAt: l.CreatedAt, ID: l.ID}
+	}), nil
+}
+
+func (m *mockRepository) CountLinks(ctx context.Context, filter domainLink.LinkFilter, mode domainLink.CountMode) (int, error) {
+	if mode == domainLink.CountNone {
+		return -1, nil
+	}
+	total := 0
+	for _, l := range m.links {
+		if matchesFilter(l, filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, link *domainLink.Link) error {
+	existing, ok := m.links[link.ID]
+	if !ok || existing.IsDeleted() {
+		return domainLink.ErrLinkNotFound
+	}
+	if existing.Version != link.Version {
+		return domainLink.ErrVersionConflict
+	}
+	if link.OriginalURL != existing.OriginalURL {
+		link.Metadata = domainLink.Metadata{}
+		link.Health = domainLink.HealthStatus{}
+	}
+	link.CreatedAt = existing.CreatedAt
+	link.Status = existing.Status
+	link.StatusReason = existing.StatusReason
+	link.StatusCause = existing.StatusCause
+	link.Version++
+	m.links[link.ID] = link
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id int64) error {
+	link, ok := m.links[id]
+	if !ok || link.IsDeleted() {
+		return domainLink.ErrLinkNotFound
+	}
+	now := time.Now()
+	link.DeletedAt = &now
+	return nil
+}
+
+func (m *mockRepository) SetStatus(ctx context.Context, id int64, status domainLink.Status, cause domainLink.StatusCause, reason string) (*domainLink.Link, error) {
+	link, ok := m.links[id]
+	if !ok || link.IsDeleted() {
+		return nil, domainLink.ErrLinkNotFound
+	}
+	link.Status = status
+	link.StatusReason = reason
+	link.StatusCause = cause
+	link.Version++
+	return link, nil
+}
+
+func (m *mockRepository) Restore(ctx context.Context, id int64) (*domainLink.Link, error) {
+	link, ok := m.links[id]
+	if !ok || !link.IsDeleted() {
+		return nil, domainLink.ErrLinkNotFound
+	}
+	link.DeletedAt = nil
+	return link, nil
+}
+
+func (m *mockRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	for id, link := range m.links {
+		if link.IsDeleted() && link.DeletedAt.Before(before) {
+			delete(m.links, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *mockRepository) ExistsByShortName(ctx context.Context, shortName string) (bool, error) {
+	return m.shortNameExists[shortName], nil
+}
+
+func (m *mockRepository) CreateVisit(ctx context.Context, visit *domainLink.LinkVisit) error {
+	visit.ID = int64(len(m.visits) + 1)
+	m.visits = append(m.visits, visit)
+	if l, ok := m.links[visit.LinkID]; ok && counted(visit) {
+		l.ClickCount++
+		l.LastVisitedAt = &visit.CreatedAt
+	}
+	return nil
+}
+
+func (m *mockRepository) SetMetadata(ctx context.Context, id int64, originalURL string, metadata domainLink.Metadata) error {
+	if l, ok := m.links[id]; ok && l.OriginalURL == originalURL {
+		l.Metadata = metadata
+	}
+	return nil
+}
+
+func (m *mockRepository) GetLinksWithoutMetadata(ctx context.Context, limit int) ([]*domainLink.Link, error) {
+	links := []*domainLink.Link{}
+	for _, l := range m.links {
+		if l.Metadata.FetchedAt == nil && !l.IsDeleted() {
+			links = append(links, l)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func (m *mockRepository) GetLinksDueForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*domainLink.Link, error) {
+	links := []*domainLink.Link{}
+	for _, l := range m.links {
+		if l.IsDeleted() || !l.IsActive() {
+			continue
+		}
+		if l.Health.CheckedAt == nil || l.Health.CheckedAt.Before(checkedBefore) {
+			links = append(links, l)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func (m *mockRepository) RecordHealthCheck(ctx context.Context, check *domainLink.HealthCheck, brokenAfter int) (domainLink.HealthStatus, error) {
+	l, ok := m.links[check.LinkID]
+	if !ok {
+		return domainLink.HealthStatus{}, domainLink.ErrLinkNotFound
+	}
+	check.ID = int64(len(m.healthChecks) + 1)
+	m.healthChecks = append(m.healthChecks, check)
+
+	status := domainLink.HealthStatus{CheckedAt: &check.CheckedAt}
+	if !check.Healthy() {
+		status.ConsecutiveFailures = l.Health.ConsecutiveFailures + 1
+		status.Broken = status.ConsecutiveFailures >= brokenAfter
+	}
+	l.Health = status
+	return status, nil
+}
+
+func (m *mockRepository) GetHealthChecks(ctx context.Context, linkID int64, limit int) ([]*domainLink.HealthCheck, error) {
+	checks := []*domainLink.HealthCheck{}
+	for i := len(m.healthChecks) - 1; i >= 0 && len(checks) < limit; i-- {
+		if m.healthChecks[i].LinkID == linkID {
+			checks = append(checks, m.healthChecks[i])
+		}
+	}
+	return checks, nil
+}
+
+func (m *mockRepository) PruneHealthChecks(ctx context.Context, before time.Time) (int64, error) {
+	kept := m.healthChecks[:0]
+	for _, check := range m.healthChecks {
+		if !check.CheckedAt.Before(before) {
+			kept = append(kept, check)
+		}
+	}
+	pruned := int64(len(m.healthChecks) - len(kept))
+	m.healthChecks = kept
+	return pruned, nil
+}
+
+func (m *mockRepository) CreateAbuseReport(ctx context.Context, report *domainLink.AbuseReport) error {
+	report.ID = int64(len(m.abuseReports) + 1)
+	m.abuseReports = append(m.abuseReports, report)
+	return nil
+}
+
+func (m *mockRepository) GetAbuseReport(ctx context.Context, id int64) (*domainLink.AbuseReport, error) {
+	for _, report := range m.abuseReports {
+		if report.ID == id {
+			return report, nil
+		}
+	}
+	return nil, domainLink.ErrAbuseReportNotFound
+}
+
+func (m *mockRepository) GetAbuseReports(ctx context.Context, filter domainLink.AbuseReportFilter, offset, limit int) ([]*domainLink.AbuseReport, error) {
+	reports := m.filterAbuseReports(filter)
+	if offset >= len(reports) {
+		return []*domainLink.AbuseReport{}, nil
+	}
+	return reports[offset:min(offset+limit, len(reports))], nil
+}
+
+func (m *mockRepository) CountAbuseReports(ctx context.Context, filter domainLink.AbuseReportFilter) (int, error) {
+	return len(m.filterAbuseReports(filter)), nil
+}
+
+func (m *mockRepository) CountAbuseReporters(ctx context.Context, linkID int64) (int, error) {
+	reporters := make(map[string]bool)
+	for _, report := range m.filterAbuseReports(domainLink.AbuseReportFilter{LinkID: linkID, Status: domainLink.AbuseReportOpen}) {
+		if report.ReporterKey != "" {
+			reporters[report.ReporterKey] = true
+		}
+	}
+	return len(reporters), nil
+}
+
+func (m *mockRepository) ResolveAbuseReport(ctx context.Context, id int64, status domainLink.AbuseReportStatus) (*domainLink.AbuseReport, error) {
+	report, err := m.GetAbuseReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status != domainLink.AbuseReportOpen {
+		return nil, domainLink.ErrAbuseReportResolved
+	}
+	now := time.Now()
+	report.Status, report.ResolvedAt = status, &now
+	return report, nil
+}
+
+func (m *mockRepository) ResolveLinkAbuseReports(ctx context.Context, linkID int64, status domainLink.AbuseReportStatus) (int64, error) {
+	var resolved int64
+	now := time.Now()
+	for _, report := range m.filterAbuseReports(domainLink.AbuseReportFilter{LinkID: linkID, Status: domainLink.AbuseReportOpen}) {
+		report.Status, report.ResolvedAt = status, &now
+		resolved++
+	}
+	return resolved, nil
+}
+
+func (m *mockRepository) filterAbuseReports(filter domainLink.AbuseReportFilter) []*domainLink.AbuseReport {
+	reports := []*domainLink.AbuseReport{}
+	for _, report := range m.abuseReports {
+		if (filter.LinkID == 0 || report.LinkID == filter.LinkID) && (filter.Status == "" || report.Status == filter.Status) {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+func (m *mockRepository) ReconcileClickCounts(ctx context.Context) (int64, error) {
+	var fixed int64
+	for _, l := range m.links {
+		var clicks int64
+		for _, v := range m.visits {
+			if v.LinkID == l.ID && counted(v) {
+				clicks++
+			}
+		}
+		if l.ClickCount != clicks {
+			l.ClickCount = clicks
+			fixed++
+		}
+	}
+	return fixed, nil
+}
+
+func (m *mockRepository) GetVisits(ctx context.Context, filter domainLink.VisitFilter, offset, limit int) ([]*domainLink.LinkVisit, error) {
+	visits := m.filterVisits(filter)
+	sort.Slice(visits, func(i, j int) bool { return visits[i].ID > visits[j].ID })
+	if offset >= len(visits) {
+		return []*domainLink.LinkVisit{}, nil
+	}
+	return visits[offset:min(offset+limit, len(visits))], nil
+}
+
+func (m *mockRepository) GetVisitsPage(ctx context.Context, filter domainLink.VisitFilter, page domainLink.KeysetPage) ([]*domainLink.LinkVisit, error) {
+	return mockKeyset(m.filterVisits(filter), page, func(v *domainLink.LinkVisit) domainLink.Cursor {
+		return domainLink.Cursor{CreatedAt: v.CreatedAt, ID: v.ID}
+	}), nil
+}
+
+func (m *mockRepository) CountVisits(ctx context.Context, filter domainLink.VisitFilter, mode domainLink.CountMode) (int, error) {
+	if mode == domainLink.CountNone {
+		return -1, nil
+	}
+	return len(m.filterVisits(filter)), nil
+}
+
+func (m *mockRepository) DeleteVisits(ctx context.Context, filter domainLink.VisitFilter) (int64, error) {
+	for _, v := range m.filterVisits(filter) {
+		if l, ok := m.links[v.LinkID]; ok && counted(v) {
+			l.ClickCount--
+		}
+	}
+	return m.dropVisits(filter), nil
+}
+
+func (m *mockRepository) dropVisits(filter domainLink.VisitFilter) int64 {
+	kept := m.visits[:0:0]
+	for _, v := range m.visits {
+		if !matchesVisitFilter(v, filter) {
+			kept = append(kept, v)
+		}
+	}
+	deleted := int64(len(m.visits) - len(kept))
+	m.visits = kept
+	return deleted
+}
+
+func (m *mockRepository) RecordAudit(ctx context.Context, entry *domainLink.AuditEntry) error {
+	entry.ID = int64(len(m.audits) + 1)
+	m.audits = append(m.audits, entry)
+	return nil
+}
+
+func (m *mockRepository) GetDailyStats(ctx context.Context, filter domainLink.VisitFilter) ([]*domainLink.DailyStats, error) {
+	stats := []*domainLink.DailyStats{}
+	for _, d := range m.dailyStats {
+		switch {
+		case filter.LinkID != 0 && d.LinkID != filter.LinkID:
+		case filter.From != nil && d.Day.Before(filter.From.Truncate(24*time.Hour)):
+		case filter.To != nil && d.Day.After(*filter.To):
+		case filter.HasClass() && d.Class != filter.Class:
+		default:
+			stats = append(stats, d)
+		}
+	}
+	for _, v := range m.filterVisits(filter) {
+		referer := v.Referer
+		if referer == "" {
+			referer = domainLink.DirectReferer
+		}
+		var redirects int64
+		if v.Status >= 300 && v.Status < 400 {
+			redirects = 1
+		}
+		stats = append(stats, &domainLink.DailyStats{
+			LinkID:    v.LinkID,
+			Day:       v.CreatedAt.UTC().Truncate(24 * time.Hour),
+			Class:     visitClass(v),
+			Clicks:    1,
+			Redirects: redirects,
+			Uniques:   1,
+			Referrers: map[string]int64{referer: 1},
+		})
+	}
+	return stats, nil
+}
+
+func (m *mockRepository) GetVisitorSketches(ctx context.Context, linkID int64, from, to *time.Time) ([]*domainLink.VisitorSketch, error) {
+	byDay := make(map[time.Time]*hll.Sketch)
+	var sketches []*domainLink.VisitorSketch
+	for _, v := range m.visits {
+		day := v.CreatedAt.UTC().Truncate(24 * time.Hour)
+		switch {
+		case v.LinkID != linkID || !counted(v):
+		case from != nil && day.Before(from.UTC().Truncate(24*time.Hour)):
+		case to != nil && day.After(*to):
+		default:
+			if _, ok := byDay[day]; !ok {
+				byDay[day] = hll.New()
+			}
+			byDay[day].Add(v.IP)
+		}
+	}
+	for day, sketch := range byDay {
+		sketches = append(sketches, &domainLink.VisitorSketch{LinkID: linkID, Day: day, Sketch: sketch.Bytes()})
+	}
+	return sketches, nil
+}
+
+func (m *mockRepository) RollupVisits(ctx context.Context, before time.Time) (int64, error) {
+	cutoff := before.UTC().Truncate(24 * time.Hour)
+	old, _ := m.GetDailyStats(ctx, domainLink.VisitFilter{To: &cutoff})
+	deleted := m.dropVisits(domainLink.VisitFilter{To: &cutoff})
+	m.dailyStats = old
+	return deleted, nil
+}
+
+func (m *mockRepository) filterVisits(filter domainLink.VisitFilter) []*domainLink.LinkVisit {
+	visits := []*domainLink.LinkVisit{}
+	for _, v := range m.visits {
+		if matchesVisitFilter(v, filter) {
+			visits = append(visits, v)
+		}
+	}
+	return visits
+}
+
+func (m *mockRepository) DeleteVisit(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *mockRepository) ExportLinks(ctx context.Context, filter domainLink.LinkFilter, fn func(*domainLink.Link) error) error {
+	ids := make([]int64, 0, len(m.links))
+	for id, l := range m.links {
+		if matchesFilter(l, filter) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		if err := fn(m.links[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) ExportVisits(ctx context.Context, filter domainLink.VisitFilter, fn func(*domainLink.LinkVisit) error) error {
+	for _, v := range m.filterVisits(filter) {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) InTx(ctx context.Context, fn func(repo domainLink.Repository) error) error {
+	links := make(map[int64]domainLink.Link, len(m.links))
+	for id, l := range m.links {
+		links[id] = *l
+	}
+	shortNames := make(map[string]bool, len(m.shortNameExists))
+	for name, exists := range m.shortNameExists {
+		shortNames[name] = exists
+	}
+	nextID := m.nextID
+	visits, audits, abuseReports := m.visits, m.audits, m.abuseReports
+
+	if err := fn(m); err != nil {
+		m.links = make(map[int64]*domainLink.Link, len(links))
+		for id, l := range links {
+			m.links[id] = &l
+		}
+		m.shortNameExists = shortNames
+		m.nextID = nextID
+		m.visits, m.audits, m.abuseReports = visits, audits, abuseReports
+		return err
+	}
+	return nil
+}
+
+// mockKeyset mimics the repository's keyset query: up to Limit+1 rows
+// newest first, starting after the cursor in its direction.
+func mockKeyset[T any](rows []T, page domainLink.KeysetPage, key func(T) domainLink.Cursor) []T {
+	newer := func(a, b domainLink.Cursor) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	}
+	sort.Slice(rows, func(i, j int) bool { return newer(key(rows[i]), key(rows[j])) })
+
+	if page.Cursor == nil {
+		return rows[:min(page.Limit+1, len(rows))]
+	}
+
+	var before, after []T
+	for _, row := range rows {
+		switch k := key(row); {
+		case newer(k, *page.Cursor):
+			before = append(before, row)
+		case newer(*page.Cursor, k):
+			after = append(after, row)
+		}
+	}
+	if page.Cursor.Backward {
+		return before[max(0, len(before)-page.Limit-1):]
+	}
+	return after[:min(page.Limit+1, len(after))]
+}
+
+func matchesVisitFilter(v *domainLink.LinkVisit, filter domainLink.VisitFilter) bool {
+	switch {
+	case filter.LinkID != 0 && v.LinkID != filter.LinkID:
+		return false
+	case filter.Status != 0 && v.Status != filter.Status:
+		return false
+	case filter.IP != "" && v.IP != filter.IP:
+		return false
+	case len(filter.IPs) > 0 && !slices.Contains(filter.IPs, v.IP):
+		return false
+	case filter.Referer != "" && !strings.Contains(v.Referer, filter.Referer):
+		return false
+	case filter.From != nil && v.CreatedAt.Before(*filter.From):
+		return false
+	case filter.To != nil && v.CreatedAt.After(*filter.To):
+		return false
+	case filter.HasClass() && visitClass(v) != filter.Class:
+		return false
+	}
+	return true
+}
+
+// visitClass mirrors the column default, which counts unclassified visits
+// as human.
+func visitClass(v *domainLink.LinkVisit) domainLink.VisitClass {
+	if v.Class == "" {
+		return domainLink.VisitHuman
+	}
+	return v.Class
+}
+
+// counted matches the visits that CreateLinkVisit counts: redirected humans.
+func counted(v *domainLink.LinkVisit) bool {
+	return visitClass(v) == domainLink.VisitHuman && v.Status >= 300 && v.Status < 400
+}
+
+func matchesFilter(l *domainLink.Link, filter domainLink.LinkFilter) bool {
+	if l.IsDeleted() != filter.Deleted {
+		return false
+	}
+	if filter.Query != "" && !strings.Contains(l.OriginalURL, filter.Query) && !strings.Contains(l.ShortName, filter.Query) {
+		return false
+	}
+	if filter.Broken != nil && l.Health.Broken != *filter.Broken {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		found := false
+		for _, t := range l.Tags {
+			found = found || t == tag
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }